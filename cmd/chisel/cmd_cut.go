@@ -1,10 +1,24 @@
 package main
 
 import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/jessevdk/go-flags"
 
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/manifest"
 	"github.com/canonical/chisel/internal/setup"
 	"github.com/canonical/chisel/internal/slicer"
 )
@@ -16,18 +30,53 @@ to create a new filesystem tree in the root location.
 
 By default it fetches the slices for the same Ubuntu version as the
 current host, unless the --release flag is used.
+
+With --output-tar, the tree is written as a tar archive instead, with
+deterministic ordering and modification times, and without creating
+the tree on disk. Adding --oci-layer writes the archive as a gzip
+compressed OCI image layer and prints its descriptor, including the
+layer diffID.
+
+With --reproducible, or when SOURCE_DATE_EPOCH is set, repeated cuts of
+the same selection result in identical trees: entries from packages keep
+their modification times clamped to SOURCE_DATE_EPOCH, and all others
+have it set to SOURCE_DATE_EPOCH, or to the Unix epoch when unset.
+
+When the root location holds a manifest from a previous cut, at one of
+the "generate: manifest" paths of the release, the selected slices are
+added to the installed ones. Only the content of the new slices is
+extracted and only their mutation scripts are run, while the installed
+content is kept as it is. New content that may be created at paths
+listed by installed slices with mutation scripts is rejected, as those
+scripts are not run again.
+
+With --dry-run, the command only reports the packages that would be
+fetched and the paths that each slice would extract or create, including
+generated paths and alternatives, without fetching any packages or
+writing to the root location. Globs are reported as unresolved, as the
+paths they match are only known once the packages are fetched. Slices
+already installed in the root location are left out.
 `
 
 var cutDescs = map[string]string{
-	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
-	"root":    "Root for generated content",
-	"arch":    "Package architecture",
+	"release":      "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":         "Root for generated content",
+	"arch":         "Package architecture",
+	"dry-run":      "Report what would be cut without writing anything",
+	"output-tar":   "Write the tree as a tar archive instead of into --root",
+	"oci-layer":    "Write --output-tar as a gzip compressed OCI image layer",
+	"reproducible": "Normalise modification times for reproducible output",
 }
 
 type cmdCut struct {
-	Release string `long:"release" value-name:"<dir>"`
-	RootDir string `long:"root" value-name:"<dir>" required:"yes"`
-	Arch    string `long:"arch" value-name:"<arch>"`
+	Release   string `long:"release" value-name:"<dir>"`
+	RootDir   string `long:"root" value-name:"<dir>"`
+	Arch      string `long:"arch" value-name:"<arch>"`
+	DryRun    bool   `long:"dry-run"`
+	OutputTar string `long:"output-tar" value-name:"<file>"`
+	OCILayer  bool   `long:"oci-layer"`
+
+	Reproducible bool `long:"reproducible"`
 
 	Positional struct {
 		SliceRefs []string `positional-arg-name:"<slice names>" required:"yes"`
@@ -42,6 +91,19 @@ func (cmd *cmdCut) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
+	if cmd.RootDir == "" && cmd.OutputTar == "" {
+		return fmt.Errorf("either --root or --output-tar must be provided")
+	}
+	if cmd.RootDir != "" && cmd.OutputTar != "" {
+		return fmt.Errorf("cannot use --root and --output-tar together")
+	}
+	if cmd.OCILayer && cmd.OutputTar == "" {
+		return fmt.Errorf("cannot use --oci-layer without --output-tar")
+	}
+	sourceDate, err := sourceDateEpoch(cmd.Reproducible)
+	if err != nil {
+		return err
+	}
 
 	sliceKeys := make([]setup.SliceKey, len(cmd.Positional.SliceRefs))
 	for i, sliceRef := range cmd.Positional.SliceRefs {
@@ -57,32 +119,270 @@ func (cmd *cmdCut) Execute(args []string) error {
 		return err
 	}
 
+	// Slices are added to the content of an existing root, in which case
+	// the installed slices are selected as well.
+	var installed *manifest.Manifest
+	if cmd.RootDir != "" {
+		installed, err = readInstalledManifest(cmd.RootDir, release)
+		if err != nil {
+			return err
+		}
+	}
+	if installed != nil {
+		var installedKeys []setup.SliceKey
+		err = installed.IterateSlices("", func(slice *manifest.Slice) error {
+			sliceKey, err := setup.ParseSliceKey(slice.Name)
+			if err != nil {
+				return err
+			}
+			installedKeys = append(installedKeys, sliceKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sliceKeys = append(installedKeys, sliceKeys...)
+	}
+
 	selection, err := setup.Select(release, sliceKeys)
 	if err != nil {
 		return err
 	}
 
+	archives, err := openArchives(release, cmd.Arch)
+	if err != nil {
+		return err
+	}
+
+	options := &slicer.RunOptions{
+		Selection:  selection,
+		Archives:   archives,
+		TargetDir:  cmd.RootDir,
+		SourceDate: sourceDate,
+		Installed:  installed,
+	}
+	if cmd.DryRun {
+		plan, err := slicer.DryRun(options)
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		return nil
+	}
+	if cmd.OutputTar == "" {
+		_, err = slicer.Run(options)
+		return err
+	}
+
+	memFS := fsutil.NewMemFS()
+	options.TargetDir = "/"
+	options.FS = memFS
+	_, err = slicer.Run(options)
+	if err != nil {
+		return err
+	}
+	return writeOutputTar(cmd.OutputTar, memFS, cmd.OCILayer)
+}
+
+// openArchives opens the archives of release for arch, with the package
+// versions constrained as the release requires.
+func openArchives(release *setup.Release, arch string) (map[string]archive.Archive, error) {
+	constraints := make(map[string]*deb.VersionConstraint)
+	for _, pkg := range release.Packages {
+		if pkg.Version == "" {
+			continue
+		}
+		constraint, err := deb.ParseVersionConstraint(pkg.Version)
+		if err != nil {
+			return nil, err
+		}
+		constraints[pkg.Name] = constraint
+	}
+
+	progress := &fetchProgress{steps: make(map[string]int64)}
 	archives := make(map[string]archive.Archive)
 	for archiveName, archiveInfo := range release.Archives {
 		openArchive, err := archive.Open(&archive.Options{
-			Label:      archiveName,
-			Version:    archiveInfo.Version,
-			Arch:       cmd.Arch,
-			Suites:     archiveInfo.Suites,
-			Components: archiveInfo.Components,
-			CacheDir:   cache.DefaultDir("chisel"),
-			PubKeys:    archiveInfo.PubKeys,
+			Label:       archiveName,
+			Version:     archiveInfo.Version,
+			Arch:        arch,
+			Suites:      archiveInfo.Suites,
+			Components:  archiveInfo.Components,
+			CacheDir:    cache.DefaultDir("chisel"),
+			PubKeys:     archiveInfo.PubKeys,
+			URL:         archiveInfo.URL,
+			Mirrors:     archiveInfo.Mirrors,
+			Kind:        archive.Kind(archiveInfo.Kind),
+			Trusted:     archiveInfo.Trusted,
+			Constraints: constraints,
+			Progress:    progress.report,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 		archives[archiveName] = openArchive
 	}
+	return archives, nil
+}
+
+// readInstalledManifest returns the manifest of the content already in
+// rootDir, or nil when there is none.
+func readInstalledManifest(rootDir string, release *setup.Release) (*manifest.Manifest, error) {
+	mfestPath, err := findManifest(rootDir, release)
+	if err != nil || mfestPath == "" {
+		return nil, err
+	}
+	logf("Adding slices to the content installed in %s according to %s", rootDir, mfestPath)
+	return readManifest(filepath.Join(rootDir, mfestPath))
+}
+
+// sourceDateEpoch returns the time set in SOURCE_DATE_EPOCH or, when unset,
+// the Unix epoch if reproducible is true and the zero time otherwise.
+func sourceDateEpoch(reproducible bool) (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		if reproducible {
+			return time.Unix(0, 0), nil
+		}
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH value: %q", value)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+const ociLayerMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+// ociLayerDescriptor describes an OCI image layer. DiffID is the digest of
+// the uncompressed layer, as listed in the rootfs of the image config.
+type ociLayerDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	DiffID    string `json:"diffID"`
+}
+
+// writeOutputTar writes the content of memFS as a tar archive at path, or
+// as a gzip compressed OCI layer whose descriptor is printed out.
+func writeOutputTar(path string, memFS *fsutil.MemFS, ociLayer bool) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create output archive: %w", err)
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("cannot write output archive: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	if !ociLayer {
+		err = memFS.WriteTar(file)
+		if err != nil {
+			return fmt.Errorf("cannot write output archive: %w", err)
+		}
+		return nil
+	}
+
+	layerHash := sha256.New()
+	layer := &countingWriter{w: io.MultiWriter(file, layerHash)}
+	gzipWriter := gzip.NewWriter(layer)
+	diffHash := sha256.New()
+	err = memFS.WriteTar(io.MultiWriter(gzipWriter, diffHash))
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write output archive: %w", err)
+	}
 
-	_, err = slicer.Run(&slicer.RunOptions{
-		Selection: selection,
-		Archives:  archives,
-		TargetDir: cmd.RootDir,
-	})
-	return err
+	data, err := json.MarshalIndent(&ociLayerDescriptor{
+		MediaType: ociLayerMediaType,
+		Digest:    fmt.Sprintf("sha256:%x", layerHash.Sum(nil)),
+		Size:      layer.n,
+		DiffID:    fmt.Sprintf("sha256:%x", diffHash.Sum(nil)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "%s\n", data)
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func printPlan(plan *slicer.Plan) {
+	w := tabWriter()
+	fmt.Fprintf(w, "Package\tVersion\tArch\tSize\tArchive\n")
+	for _, pkg := range plan.Packages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pkg.Info.Name, pkg.Info.Version, pkg.Info.Arch, formatSize(pkg.Info.Size), pkg.Archive)
+	}
+	w.Flush()
+
+	fmt.Fprintf(Stdout, "\n")
+	w = tabWriter()
+	fmt.Fprintf(w, "Slice\tPath\tKind\n")
+	for _, planSlice := range plan.Slices {
+		for _, path := range planSlice.Paths {
+			kind := string(path.Info.Kind)
+			if path.Info.Kind == setup.GlobPath {
+				kind += " (unresolved)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", planSlice.Slice, path.Path, kind)
+		}
+	}
+	w.Flush()
+}
+
+// formatSize returns a human readable representation of size, or "-"
+// when the size is unknown.
+func formatSize(size int64) string {
+	switch {
+	case size < 0:
+		return "-"
+	case size < 1<<10:
+		return fmt.Sprintf("%dB", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1fkB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	}
+}
+
+// progressThreshold is the size from which the download progress of a
+// package is reported.
+const progressThreshold = 1 << 20
+
+// fetchProgress logs the download progress of big packages in steps of 25%.
+type fetchProgress struct {
+	mu    sync.Mutex
+	steps map[string]int64
+}
+
+func (p *fetchProgress) report(pkg string, received, total int64) {
+	if total < progressThreshold {
+		return
+	}
+	step := received * 4 / total
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if step <= p.steps[pkg] {
+		return
+	}
+	p.steps[pkg] = step
+	logf("Fetching %s: %d%% of %.1fMB", pkg, step*25, float64(total)/(1<<20))
 }
@@ -0,0 +1,131 @@
+package main_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+type cutTest struct {
+	summary string
+	args    []string
+	err     string
+}
+
+var cutTests = []cutTest{{
+	summary: "Either root or output-tar is required",
+	args:    []string{"cut", "mypkg_myslice"},
+	err:     `either --root or --output-tar must be provided`,
+}, {
+	summary: "Root and output-tar cannot be used together",
+	args:    []string{"cut", "--root", "foo", "--output-tar", "foo.tar", "mypkg_myslice"},
+	err:     `cannot use --root and --output-tar together`,
+}, {
+	summary: "OCI layer requires output-tar",
+	args:    []string{"cut", "--root", "foo", "--oci-layer", "mypkg_myslice"},
+	err:     `cannot use --oci-layer without --output-tar`,
+}}
+
+func (s *ChiselSuite) TestCutErrors(c *C) {
+	for _, test := range cutTests {
+		c.Logf("Summary: %s", test.summary)
+		_, err := chisel.Parser().ParseArgs(test.args)
+		c.Assert(err, ErrorMatches, test.err)
+	}
+}
+
+func (s *ChiselSuite) TestCutInvalidSourceDateEpoch(c *C) {
+	old, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	defer func() {
+		if ok {
+			os.Setenv("SOURCE_DATE_EPOCH", old)
+		} else {
+			os.Unsetenv("SOURCE_DATE_EPOCH")
+		}
+	}()
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err := chisel.Parser().ParseArgs([]string{"cut", "--root", c.MkDir(), "mypkg_myslice"})
+	c.Assert(err, ErrorMatches, `invalid SOURCE_DATE_EPOCH value: "yesterday"`)
+}
+
+func (s *ChiselSuite) TestWriteOutputTar(c *C) {
+	memFS := fsutil.NewMemFS()
+	_, err := memFS.Create(&fsutil.CreateOptions{
+		Path:        "/dir/file",
+		Mode:        0644,
+		Data:        bytes.NewBufferString("data"),
+		MakeParents: true,
+	})
+	c.Assert(err, IsNil)
+	expected := map[string]string{
+		"/dir/":     "dir 0755",
+		"/dir/file": "file 0644 3a6eb079",
+	}
+
+	tarPath := filepath.Join(c.MkDir(), "output.tar")
+	err = chisel.WriteOutputTar(tarPath, memFS, false)
+	c.Assert(err, IsNil)
+	tarData, err := os.ReadFile(tarPath)
+	c.Assert(err, IsNil)
+	c.Assert(testutil.TarDump(bytes.NewReader(tarData)), DeepEquals, expected)
+	c.Assert(s.Stdout(), Equals, "")
+
+	layerPath := filepath.Join(c.MkDir(), "layer.tar.gz")
+	err = chisel.WriteOutputTar(layerPath, memFS, true)
+	c.Assert(err, IsNil)
+	layerData, err := os.ReadFile(layerPath)
+	c.Assert(err, IsNil)
+	gzipReader, err := gzip.NewReader(bytes.NewReader(layerData))
+	c.Assert(err, IsNil)
+	diffData, err := io.ReadAll(gzipReader)
+	c.Assert(err, IsNil)
+	c.Assert(diffData, DeepEquals, tarData)
+
+	var descriptor map[string]any
+	err = json.Unmarshal([]byte(s.Stdout()), &descriptor)
+	c.Assert(err, IsNil)
+	c.Assert(descriptor, DeepEquals, map[string]any{
+		"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+		"digest":    fmt.Sprintf("sha256:%x", sha256.Sum256(layerData)),
+		"size":      float64(len(layerData)),
+		"diffID":    fmt.Sprintf("sha256:%x", sha256.Sum256(tarData)),
+	})
+}
+
+func (s *ChiselSuite) TestWriteOutputTarError(c *C) {
+	tarPath := filepath.Join(c.MkDir(), "missing", "output.tar")
+	err := chisel.WriteOutputTar(tarPath, fsutil.NewMemFS(), false)
+	c.Assert(err, ErrorMatches, `cannot create output archive: .*`)
+}
+
+func (s *ChiselSuite) TestCutDryRun(c *C) {
+	releaseDir := writeDiffRelease(c, "1.0", `
+				myslice:
+					contents:
+						/dir/fil*:
+						/text: {text: data}
+	`)
+	rootDir := c.MkDir()
+
+	_, err := chisel.Parser().ParseArgs([]string{"cut", "--release", releaseDir, "--root", rootDir, "--dry-run", "mypkg_myslice"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Matches, ""+
+		"Package  Version  Arch  Size +Archive\n"+
+		"mypkg    1.0      all   .* +local\n"+
+		"\n"+
+		"Slice          Path       Kind\n"+
+		"mypkg_myslice  /dir/fil\\*  glob \\(unresolved\\)\n"+
+		"mypkg_myslice  /text      text\n")
+	c.Assert(testutil.TreeDump(rootDir), DeepEquals, map[string]string{})
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+)
+
+var shortDiffHelp = "Compare two manifests or releases"
+var longDiffHelp = `
+The diff command compares two manifests written by the cut command and
+reports the packages and slices added or removed, the package versions
+changed, and the paths added, removed or modified, with their size
+changes and the slices added to or removed from each of them.
+
+With --old-release and --new-release, the provided slices are selected
+from each of the releases instead, and what cutting them would install
+is compared without fetching any packages. Paths are then described by
+the slice contents, so only text and base64 paths have a size and content
+to compare.
+
+With --format json, the differences are printed as a JSON object.
+`
+
+var diffDescs = map[string]string{
+	"format":      "Output format (text or json)",
+	"old-release": "Chisel release name or directory to select the old slices from",
+	"new-release": "Chisel release name or directory to select the new slices from",
+	"arch":        "Package architecture, with --old-release and --new-release",
+}
+
+type cmdDiff struct {
+	Format     string `long:"format" value-name:"<format>" default:"text"`
+	OldRelease string `long:"old-release" value-name:"<dir>"`
+	NewRelease string `long:"new-release" value-name:"<dir>"`
+	Arch       string `long:"arch" value-name:"<arch>"`
+
+	Positional struct {
+		Args []string `positional-arg-name:"<old manifest> <new manifest> | <slice names>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("diff", shortDiffHelp, longDiffHelp, func() flags.Commander { return &cmdDiff{} }, diffDescs, nil)
+}
+
+func (cmd *cmdDiff) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if cmd.Format != "text" && cmd.Format != "json" {
+		return fmt.Errorf("invalid output format: %q", cmd.Format)
+	}
+
+	var oldManifest, newManifest *manifest.Manifest
+	var err error
+	if cmd.OldRelease == "" && cmd.NewRelease == "" {
+		if len(cmd.Positional.Args) != 2 {
+			return fmt.Errorf("expected the old and new manifests, or --old-release and --new-release with slice names")
+		}
+		if cmd.Arch != "" {
+			return fmt.Errorf("cannot use --arch without --old-release and --new-release")
+		}
+		oldManifest, err = readManifest(cmd.Positional.Args[0])
+		if err != nil {
+			return err
+		}
+		newManifest, err = readManifest(cmd.Positional.Args[1])
+		if err != nil {
+			return err
+		}
+	} else {
+		if cmd.OldRelease == "" || cmd.NewRelease == "" {
+			return fmt.Errorf("--old-release and --new-release must be used together")
+		}
+		sliceKeys := make([]setup.SliceKey, len(cmd.Positional.Args))
+		for i, sliceRef := range cmd.Positional.Args {
+			sliceKey, err := setup.ParseSliceKey(sliceRef)
+			if err != nil {
+				return err
+			}
+			sliceKeys[i] = sliceKey
+		}
+		oldManifest, err = planManifest(cmd.OldRelease, sliceKeys, cmd.Arch)
+		if err != nil {
+			return err
+		}
+		newManifest, err = planManifest(cmd.NewRelease, sliceKeys, cmd.Arch)
+		if err != nil {
+			return err
+		}
+	}
+	diff, err := manifest.Compare(oldManifest, newManifest)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Format == "json" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", data)
+		return nil
+	}
+	printDiff(diff)
+	return nil
+}
+
+// planManifest returns a manifest describing what cutting the slices from
+// the release would install, as resolved by a dry run.
+func planManifest(releaseStr string, sliceKeys []setup.SliceKey, arch string) (*manifest.Manifest, error) {
+	release, err := obtainRelease(releaseStr)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := setup.Select(release, sliceKeys)
+	if err != nil {
+		return nil, err
+	}
+	archives, err := openArchives(release, arch)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := slicer.DryRun(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  archives,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := &manifest.WriteOptions{}
+	for _, pkg := range plan.Packages {
+		options.Packages = append(options.Packages, &manifest.Package{
+			Name:    pkg.Info.Name,
+			Version: pkg.Info.Version,
+			Digest:  pkg.Info.SHA256,
+			Arch:    pkg.Info.Arch,
+		})
+	}
+	paths := make(map[string]*manifest.Path)
+	for _, planSlice := range plan.Slices {
+		options.Slices = append(options.Slices, planSlice.Slice)
+		for _, planPath := range planSlice.Paths {
+			path := paths[planPath.Path]
+			if path == nil {
+				path, err = planManifestPath(planPath)
+				if err != nil {
+					return nil, err
+				}
+				paths[planPath.Path] = path
+				options.Paths = append(options.Paths, path)
+			}
+			path.Slices = append(path.Slices, planSlice.Slice.String())
+		}
+	}
+	var buf bytes.Buffer
+	err = manifest.Write(&buf, options)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Read(&buf)
+}
+
+// planManifestPath returns the manifest entry of a path listed in slice
+// contents, with what is known about it before fetching any packages.
+func planManifestPath(planPath *slicer.PlanPath) (*manifest.Path, error) {
+	path := &manifest.Path{Path: planPath.Path}
+	if planPath.Info.Mode != 0 {
+		path.Mode = fmt.Sprintf("0%o", planPath.Info.Mode)
+	}
+	switch planPath.Info.Kind {
+	case setup.TextPath:
+		path.Hash = fmt.Sprintf("%x", sha256.Sum256([]byte(planPath.Info.Info)))
+		path.Size = uint64(len(planPath.Info.Info))
+	case setup.Base64Path:
+		data, err := base64.StdEncoding.DecodeString(planPath.Info.Info)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base64 content of %s: %w", planPath.Path, err)
+		}
+		path.Hash = fmt.Sprintf("%x", sha256.Sum256(data))
+		path.Size = uint64(len(data))
+	case setup.SymlinkPath:
+		path.Link = planPath.Info.Info
+	case setup.DevicePath:
+		path.Device = planPath.Info.Info
+		path.Major = planPath.Info.Major
+		path.Minor = planPath.Info.Minor
+	}
+	return path, nil
+}
+
+func printDiff(diff *manifest.Diff) {
+	separate := false
+	section := func() {
+		if separate {
+			fmt.Fprintf(Stdout, "\n")
+		}
+		separate = true
+	}
+
+	if len(diff.Packages) > 0 {
+		section()
+		w := tabWriter()
+		fmt.Fprintf(w, "Package\tChange\tVersion\n")
+		for _, pkg := range diff.Packages {
+			version := pkg.NewVersion
+			switch pkg.Kind {
+			case manifest.ChangeRemoved:
+				version = pkg.OldVersion
+			case manifest.ChangeModified:
+				version = pkg.OldVersion + " -> " + pkg.NewVersion
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", pkg.Name, pkg.Kind, version)
+		}
+		w.Flush()
+	}
+
+	if len(diff.Slices) > 0 {
+		section()
+		w := tabWriter()
+		fmt.Fprintf(w, "Slice\tChange\n")
+		for _, slice := range diff.Slices {
+			fmt.Fprintf(w, "%s\t%s\n", slice.Name, slice.Kind)
+		}
+		w.Flush()
+	}
+
+	if len(diff.Paths) > 0 {
+		section()
+		w := tabWriter()
+		fmt.Fprintf(w, "Path\tChange\tSize\tSlices\tDetail\n")
+		for _, path := range diff.Paths {
+			var sliceChanges []string
+			for _, sliceName := range path.AddedSlices {
+				sliceChanges = append(sliceChanges, "+"+sliceName)
+			}
+			for _, sliceName := range path.RemovedSlices {
+				sliceChanges = append(sliceChanges, "-"+sliceName)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", path.Path, path.Kind, formatSizeDelta(path.SizeDelta),
+				strings.Join(sliceChanges, " "), path.Detail)
+		}
+		w.Flush()
+	}
+}
+
+// formatSizeDelta returns a human readable representation of a change in
+// size, with its sign.
+func formatSizeDelta(delta int64) string {
+	switch {
+	case delta < 0:
+		return "-" + formatSize(-delta)
+	case delta > 0:
+		return "+" + formatSize(delta)
+	}
+	return "0B"
+}
@@ -0,0 +1,220 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+// writeDiffManifests writes two manifests for the diff command and returns
+// their paths.
+func writeDiffManifests(c *C) (oldPath, newPath string) {
+	oldPath = filepath.Join(c.MkDir(), "manifest.wall")
+	writeTestManifest(c, oldPath, &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "mypkg", Version: "1.0"}, {Name: "oldpkg", Version: "1.0"}},
+		Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}, {Package: "oldpkg", Name: "myslice"}},
+		Paths: []*manifest.Path{{
+			Path:   "/file",
+			Mode:   "0644",
+			Slices: []string{"mypkg_myslice"},
+			Hash:   "aaaa",
+			Size:   2048,
+		}, {
+			Path:   "/old",
+			Mode:   "0644",
+			Slices: []string{"oldpkg_myslice"},
+			Hash:   "bbbb",
+			Size:   3,
+		}},
+	})
+	newPath = filepath.Join(c.MkDir(), "manifest.wall")
+	writeTestManifest(c, newPath, &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "mypkg", Version: "1.1"}},
+		Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}, {Package: "mypkg", Name: "other"}},
+		Paths: []*manifest.Path{{
+			Path:   "/file",
+			Mode:   "0644",
+			Slices: []string{"mypkg_myslice", "mypkg_other"},
+			Hash:   "cccc",
+			Size:   1024,
+		}},
+	})
+	return oldPath, newPath
+}
+
+func (s *ChiselSuite) TestDiffCommand(c *C) {
+	oldPath, newPath := writeDiffManifests(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"diff", oldPath, newPath})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Package  Change    Version\n"+
+		"mypkg    modified  1.0 -> 1.1\n"+
+		"oldpkg   removed   1.0\n"+
+		"\n"+
+		"Slice           Change\n"+
+		"mypkg_other     added\n"+
+		"oldpkg_myslice  removed\n"+
+		"\n"+
+		"Path   Change    Size    Slices           Detail\n"+
+		"/file  modified  -1.0kB  +mypkg_other     content\n"+
+		"/old   removed   -3B     -oldpkg_myslice  \n")
+
+	s.ResetStdStreams()
+	_, err = chisel.Parser().ParseArgs([]string{"diff", "--format", "json", oldPath, newPath})
+	c.Assert(err, IsNil)
+	var diff manifest.Diff
+	err = json.Unmarshal([]byte(s.Stdout()), &diff)
+	c.Assert(err, IsNil)
+	c.Assert(diff.Packages, HasLen, 2)
+	c.Assert(diff.Slices, HasLen, 2)
+	c.Assert(diff.Paths, DeepEquals, []*manifest.PathChange{{
+		Path:        "/file",
+		Kind:        manifest.ChangeModified,
+		Detail:      "content",
+		SizeDelta:   -1024,
+		AddedSlices: []string{"mypkg_other"},
+	}, {
+		Path:          "/old",
+		Kind:          manifest.ChangeRemoved,
+		SizeDelta:     -3,
+		RemovedSlices: []string{"oldpkg_myslice"},
+	}})
+
+	s.ResetStdStreams()
+	_, err = chisel.Parser().ParseArgs([]string{"diff", oldPath, oldPath})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, "")
+}
+
+func (s *ChiselSuite) TestDiffCommandErrors(c *C) {
+	oldPath, newPath := writeDiffManifests(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"diff", "--format", "foo", oldPath, newPath})
+	c.Assert(err, ErrorMatches, `invalid output format: "foo"`)
+	_, err = chisel.Parser().ParseArgs([]string{"diff", oldPath, "/missing.wall"})
+	c.Assert(err, ErrorMatches, `cannot read manifest: open /missing.wall: no such file or directory`)
+}
+
+// writeDiffRelease writes a release with the mypkg slices provided, served
+// from a local archive holding the given version of mypkg, and returns its
+// directory.
+func writeDiffRelease(c *C, version, slices string) string {
+	archiveDir := c.MkDir()
+	control := fmt.Sprintf("Package: mypkg\nVersion: %s\nArchitecture: all\n", version)
+	data := testutil.MustMakeDebWithControl(control, []testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Dir(0755, "./dir/"),
+		testutil.Reg(0644, "./dir/file", version),
+	})
+	err := os.WriteFile(filepath.Join(archiveDir, "mypkg.deb"), data, 0644)
+	c.Assert(err, IsNil)
+
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					kind: flat
+					url: file://` + archiveDir + `
+		`,
+		"slices/mypkg.yaml": `
+			package: mypkg
+			slices:
+		` + slices,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	return releaseDir
+}
+
+func (s *ChiselSuite) TestDiffCommandReleases(c *C) {
+	oldRelease := writeDiffRelease(c, "1.0", `
+				myslice:
+					contents:
+						/dir/file:
+						/dir/text: {text: old}
+	`)
+	newRelease := writeDiffRelease(c, "1.1", `
+				myslice:
+					contents:
+						/dir/file:
+						/dir/text: {text: new}
+						/dir/link: {symlink: /dir/file}
+	`)
+
+	_, err := chisel.Parser().ParseArgs([]string{"diff", "--old-release", oldRelease, "--new-release", newRelease, "mypkg_myslice"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Package  Change    Version\n"+
+		"mypkg    modified  1.0 -> 1.1\n"+
+		"\n"+
+		"Path       Change    Size  Slices          Detail\n"+
+		"/dir/link  added     0B    +mypkg_myslice  \n"+
+		"/dir/text  modified  0B                    content\n")
+}
+
+func (s *ChiselSuite) TestDiffCommandReleasesBase64(c *C) {
+	oldRelease := writeDiffRelease(c, "1.0", `
+				myslice:
+					contents:
+						/dir/data: {base64: ZGF0YQ==}
+						/dir/same: {base64: c2FtZQ==}
+	`)
+	newRelease := writeDiffRelease(c, "1.0", `
+				myslice:
+					contents:
+						/dir/data: {base64: bW9yZSBkYXRh}
+						/dir/same: {base64: c2FtZQ==}
+	`)
+
+	_, err := chisel.Parser().ParseArgs([]string{"diff", "--old-release", oldRelease, "--new-release", newRelease, "mypkg_myslice"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Path       Change    Size  Slices  Detail\n"+
+		"/dir/data  modified  +5B           content\n")
+}
+
+var diffArgsTests = []struct {
+	summary string
+	args    []string
+	err     string
+}{{
+	summary: "Manifests are expected without releases",
+	args:    []string{"diff", "mypkg_myslice"},
+	err:     `expected the old and new manifests, or --old-release and --new-release with slice names`,
+}, {
+	summary: "Architecture requires releases",
+	args:    []string{"diff", "--arch", "amd64", "old.wall", "new.wall"},
+	err:     `cannot use --arch without --old-release and --new-release`,
+}, {
+	summary: "Both releases are required",
+	args:    []string{"diff", "--old-release", "ubuntu-22.04", "mypkg_myslice"},
+	err:     `--old-release and --new-release must be used together`,
+}, {
+	summary: "Invalid slice name",
+	args:    []string{"diff", "--old-release", "ubuntu-22.04", "--new-release", "ubuntu-24.04", "foo"},
+	err:     `invalid slice reference: "foo"`,
+}}
+
+func (s *ChiselSuite) TestDiffCommandArgs(c *C) {
+	for _, test := range diffArgsTests {
+		c.Logf("Summary: %s", test.summary)
+		_, err := chisel.Parser().ParseArgs(test.args)
+		c.Assert(err, ErrorMatches, test.err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+)
+
+var shortRemoveHelp = "Remove slices from a tree"
+var longRemoveHelp = `
+The remove command removes the provided slices from the tree in the root
+location, according to the manifest written into it by the cut command at
+one of the "generate: manifest" paths of the release.
+
+Only the paths that no remaining slice lists are deleted. The paths
+generated by the remaining slices, such as manifests, dpkg status files,
+ld.so caches and alternatives, are written again without the removed
+slices. Slices that a remaining slice requires cannot be removed.
+
+By default the slice definitions for the same Ubuntu version as the
+current host are used, unless the --release flag is used.
+`
+
+var removeDescs = map[string]string{
+	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":    "Root of the tree to remove slices from",
+}
+
+type cmdRemove struct {
+	Release string `long:"release" value-name:"<dir>"`
+	RootDir string `long:"root" value-name:"<dir>" required:"yes"`
+
+	Positional struct {
+		SliceRefs []string `positional-arg-name:"<slice names>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} }, removeDescs, nil)
+}
+
+func (cmd *cmdRemove) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	sliceKeys := make([]setup.SliceKey, len(cmd.Positional.SliceRefs))
+	for i, sliceRef := range cmd.Positional.SliceRefs {
+		sliceKey, err := setup.ParseSliceKey(sliceRef)
+		if err != nil {
+			return err
+		}
+		sliceKeys[i] = sliceKey
+	}
+
+	release, err := obtainRelease(cmd.Release)
+	if err != nil {
+		return err
+	}
+
+	mfestPath, err := findManifest(cmd.RootDir, release)
+	if err != nil {
+		return err
+	}
+	if mfestPath == "" {
+		return fmt.Errorf("cannot find manifest in %s", cmd.RootDir)
+	}
+	mfest, err := readManifest(filepath.Join(cmd.RootDir, mfestPath))
+	if err != nil {
+		return err
+	}
+
+	logf("Removing slices from the content installed in %s according to %s", cmd.RootDir, mfestPath)
+	return slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices:    sliceKeys,
+		TargetDir: cmd.RootDir,
+	})
+}
@@ -0,0 +1,127 @@
+package main_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var removeRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mypkg.yaml": `
+		package: mypkg
+		slices:
+			base:
+				contents:
+					/file:
+					/db/**: {generate: manifest}
+			extra:
+				essential:
+					- mypkg_base
+				contents:
+					/file:
+					/extra:
+	`,
+}
+
+// writeRemoveRoot writes a release and a tree cut from it with the base and
+// extra slices of mypkg.
+func writeRemoveRoot(c *C) (releaseDir, rootDir string) {
+	releaseDir = c.MkDir()
+	for path, data := range removeRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	slices := release.Packages["mypkg"].Slices
+
+	rootDir = c.MkDir()
+	var paths []*manifest.Path
+	for _, name := range []string{"file", "extra"} {
+		err := os.WriteFile(filepath.Join(rootDir, name), []byte(name), 0644)
+		c.Assert(err, IsNil)
+		paths = append(paths, &manifest.Path{
+			Path:   "/" + name,
+			Mode:   "0644",
+			Slices: []string{"mypkg_extra"},
+			Hash:   fmt.Sprintf("%x", sha256.Sum256([]byte(name))),
+			Size:   uint64(len(name)),
+		})
+	}
+	paths[0].Slices = []string{"mypkg_base", "mypkg_extra"}
+	paths = append(paths, &manifest.Path{
+		Path:   "/db/manifest.wall",
+		Mode:   "0644",
+		Slices: []string{"mypkg_base"},
+	})
+	writeTestManifest(c, filepath.Join(rootDir, "db/manifest.wall"), &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "mypkg", Version: "1.0"}},
+		Slices:   []*setup.Slice{slices["base"], slices["extra"]},
+		Paths:    paths,
+	})
+	return releaseDir, rootDir
+}
+
+func (s *ChiselSuite) TestRemoveCommand(c *C) {
+	releaseDir, rootDir := writeRemoveRoot(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"remove", "--release", releaseDir, "--root", rootDir, "mypkg_extra"})
+	c.Assert(err, IsNil)
+
+	c.Assert(testutil.TreeDump(rootDir), HasLen, 3)
+	_, err = os.Stat(filepath.Join(rootDir, "extra"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// The rewritten manifest describes the remaining tree.
+	_, err = chisel.Parser().ParseArgs([]string{"verify", "--root", rootDir, "--manifest", "/db/manifest.wall"})
+	c.Assert(err, IsNil)
+	_, err = chisel.Parser().ParseArgs([]string{"remove", "--release", releaseDir, "--root", rootDir, "mypkg_extra"})
+	c.Assert(err, ErrorMatches, `slice mypkg_extra is not installed`)
+}
+
+var removeErrorTests = []struct {
+	summary string
+	args    []string
+	err     string
+}{{
+	summary: "Invalid slice name",
+	args:    []string{"foo"},
+	err:     `invalid slice reference: "foo"`,
+}, {
+	summary: "Slice required by a remaining slice",
+	args:    []string{"mypkg_base"},
+	err:     `cannot remove slice mypkg_base: slice mypkg_extra requires it`,
+}}
+
+func (s *ChiselSuite) TestRemoveCommandErrors(c *C) {
+	releaseDir, rootDir := writeRemoveRoot(c)
+	for _, test := range removeErrorTests {
+		c.Logf("Summary: %s", test.summary)
+		args := append([]string{"remove", "--release", releaseDir, "--root", rootDir}, test.args...)
+		_, err := chisel.Parser().ParseArgs(args)
+		c.Assert(err, ErrorMatches, test.err)
+	}
+
+	_, err := chisel.Parser().ParseArgs([]string{"remove", "--release", releaseDir, "--root", c.MkDir(), "mypkg_extra"})
+	c.Assert(err, ErrorMatches, `cannot find manifest in .*`)
+
+	// Only the manifest paths generated by the release slices are used.
+	err = os.MkdirAll(filepath.Join(rootDir, "other"), 0755)
+	c.Assert(err, IsNil)
+	err = os.Rename(filepath.Join(rootDir, "db/manifest.wall"), filepath.Join(rootDir, "other/manifest.wall"))
+	c.Assert(err, IsNil)
+	_, err = chisel.Parser().ParseArgs([]string{"remove", "--release", releaseDir, "--root", rootDir, "mypkg_extra"})
+	c.Assert(err, ErrorMatches, `cannot find manifest in .*`)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/cmd"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/sbom"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var shortSBOMHelp = "Write an SBOM describing a cut"
+var longSBOMHelp = `
+The sbom command reads a manifest written by the cut command and writes
+a software bill of materials describing the packages, the slices cut
+from each of them, and the files each slice installed along with their
+sha256 hashes.
+
+The SBOM is written in the SPDX 2.3 JSON format by default, or in the
+CycloneDX 1.5 JSON format with --format cyclonedx. Its creation time is
+taken from SOURCE_DATE_EPOCH when set.
+
+SPDX also requires the sha1 hash of every file, so the files are read
+from the root location, which is inferred from the manifest path unless
+the --root option is provided.
+
+Packages are identified by package URLs when the --release option is
+provided and its archives are all from the same distribution, such as
+Ubuntu or Debian, as manifests do not record where packages come from.
+`
+
+var sbomDescs = map[string]string{
+	"format":  "SBOM format (spdx or cyclonedx)",
+	"name":    "Name of the described content (defaults to the manifest path)",
+	"output":  "Write the SBOM to file instead of the standard output",
+	"root":    "Root of the tree described by the manifest",
+	"release": "Chisel release name or directory the tree was cut from",
+}
+
+type cmdSBOM struct {
+	Format  string `long:"format" value-name:"<format>" default:"spdx"`
+	Name    string `long:"name" value-name:"<name>"`
+	Output  string `long:"output" value-name:"<file>"`
+	RootDir string `long:"root" value-name:"<dir>"`
+	Release string `long:"release" value-name:"<dir>"`
+
+	Positional struct {
+		Manifest string `positional-arg-name:"<manifest>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("sbom", shortSBOMHelp, longSBOMHelp, func() flags.Commander { return &cmdSBOM{} }, sbomDescs, nil)
+}
+
+func (c *cmdSBOM) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	format := sbom.Format(c.Format)
+	if format != sbom.SPDX && format != sbom.CycloneDX {
+		return fmt.Errorf("invalid SBOM format: %q", c.Format)
+	}
+	created, err := sourceDateEpoch(false)
+	if err != nil {
+		return err
+	}
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	mfest, err := readManifest(c.Positional.Manifest)
+	if err != nil {
+		return err
+	}
+	content, err := sbom.ManifestContent(mfest)
+	if err != nil {
+		return err
+	}
+	rootDir := c.RootDir
+	if rootDir == "" && format == sbom.SPDX {
+		rootDir, err = manifestRoot(content, c.Positional.Manifest)
+		if err != nil {
+			return err
+		}
+	}
+	var distro string
+	if c.Release != "" {
+		release, err := obtainRelease(c.Release)
+		if err != nil {
+			return err
+		}
+		distro = releaseDistro(release)
+	}
+	name := c.Name
+	if name == "" {
+		name = c.Positional.Manifest
+	}
+	options := &sbom.Options{
+		Format:      format,
+		Name:        name,
+		Created:     created,
+		ToolVersion: cmd.Version,
+		Content:     content,
+		RootDir:     rootDir,
+		Distro:      distro,
+	}
+	if c.Output == "" {
+		return sbom.Write(Stdout, options)
+	}
+	return writeSBOM(c.Output, options)
+}
+
+// manifestRoot returns the root of the tree holding the manifest at
+// mfestPath, which is listed in the manifest itself as the path of the
+// "generate: manifest" content.
+func manifestRoot(content *manifest.WriteOptions, mfestPath string) (string, error) {
+	absPath, err := filepath.Abs(mfestPath)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range content.Paths {
+		if filepath.Base(path.Path) != manifest.Filename || !strings.HasSuffix(absPath, path.Path) {
+			continue
+		}
+		rootDir := strings.TrimSuffix(absPath, path.Path)
+		if rootDir == "" {
+			rootDir = "/"
+		}
+		return rootDir, nil
+	}
+	return "", fmt.Errorf("cannot find root of %s, see the --root option", mfestPath)
+}
+
+// releaseDistro returns the distribution all the archives of release come
+// from, or an empty string when they differ or include flat archives,
+// which do not tell.
+func releaseDistro(release *setup.Release) string {
+	var distro setup.ArchiveKind
+	for _, archive := range release.Archives {
+		kind := archive.Kind
+		if kind == "" {
+			kind = setup.UbuntuArchive
+		}
+		if kind == setup.FlatArchive || distro != "" && distro != kind {
+			return ""
+		}
+		distro = kind
+	}
+	return string(distro)
+}
+
+// writeSBOM writes the SBOM described by options into a file at path.
+func writeSBOM(path string, options *sbom.Options) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create SBOM: %w", err)
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("cannot write SBOM: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	return sbom.Write(file, options)
+}
@@ -0,0 +1,211 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+// writeTestManifest writes a zstd compressed manifest at path, as the cut
+// command does.
+func writeTestManifest(c *C, path string, options *manifest.WriteOptions) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, IsNil)
+	file, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	w, err := zstd.NewWriter(file)
+	c.Assert(err, IsNil)
+	err = manifest.Write(w, options)
+	c.Assert(err, IsNil)
+	err = w.Close()
+	c.Assert(err, IsNil)
+}
+
+var sbomManifest = &manifest.WriteOptions{
+	Packages: []*manifest.Package{{
+		Name:    "mypkg",
+		Version: "1.0",
+		Digest:  "digest",
+		Arch:    "amd64",
+	}},
+	Slices: []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+	Paths: []*manifest.Path{{
+		Path:   "/db/manifest.wall",
+		Mode:   "0644",
+		Slices: []string{"mypkg_myslice"},
+	}, {
+		Path:   "/file",
+		Mode:   "0644",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+		Size:   4,
+	}},
+}
+
+// makeSBOMRoot writes the tree described by sbomManifest and returns the
+// path of its manifest.
+func makeSBOMRoot(c *C) (rootDir, mfestPath string) {
+	rootDir = c.MkDir()
+	err := os.WriteFile(filepath.Join(rootDir, "file"), []byte("data"), 0644)
+	c.Assert(err, IsNil)
+	mfestPath = filepath.Join(rootDir, "db/manifest.wall")
+	writeTestManifest(c, mfestPath, sbomManifest)
+	return rootDir, mfestPath
+}
+
+type sbomTest struct {
+	summary string
+	args    []string
+	err     string
+}
+
+var sbomTests = []sbomTest{{
+	summary: "Invalid format",
+	args:    []string{"sbom", "--format", "foo", "manifest.wall"},
+	err:     `invalid SBOM format: "foo"`,
+}, {
+	summary: "Missing manifest",
+	args:    []string{"sbom", "missing.wall"},
+	err:     `cannot read manifest: open missing.wall: no such file or directory`,
+}}
+
+func (s *ChiselSuite) TestSBOMErrors(c *C) {
+	for _, test := range sbomTests {
+		c.Logf("Summary: %s", test.summary)
+		_, err := chisel.Parser().ParseArgs(test.args)
+		c.Assert(err, ErrorMatches, test.err)
+	}
+}
+
+func (s *ChiselSuite) TestSBOMCommand(c *C) {
+	s.AddCleanup(setEnv("SOURCE_DATE_EPOCH", "86400"))
+	_, mfestPath := makeSBOMRoot(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"sbom", "--name", "myimage", mfestPath})
+	c.Assert(err, IsNil)
+	var spdx struct {
+		SPDXVersion  string `json:"spdxVersion"`
+		Name         string `json:"name"`
+		CreationInfo struct {
+			Created string `json:"created"`
+		} `json:"creationInfo"`
+		Packages []struct {
+			Name string `json:"name"`
+		} `json:"packages"`
+		Files []struct {
+			FileName  string `json:"fileName"`
+			Checksums []struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"checksumValue"`
+			} `json:"checksums"`
+		} `json:"files"`
+	}
+	err = json.Unmarshal([]byte(s.Stdout()), &spdx)
+	c.Assert(err, IsNil)
+	c.Assert(spdx.SPDXVersion, Equals, "SPDX-2.3")
+	c.Assert(spdx.Name, Equals, "myimage")
+	c.Assert(spdx.CreationInfo.Created, Equals, "1970-01-02T00:00:00Z")
+	c.Assert(spdx.Packages, HasLen, 2)
+	c.Assert(spdx.Packages[0].Name, Equals, "mypkg")
+	c.Assert(spdx.Packages[1].Name, Equals, "mypkg_myslice")
+	c.Assert(spdx.Files, HasLen, 1)
+	c.Assert(spdx.Files[0].FileName, Equals, "/file")
+	c.Assert(spdx.Files[0].Checksums[0].Algorithm, Equals, "SHA1")
+	c.Assert(spdx.Files[0].Checksums[0].Value, Equals, "a17c9aaa61e80a1bf71d0d850af4e5baa9800bbd")
+
+	s.ResetStdStreams()
+	outputPath := filepath.Join(c.MkDir(), "sbom.json")
+	_, err = chisel.Parser().ParseArgs([]string{"sbom", "--format", "cyclonedx", "--output", outputPath, mfestPath})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, "")
+	data, err := os.ReadFile(outputPath)
+	c.Assert(err, IsNil)
+	var cdx struct {
+		BOMFormat string `json:"bomFormat"`
+		Metadata  struct {
+			Component struct {
+				Name string `json:"name"`
+			} `json:"component"`
+		} `json:"metadata"`
+	}
+	err = json.Unmarshal(data, &cdx)
+	c.Assert(err, IsNil)
+	c.Assert(cdx.BOMFormat, Equals, "CycloneDX")
+	c.Assert(cdx.Metadata.Component.Name, Equals, mfestPath)
+}
+
+func setEnv(name, value string) (restore func()) {
+	old, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func (s *ChiselSuite) TestSBOMRoot(c *C) {
+	rootDir, mfestPath := makeSBOMRoot(c)
+
+	// The root is found from the manifest path, or provided explicitly
+	// when the manifest was moved elsewhere.
+	movedPath := filepath.Join(c.MkDir(), "manifest.wall")
+	err := os.Rename(mfestPath, movedPath)
+	c.Assert(err, IsNil)
+	_, err = chisel.Parser().ParseArgs([]string{"sbom", movedPath})
+	c.Assert(err, ErrorMatches, `cannot find root of .*/manifest.wall, see the --root option`)
+	_, err = chisel.Parser().ParseArgs([]string{"sbom", "--root", rootDir, movedPath})
+	c.Assert(err, IsNil)
+
+	// CycloneDX does not need the files.
+	_, err = chisel.Parser().ParseArgs([]string{"sbom", "--format", "cyclonedx", movedPath})
+	c.Assert(err, IsNil)
+}
+
+func (s *ChiselSuite) TestSBOMRelease(c *C) {
+	_, mfestPath := makeSBOMRoot(c)
+	releaseDir := c.MkDir()
+	for path, data := range map[string]string{
+		"chisel.yaml":       defaultChiselYaml,
+		"slices/mypkg.yaml": "package: mypkg\n",
+	} {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	flatReleaseDir := writeDiffRelease(c, "1.0", "")
+
+	purl := func(args ...string) string {
+		s.ResetStdStreams()
+		args = append([]string{"sbom", "--format", "cyclonedx"}, args...)
+		_, err := chisel.Parser().ParseArgs(append(args, mfestPath))
+		c.Assert(err, IsNil)
+		var cdx struct {
+			Components []struct {
+				PURL string `json:"purl"`
+			} `json:"components"`
+		}
+		err = json.Unmarshal([]byte(s.Stdout()), &cdx)
+		c.Assert(err, IsNil)
+		c.Assert(cdx.Components, HasLen, 1)
+		return cdx.Components[0].PURL
+	}
+
+	// Package URLs need the distribution of the release archives.
+	c.Assert(purl(), Equals, "")
+	c.Assert(purl("--release", releaseDir), Equals, "pkg:deb/ubuntu/mypkg@1.0?arch=amd64")
+	c.Assert(purl("--release", flatReleaseDir), Equals, "")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/manifest"
+)
+
+var shortVerifyHelp = "Verify a tree against its manifest"
+var longVerifyHelp = `
+The verify command compares the tree in the root location with the
+manifest written into it by the cut command, and reports the paths that
+are missing, modified or unexpected. Paths are compared by type, mode,
+link, size and sha256 hash, taking into account changes made by mutation
+scripts. Ownership and extended attributes, such as file capabilities,
+are not recorded in manifests and so they are not verified. Character and
+block devices are only created by cuts running as root, so they are not
+reported as missing otherwise.
+
+The --manifest option provides the path of the manifest inside the root
+location, as set by a "generate: manifest" path. With --format json, the
+problems found are printed as a JSON list.
+
+The command fails when any problem is found.
+`
+
+var verifyDescs = map[string]string{
+	"root":     "Root of the tree to verify",
+	"manifest": "Manifest path, relative to the root",
+	"format":   "Output format (text or json)",
+}
+
+type cmdVerify struct {
+	RootDir  string `long:"root" value-name:"<dir>" required:"yes"`
+	Manifest string `long:"manifest" value-name:"<path>" required:"yes"`
+	Format   string `long:"format" value-name:"<format>" default:"text"`
+}
+
+func init() {
+	addCommand("verify", shortVerifyHelp, longVerifyHelp, func() flags.Commander { return &cmdVerify{} }, verifyDescs, nil)
+}
+
+func (cmd *cmdVerify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if cmd.Format != "text" && cmd.Format != "json" {
+		return fmt.Errorf("invalid output format: %q", cmd.Format)
+	}
+
+	mfestPath := cmd.Manifest
+	mfest, err := readManifest(filepath.Join(cmd.RootDir, mfestPath))
+	if err != nil {
+		return err
+	}
+	problems, err := manifest.Verify(mfest, cmd.RootDir)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Format == "json" {
+		if problems == nil {
+			problems = []*manifest.Problem{}
+		}
+		data, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", data)
+	} else if len(problems) > 0 {
+		w := tabWriter()
+		fmt.Fprintf(w, "Path\tProblem\tDetail\n")
+		for _, problem := range problems {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", problem.Path, problem.Kind, problem.Detail)
+		}
+		w.Flush()
+	}
+
+	if len(problems) == 1 {
+		return fmt.Errorf("tree does not match manifest %s: 1 problem found", mfestPath)
+	} else if len(problems) > 0 {
+		return fmt.Errorf("tree does not match manifest %s: %d problems found", mfestPath, len(problems))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+// writeVerifyRoot writes a tree with a single file described by a manifest
+// at /db/manifest.wall.
+func writeVerifyRoot(c *C) string {
+	rootDir := c.MkDir()
+	err := os.WriteFile(filepath.Join(rootDir, "file"), []byte("data"), 0644)
+	c.Assert(err, IsNil)
+	writeTestManifest(c, filepath.Join(rootDir, "db/manifest.wall"), &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "mypkg"}},
+		Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+		Paths: []*manifest.Path{{
+			Path:   "/file",
+			Mode:   "0644",
+			Slices: []string{"mypkg_myslice"},
+			Hash:   fmt.Sprintf("%x", sha256.Sum256([]byte("data"))),
+			Size:   4,
+		}, {
+			Path:   "/db/manifest.wall",
+			Mode:   "0644",
+			Slices: []string{"mypkg_myslice"},
+		}},
+	})
+	return rootDir
+}
+
+func (s *ChiselSuite) TestVerifyCommand(c *C) {
+	rootDir := writeVerifyRoot(c)
+	_, err := chisel.Parser().ParseArgs([]string{"verify", "--root", rootDir, "--manifest", "/db/manifest.wall"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, "")
+
+	err = os.Chmod(filepath.Join(rootDir, "file"), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(rootDir, "extra"), nil, 0644)
+	c.Assert(err, IsNil)
+
+	_, err = chisel.Parser().ParseArgs([]string{"verify", "--root", rootDir, "--manifest", "/db/manifest.wall"})
+	c.Assert(err, ErrorMatches, `tree does not match manifest /db/manifest.wall: 2 problems found`)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Path    Problem   Detail\n"+
+		"/extra  extra     \n"+
+		"/file   modified  expected mode 0644, found 0755\n")
+
+	s.ResetStdStreams()
+	_, err = chisel.Parser().ParseArgs([]string{"verify", "--root", rootDir, "--manifest", "/db/manifest.wall", "--format", "json"})
+	c.Assert(err, ErrorMatches, `tree does not match manifest /db/manifest.wall: 2 problems found`)
+	var problems []map[string]string
+	err = json.Unmarshal([]byte(s.Stdout()), &problems)
+	c.Assert(err, IsNil)
+	c.Assert(problems, DeepEquals, []map[string]string{
+		{"path": "/extra", "kind": "extra"},
+		{"path": "/file", "kind": "modified", "detail": "expected mode 0644, found 0755"},
+	})
+}
+
+func (s *ChiselSuite) TestVerifyCommandRelativeRoot(c *C) {
+	rootDir := writeVerifyRoot(c)
+	err := os.WriteFile(filepath.Join(rootDir, "extra"), nil, 0644)
+	c.Assert(err, IsNil)
+
+	oldDir, err := os.Getwd()
+	c.Assert(err, IsNil)
+	defer os.Chdir(oldDir)
+	err = os.Chdir(filepath.Dir(rootDir))
+	c.Assert(err, IsNil)
+
+	for _, relRoot := range []string{"./" + filepath.Base(rootDir), filepath.Base(rootDir) + "/"} {
+		s.ResetStdStreams()
+		_, err = chisel.Parser().ParseArgs([]string{"verify", "--root", relRoot, "--manifest", "/db/manifest.wall"})
+		c.Assert(err, ErrorMatches, `tree does not match manifest /db/manifest.wall: 1 problem found`)
+		c.Assert(s.Stdout(), Equals, ""+
+			"Path    Problem  Detail\n"+
+			"/extra  extra    \n")
+	}
+}
+
+func (s *ChiselSuite) TestVerifyCommandJSONNoProblems(c *C) {
+	rootDir := writeVerifyRoot(c)
+	_, err := chisel.Parser().ParseArgs([]string{"verify", "--root", rootDir, "--manifest", "/db/manifest.wall", "--format", "json"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, "[]\n")
+}
+
+var verifyErrorTests = []struct {
+	summary string
+	args    []string
+	err     string
+}{{
+	summary: "Invalid format",
+	args:    []string{"--manifest", "/db/manifest.wall", "--format", "foo"},
+	err:     `invalid output format: "foo"`,
+}, {
+	summary: "Manifest not found",
+	args:    []string{"--manifest", "/missing.wall"},
+	err:     `cannot read manifest: open .*/missing.wall: no such file or directory`,
+}}
+
+func (s *ChiselSuite) TestVerifyCommandErrors(c *C) {
+	for _, test := range verifyErrorTests {
+		c.Logf("Summary: %s", test.summary)
+		args := append([]string{"verify", "--root", c.MkDir()}, test.args...)
+		_, err := chisel.Parser().ParseArgs(args)
+		c.Assert(err, ErrorMatches, test.err)
+	}
+
+	_, err := chisel.Parser().ParseArgs([]string{"verify", "--root", c.MkDir()})
+	c.Assert(err, ErrorMatches, `the required flag .--manifest. was not specified`)
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/canonical/chisel/internal/manifest"
 	"github.com/canonical/chisel/internal/setup"
 )
 
@@ -69,3 +77,54 @@ func obtainRelease(releaseStr string) (release *setup.Release, err error) {
 	}
 	return release, nil
 }
+
+// readManifest reads the zstd compressed manifest at path, as written
+// for "generate: manifest" paths.
+func readManifest(path string) (*manifest.Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	defer file.Close()
+	reader, err := zstd.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	defer reader.Close()
+	mfest, err := manifest.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+	err = manifest.Validate(mfest)
+	if err != nil {
+		return nil, err
+	}
+	return mfest, nil
+}
+
+// findManifest returns the path, relative to rootDir, of the manifest
+// written into it by the "generate: manifest" paths of the release slices,
+// or an empty string when there is none.
+func findManifest(rootDir string, release *setup.Release) (string, error) {
+	var mfestPaths []string
+	for _, pkg := range release.Packages {
+		for _, slice := range pkg.Slices {
+			for relPath, pathInfo := range slice.Contents {
+				if pathInfo.Generate == setup.GenerateManifest {
+					mfestPaths = append(mfestPaths, strings.TrimSuffix(relPath, "**")+manifest.Filename)
+				}
+			}
+		}
+	}
+	sort.Strings(mfestPaths)
+	for _, mfestPath := range mfestPaths {
+		info, err := os.Stat(filepath.Join(rootDir, mfestPath))
+		if err == nil && info.Mode().IsRegular() {
+			return mfestPath, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+			return "", fmt.Errorf("cannot find manifest: %w", err)
+		}
+	}
+	return "", nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,43 @@ type Archive interface {
 	Options() *Options
 	Fetch(pkg string) (io.ReadCloser, error)
 	Exists(pkg string) bool
+	Info(pkg string) (*PackageInfo, error)
+}
+
+// PackageInfo holds the details of the package version that Fetch would
+// obtain, as listed in the archive index.
+type PackageInfo struct {
+	Name    string
+	Version string
+	Arch    string
+	SHA256  string
+	// Size is the size of the package file in bytes, or -1 if unknown.
+	Size int64
+	// Source is the source package the package was built from, possibly
+	// followed by its version in parentheses. It is empty when the source
+	// package has the same name and version.
+	Source string
+	// Depends and PreDepends hold the dependency fields of the package, as
+	// listed in the archive index.
+	Depends    string
+	PreDepends string
+}
+
+func packageInfo(section control.Section) *PackageInfo {
+	size, err := strconv.ParseInt(section.Get("Size"), 10, 64)
+	if err != nil {
+		size = -1
+	}
+	return &PackageInfo{
+		Name:       section.Get("Package"),
+		Version:    section.Get("Version"),
+		Arch:       section.Get("Architecture"),
+		SHA256:     section.Get("SHA256"),
+		Size:       size,
+		Source:     section.Get("Source"),
+		Depends:    section.Get("Depends"),
+		PreDepends: section.Get("Pre-Depends"),
+	}
 }
 
 type Options struct {
@@ -30,8 +68,43 @@ type Options struct {
 	Components []string
 	CacheDir   string
 	PubKeys    []*packet.PublicKey
+	// URL is the base location of the archive. When empty, the
+	// default Ubuntu archive for Arch or the default Debian archive
+	// is used, depending on Kind. A file:// URL refers to a local
+	// directory of packages.
+	URL string
+	// Mirrors are alternative base locations tried in order when
+	// fetching from URL fails.
+	Mirrors []string
+	// Kind selects the layout of the archive. When empty, UbuntuKind
+	// is assumed.
+	Kind Kind
+	// Trusted disables the signature verification, in which case the
+	// unsigned Release file is used instead of InRelease.
+	Trusted bool
+	// Constraints restricts the versions that may be selected for
+	// the packages they are keyed by.
+	Constraints map[string]*deb.VersionConstraint
+	// Progress is called while a package is downloaded with the amount
+	// of data received so far and the total size, or -1 when unknown.
+	// It may be called concurrently for different packages.
+	Progress func(pkg string, received, total int64)
 }
 
+type Kind string
+
+const (
+	// UbuntuKind is an Ubuntu archive with the release details in an
+	// Ubuntu or UbuntuProFIPS section.
+	UbuntuKind Kind = "ubuntu"
+	// DebianKind is a Debian-style archive with suites and components
+	// under dists/, with any Origin or Label in its release file.
+	DebianKind Kind = "debian"
+	// FlatKind is a flat repository holding the release file and the
+	// package index directly under its URL, as in "deb url ./".
+	FlatKind Kind = "flat"
+)
+
 func Open(options *Options) (Archive, error) {
 	var err error
 	if options.Arch == "" {
@@ -42,6 +115,16 @@ func Open(options *Options) (Archive, error) {
 	if err != nil {
 		return nil, err
 	}
+	if isLocalURL(options.URL) {
+		return openLocal(options)
+	}
+	switch options.Kind {
+	case "":
+		options.Kind = UbuntuKind
+	case UbuntuKind, DebianKind, FlatKind:
+	default:
+		return nil, fmt.Errorf("invalid archive kind: %q", options.Kind)
+	}
 	return openUbuntu(options)
 }
 
@@ -69,6 +152,13 @@ type ubuntuArchive struct {
 	indexes []*ubuntuIndex
 	cache   *cache.Cache
 	pubKeys []*packet.PublicKey
+	// urls holds the base location of the archive followed by its mirrors.
+	urls []*archiveURL
+}
+
+type archiveURL struct {
+	base  string
+	creds *credentials
 }
 
 type ubuntuIndex struct {
@@ -95,10 +185,14 @@ func (a *ubuntuArchive) selectPackage(pkg string) (control.Section, *ubuntuIndex
 	var selectedVersion string
 	var selectedSection control.Section
 	var selectedIndex *ubuntuIndex
+	constraint := a.options.Constraints[pkg]
 	for _, index := range a.indexes {
 		section := index.packages.Section(pkg)
 		if section != nil && section.Get("Filename") != "" {
 			version := section.Get("Version")
+			if constraint != nil && !constraint.Match(version) {
+				continue
+			}
 			if selectedVersion == "" || deb.CompareVersions(selectedVersion, version) < 0 {
 				selectedVersion = version
 				selectedSection = section
@@ -107,11 +201,19 @@ func (a *ubuntuArchive) selectPackage(pkg string) (control.Section, *ubuntuIndex
 		}
 	}
 	if selectedVersion == "" {
-		return nil, nil, fmt.Errorf("cannot find package %q in archive", pkg)
+		return nil, nil, missingPackageError(pkg, constraint)
 	}
 	return selectedSection, selectedIndex, nil
 }
 
+func (a *ubuntuArchive) Info(pkg string) (*PackageInfo, error) {
+	section, _, err := a.selectPackage(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return packageInfo(section), nil
+}
+
 func (a *ubuntuArchive) Fetch(pkg string) (io.ReadCloser, error) {
 	section, index, err := a.selectPackage(pkg)
 	if err != nil {
@@ -119,25 +221,49 @@ func (a *ubuntuArchive) Fetch(pkg string) (io.ReadCloser, error) {
 	}
 	suffix := section.Get("Filename")
 	logf("Fetching %s...", suffix)
-	reader, err := index.fetch("../../"+suffix, section.Get("SHA256"), fetchBulk)
+	if a.options.Kind != FlatKind {
+		// Package files are relative to the archive root, not to the suite.
+		suffix = "../../" + suffix
+	}
+	var progress progressFunc
+	if a.options.Progress != nil {
+		progress = func(received, total int64) {
+			a.options.Progress(pkg, received, total)
+		}
+	}
+	reader, err := index.fetch(suffix, section.Get("SHA256"), fetchBulk, progress)
 	if err != nil {
 		return nil, err
 	}
 	return reader, nil
 }
 
+func missingPackageError(pkg string, constraint *deb.VersionConstraint) error {
+	if constraint != nil {
+		return fmt.Errorf("cannot find package %q with version %s in archive", pkg, constraint)
+	}
+	return fmt.Errorf("cannot find package %q in archive", pkg)
+}
+
 const ubuntuURL = "http://archive.ubuntu.com/ubuntu/"
 const ubuntuPortsURL = "http://ports.ubuntu.com/ubuntu-ports/"
+const debianURL = "http://deb.debian.org/debian/"
 
 func openUbuntu(options *Options) (Archive, error) {
-	if len(options.Components) == 0 {
-		return nil, fmt.Errorf("archive options missing components")
-	}
-	if len(options.Suites) == 0 {
-		return nil, fmt.Errorf("archive options missing suites")
-	}
-	if len(options.Version) == 0 {
-		return nil, fmt.Errorf("archive options missing version")
+	if options.Kind == FlatKind {
+		if options.URL == "" {
+			return nil, fmt.Errorf("archive options missing url")
+		}
+	} else {
+		if len(options.Components) == 0 {
+			return nil, fmt.Errorf("archive options missing components")
+		}
+		if len(options.Suites) == 0 {
+			return nil, fmt.Errorf("archive options missing suites")
+		}
+		if len(options.Version) == 0 {
+			return nil, fmt.Errorf("archive options missing version")
+		}
 	}
 
 	archive := &ubuntuArchive{
@@ -148,6 +274,52 @@ func openUbuntu(options *Options) (Archive, error) {
 		pubKeys: options.PubKeys,
 	}
 
+	baseURL := options.URL
+	if baseURL == "" {
+		if options.Kind == DebianKind {
+			baseURL = debianURL
+		} else if options.Arch != "amd64" && options.Arch != "i386" {
+			baseURL = ubuntuPortsURL
+		} else {
+			baseURL = ubuntuURL
+		}
+	}
+	for _, base := range append([]string{baseURL}, options.Mirrors...) {
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		creds, err := findCredentials(base)
+		if err != nil && err != ErrCredentialsNotFound {
+			return nil, err
+		}
+		archive.urls = append(archive.urls, &archiveURL{
+			base:  base,
+			creds: creds,
+		})
+	}
+
+	if options.Kind == FlatKind {
+		// A flat repository is a single index with no suites or
+		// components, which "./" stands for in apt sources.
+		index := &ubuntuIndex{
+			label:   options.Label,
+			version: options.Version,
+			arch:    options.Arch,
+			suite:   "./",
+			archive: archive,
+		}
+		err := index.fetchRelease()
+		if err != nil {
+			return nil, err
+		}
+		err = index.fetchIndex()
+		if err != nil {
+			return nil, err
+		}
+		archive.indexes = append(archive.indexes, index)
+		return archive, nil
+	}
+
 	for _, suite := range options.Suites {
 		var release control.Section
 		for _, component := range options.Components {
@@ -184,7 +356,12 @@ func openUbuntu(options *Options) (Archive, error) {
 
 func (index *ubuntuIndex) fetchRelease() error {
 	logf("Fetching %s %s %s suite details...", index.label, index.version, index.suite)
-	reader, err := index.fetch("InRelease", "", fetchDefault)
+	options := &index.archive.options
+	releaseFile := "InRelease"
+	if options.Trusted {
+		releaseFile = "Release"
+	}
+	reader, err := index.fetch(releaseFile, "", fetchDefault, nil)
 	if err != nil {
 		return err
 	}
@@ -195,6 +372,23 @@ func (index *ubuntuIndex) fetchRelease() error {
 		return err
 	}
 
+	var section control.Section
+	if options.Trusted {
+		section, err = index.parseRelease(string(data))
+	} else {
+		section, err = index.verifyRelease(data)
+	}
+	if err != nil {
+		return err
+	}
+	logf("Release date: %s", section.Get("Date"))
+
+	index.release = section
+	return nil
+}
+
+func (index *ubuntuIndex) verifyRelease(data []byte) (control.Section, error) {
+
 	// Decode the signature(s) and verify the InRelease file. The InRelease
 	// file may have multiple signatures from different keys. Verify that at
 	// least one signature is valid against the archive's set of public keys.
@@ -203,43 +397,56 @@ func (index *ubuntuIndex) fetchRelease() error {
 	// https://salsa.debian.org/apt-team/apt/-/blob/4e344a4/methods/gpgv.cc#L553-557
 	sigs, canonicalBody, err := pgputil.DecodeClearSigned(data)
 	if err != nil {
-		return fmt.Errorf("cannot decode clearsigned InRelease file: %v", err)
+		return nil, fmt.Errorf("cannot decode clearsigned InRelease file: %v", err)
 	}
 	err = pgputil.VerifyAnySignature(index.archive.pubKeys, sigs, canonicalBody)
 	if err != nil {
-		return fmt.Errorf("cannot verify signature of the InRelease file")
+		return nil, fmt.Errorf("cannot verify signature of the InRelease file")
 	}
 
 	// canonicalBody has <CR><LF> line endings, reverting that to match the
 	// expected control file format.
 	body := strings.ReplaceAll(string(canonicalBody), "\r", "")
+	return index.parseRelease(body)
+}
+
+func (index *ubuntuIndex) parseRelease(body string) (control.Section, error) {
+	releaseFile := "InRelease"
+	if index.archive.options.Trusted {
+		releaseFile = "Release"
+	}
+	if index.archive.options.Kind != UbuntuKind {
+		// Other archives may have any Origin and Label, or none at all,
+		// so there is no field to find their single section by.
+		return control.ParseSection(body), nil
+	}
 	ctrl, err := control.ParseString("Label", body)
 	if err != nil {
-		return fmt.Errorf("cannot parse InRelease file: %v", err)
+		return nil, fmt.Errorf("cannot parse %s file: %v", releaseFile, err)
 	}
 	section := ctrl.Section("Ubuntu")
 	if section == nil {
 		section = ctrl.Section("UbuntuProFIPS")
 		if section == nil {
-			return fmt.Errorf("corrupted archive InRelease file: no Ubuntu section")
+			return nil, fmt.Errorf("corrupted archive %s file: no Ubuntu section", releaseFile)
 		}
 	}
-	logf("Release date: %s", section.Get("Date"))
-
-	index.release = section
-	return nil
+	return section, nil
 }
 
 func (index *ubuntuIndex) fetchIndex() error {
 	digests := index.release.Get("SHA256")
 	packagesPath := fmt.Sprintf("%s/binary-%s/Packages", index.component, index.arch)
+	if index.archive.options.Kind == FlatKind {
+		packagesPath = "Packages"
+	}
 	digest, _, _ := control.ParsePathInfo(digests, packagesPath)
 	if digest == "" {
 		return fmt.Errorf("%s is missing from %s %s component digests", packagesPath, index.suite, index.component)
 	}
 
 	logf("Fetching index for %s %s %s %s component...", index.label, index.version, index.suite, index.component)
-	reader, err := index.fetch(packagesPath+".gz", digest, fetchBulk)
+	reader, err := index.fetch(packagesPath+".gz", digest, fetchBulk, nil)
 	if err != nil {
 		return err
 	}
@@ -269,7 +476,7 @@ func (index *ubuntuIndex) checkComponents(components []string) error {
 	return nil
 }
 
-func (index *ubuntuIndex) fetch(suffix, digest string, flags fetchFlags) (io.ReadCloser, error) {
+func (index *ubuntuIndex) fetch(suffix, digest string, flags fetchFlags, progress progressFunc) (io.ReadCloser, error) {
 	reader, err := index.archive.cache.Open(digest)
 	if err == nil {
 		return reader, nil
@@ -277,21 +484,117 @@ func (index *ubuntuIndex) fetch(suffix, digest string, flags fetchFlags) (io.Rea
 		return nil, err
 	}
 
-	baseURL := ubuntuURL
-	if index.arch != "amd64" && index.arch != "i386" {
-		baseURL = ubuntuPortsURL
+	// Try the archive URL first and then each mirror in order. Content is
+	// verified against the signed digests regardless of its origin.
+	urls := index.archive.urls
+	for i, archiveURL := range urls {
+		reader, err = index.fetchURL(archiveURL, suffix, digest, flags, progress)
+		if err == nil || i == len(urls)-1 {
+			break
+		}
+		logf("Cannot fetch from %s, trying %s: %v", archiveURL.base, urls[i+1].base, err)
 	}
+	return reader, err
+}
+
+// progressFunc is called as data is received, with the total size or -1
+// when unknown.
+type progressFunc func(received, total int64)
+
+// fetchAttempts is the number of times a download from a given location is
+// tried before giving up on it. The wait before a retry starts at
+// fetchBackoff and doubles after each attempt.
+var fetchAttempts = 3
+var fetchBackoff = time.Second
+
+// download holds the state of a file download across attempts.
+type download struct {
+	url    string
+	creds  *credentials
+	suffix string
+	digest string
+	cache  *cache.Cache
+	writer *cache.Writer
+	// received is the amount of data already in writer.
+	received int64
+	// resumable is set when the data received is stored as is, so that a
+	// retry may continue where the interrupted attempt stopped. Once all
+	// attempts fail, the data received is kept in the cache so that a later
+	// fetch of the same digest continues it as well.
+	resumable bool
+}
+
+func (dl *download) restart() {
+	dl.writer.Discard()
+	dl.writer = dl.cache.Create(dl.digest)
+	dl.received = 0
+}
 
+func (index *ubuntuIndex) fetchURL(archiveURL *archiveURL, suffix, digest string, flags fetchFlags, progress progressFunc) (reader io.ReadCloser, err error) {
 	var url string
-	if strings.HasPrefix(suffix, "pool/") {
-		url = baseURL + suffix
+	if index.archive.options.Kind == FlatKind {
+		url = archiveURL.base + strings.TrimPrefix(suffix, "./")
+	} else if strings.HasPrefix(suffix, "pool/") {
+		url = archiveURL.base + suffix
 	} else {
-		url = baseURL + "dists/" + index.suite + "/" + suffix
+		url = archiveURL.base + "dists/" + index.suite + "/" + suffix
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	dl := &download{
+		url:       url,
+		creds:     archiveURL.creds,
+		suffix:    suffix,
+		digest:    digest,
+		cache:     index.archive.cache,
+		resumable: digest != "" && !strings.HasSuffix(suffix, ".gz"),
+	}
+	if dl.resumable {
+		dl.writer, dl.received = dl.cache.Resume(digest)
+		if dl.received > 0 {
+			logf("Resuming download of %s at %d bytes", url, dl.received)
+		}
+	} else {
+		dl.writer = dl.cache.Create(digest)
+	}
+	defer func() {
+		if err != nil && dl.resumable && dl.received > 0 {
+			dl.writer.Suspend()
+		} else {
+			dl.writer.Close()
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		retry, err := dl.attempt(flags, progress)
+		if err == nil {
+			break
+		}
+		if !retry || attempt == fetchAttempts {
+			return nil, err
+		}
+		backoff := fetchBackoff << (attempt - 1)
+		logf("Cannot fetch %s, retrying in %v: %v", url, backoff, err)
+		time.Sleep(backoff)
+		if dl.received > 0 && !dl.resumable {
+			dl.restart()
+		}
+	}
+
+	return index.archive.cache.Open(dl.writer.Digest())
+}
+
+// attempt tries to complete the download once, returning whether it is
+// worth retrying on errors.
+func (dl *download) attempt(flags fetchFlags, progress progressFunc) (retry bool, err error) {
+	req, err := http.NewRequest("GET", dl.url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create HTTP request: %v", err)
+		return false, fmt.Errorf("cannot create HTTP request: %v", err)
+	}
+	if creds := dl.creds; creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	if dl.received > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", dl.received))
 	}
 	var resp *http.Response
 	if flags&fetchBulk != 0 {
@@ -300,39 +603,80 @@ func (index *ubuntuIndex) fetch(suffix, digest string, flags fetchFlags) (io.Rea
 		resp, err = httpDo(req)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot talk to archive: %v", err)
+		return true, fmt.Errorf("cannot talk to archive: %v", err)
 	}
 	defer resp.Body.Close()
 
 	switch resp.StatusCode {
 	case 200:
-		// ok
-	case 401, 404:
-		return nil, fmt.Errorf("cannot find archive data")
+		if dl.received > 0 {
+			// The range was ignored and the whole content is coming.
+			dl.restart()
+		}
+	case 206:
+		contentRange := resp.Header.Get("Content-Range")
+		if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", dl.received)) {
+			dl.restart()
+			return true, fmt.Errorf("cannot resume download: unexpected content range %q", contentRange)
+		}
+	case 401:
+		return false, fmt.Errorf("cannot authenticate with archive")
+	case 404:
+		return false, fmt.Errorf("cannot find archive data")
 	default:
-		return nil, fmt.Errorf("error from archive: %v", resp.Status)
+		return resp.StatusCode >= 500, fmt.Errorf("error from archive: %v", resp.Status)
 	}
 
-	body := resp.Body
-	if strings.HasSuffix(suffix, ".gz") {
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = dl.received + resp.ContentLength
+	}
+	counter := &countingReader{
+		reader:   resp.Body,
+		received: dl.received,
+		total:    total,
+		progress: progress,
+	}
+	var body io.Reader = counter
+	if strings.HasSuffix(dl.suffix, ".gz") {
 		reader, err := gzip.NewReader(body)
 		if err != nil {
-			return nil, fmt.Errorf("cannot decompress data: %v", err)
+			return counter.err != nil, fmt.Errorf("cannot decompress data: %v", err)
 		}
 		defer reader.Close()
 		body = reader
 	}
 
-	writer := index.archive.cache.Create(digest)
-	defer writer.Close()
-
-	_, err = io.Copy(writer, body)
+	n, err := io.Copy(dl.writer, body)
+	dl.received += n
 	if err == nil {
-		err = writer.Close()
+		err = dl.writer.Close()
 	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot fetch from archive: %v", err)
+		// Only failures reading from the network are worth retrying.
+		return counter.err != nil, fmt.Errorf("cannot fetch from archive: %v", err)
 	}
+	return false, nil
+}
+
+// countingReader reports the progress of the data read and records any
+// error from the underlying reader.
+type countingReader struct {
+	reader   io.Reader
+	received int64
+	total    int64
+	progress progressFunc
+	err      error
+}
 
-	return index.archive.cache.Open(writer.Digest())
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.received += int64(n)
+	if n > 0 && r.progress != nil {
+		r.progress(r.received, r.total)
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
 }
@@ -4,6 +4,8 @@ import (
 	"golang.org/x/crypto/openpgp/packet"
 	. "gopkg.in/check.v1"
 
+	"bytes"
+	"crypto/sha256"
 	"debug/elf"
 	"errors"
 	"flag"
@@ -15,6 +17,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"testing/iotest"
 
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/archive/testarchive"
@@ -32,9 +35,15 @@ type httpSuite struct {
 	err       error
 	header    http.Header
 	status    int
-	restore   func()
-	privKey   *packet.PrivateKey
-	pubKey    *packet.PublicKey
+	auth      string
+	// hook may take over the response to a request by returning a
+	// non-nil response or error.
+	hook           func(req *http.Request) (*http.Response, error)
+	restore        func()
+	restoreEnv     func()
+	restoreBackoff func()
+	privKey        *packet.PrivateKey
+	pubKey         *packet.PublicKey
 }
 
 var _ = Suite(&httpSuite{})
@@ -55,13 +64,20 @@ func (s *httpSuite) SetUpTest(c *C) {
 	s.responses = make(map[string][]byte)
 	s.header = nil
 	s.status = 200
+	s.auth = ""
+	s.hook = nil
 	s.restore = archive.FakeDo(s.Do)
+	s.restoreBackoff = archive.FakeFetchBackoff(0)
+	// Do not pick up credentials from the host.
+	s.restoreEnv = fakeEnv("CHISEL_AUTH_DIR", c.MkDir())
 	s.privKey = key1.PrivKey
 	s.pubKey = key1.PubKey
 }
 
 func (s *httpSuite) TearDownTest(c *C) {
 	s.restore()
+	s.restoreEnv()
+	s.restoreBackoff()
 }
 
 func (s *httpSuite) Do(req *http.Request) (*http.Response, error) {
@@ -73,13 +89,29 @@ func (s *httpSuite) Do(req *http.Request) (*http.Response, error) {
 	s.requests = append(s.requests, req)
 	body := s.response
 	s.logf("Request: %s", req.URL.String())
+	if s.hook != nil {
+		if rsp, err := s.hook(req); rsp != nil || err != nil {
+			return rsp, err
+		}
+	}
+	if s.auth != "" {
+		username, password, _ := req.BasicAuth()
+		if username+":"+password != s.auth {
+			rsp := &http.Response{
+				Body:       io.NopCloser(strings.NewReader("")),
+				StatusCode: 401,
+			}
+			return rsp, s.err
+		}
+	}
 	if response, ok := s.responses[path.Clean(req.URL.Path)]; ok {
 		body = string(response)
 	}
 	rsp := &http.Response{
-		Body:       io.NopCloser(strings.NewReader(body)),
-		Header:     s.header,
-		StatusCode: s.status,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Header:        s.header,
+		StatusCode:    s.status,
 	}
 	return rsp, s.err
 }
@@ -126,7 +158,7 @@ func (s *httpSuite) prepareArchiveAdjustRelease(suite, version, arch string, com
 			})
 		}
 		release.Items = append(release.Items, index)
-		release.Items = append(release.Items, &testarchive.Gzip{index})
+		release.Items = append(release.Items, &testarchive.Gzip{Item: index})
 	}
 	base, err := url.Parse(s.base)
 	if err != nil {
@@ -178,6 +210,23 @@ var optionErrorTests = []optionErrorTest{{
 		Components: []string{"main", "other"},
 	},
 	error: `invalid package architecture: foo`,
+}, {
+	options: archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main"},
+		Kind:       "foo",
+	},
+	error: `invalid archive kind: "foo"`,
+}, {
+	options: archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		Kind:  archive.FlatKind,
+	},
+	error: `archive options missing url`,
 }}
 
 func (s *httpSuite) TestOptionErrors(c *C) {
@@ -219,6 +268,78 @@ func (s *httpSuite) TestFetchPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg4 1.4 data")
 }
 
+func (s *httpSuite) TestPackageInfo(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	info, err := testArchive.Info("mypkg3")
+	c.Assert(err, IsNil)
+	c.Assert(info, DeepEquals, &archive.PackageInfo{
+		Name:    "mypkg3",
+		Version: "1.3",
+		Arch:    "amd64",
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256([]byte("mypkg3 1.3 data"))),
+		Size:    15,
+	})
+
+	_, err = testArchive.Info("mypkg5")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg5" in archive`)
+}
+
+func (s *httpSuite) TestFetchPackageWithCredentials(c *C) {
+	s.auth = "johndoe:12345"
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	_, err := archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot authenticate with archive")
+
+	credsDir := c.MkDir()
+	restore := fakeEnv("CHISEL_AUTH_DIR", credsDir)
+	defer restore()
+	confFile := filepath.Join(credsDir, "ubuntu.conf")
+	err = os.WriteFile(confFile, []byte("machine http://archive.ubuntu.com/ubuntu login johndoe password 12345"), 0600)
+	c.Assert(err, IsNil)
+
+	s.requests = nil
+	options.CacheDir = c.MkDir()
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+	c.Assert(s.requests, Not(HasLen), 0)
+	for _, req := range s.requests {
+		username, password, ok := req.BasicAuth()
+		c.Assert(ok, Equals, true)
+		c.Assert(username, Equals, "johndoe")
+		c.Assert(password, Equals, "12345")
+	}
+}
+
 func (s *httpSuite) TestFetchPortsPackage(c *C) {
 
 	s.base = "http://ports.ubuntu.com/ubuntu-ports/"
@@ -249,6 +370,446 @@ func (s *httpSuite) TestFetchPortsPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg4 1.4 data")
 }
 
+func (s *httpSuite) TestFetchCustomURLPackage(c *C) {
+	s.base = "http://mirror.example.com/ubuntu/"
+
+	s.prepareArchive("jammy", "22.04", "arm64", []string{"main", "universe"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "arm64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+		URL:        "http://mirror.example.com/ubuntu",
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+}
+
+func (s *httpSuite) TestFetchMirrorPackage(c *C) {
+	// Requests to any other location fail.
+	s.base = "http://mirror2.example.com/ubuntu/"
+
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+		URL:        "http://primary.example.com/ubuntu/",
+		Mirrors: []string{
+			"http://mirror1.example.com/ubuntu/",
+			"http://mirror2.example.com/ubuntu/",
+		},
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg3")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg3 1.3 data")
+
+	// Only the last mirror could be reached.
+	c.Assert(s.requests, HasLen, 4)
+	for _, req := range s.requests {
+		c.Assert(req.URL.Host, Equals, "mirror2.example.com")
+	}
+}
+
+func (s *httpSuite) TestFetchMirrorsError(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+	s.status = 404
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+		Mirrors:    []string{"http://archive.ubuntu.com/ubuntu/mirror"},
+	}
+
+	_, err := archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot find archive data")
+	c.Assert(s.requests, HasLen, 2)
+	c.Assert(s.requests[1].URL.String(), Equals, "http://archive.ubuntu.com/ubuntu/mirror/dists/jammy/InRelease")
+}
+
+func (s *httpSuite) prepareFlatArchive(arch string, privKey *packet.PrivateKey) *testarchive.Release {
+	release := &testarchive.Release{
+		Label:   "Local",
+		PrivKey: privKey,
+		Flat:    true,
+	}
+	index := &testarchive.PackageIndex{
+		Arch: arch,
+	}
+	for seq := 1; seq <= 2; seq++ {
+		index.Packages = append(index.Packages, &testarchive.Package{
+			Name:      fmt.Sprintf("mypkg%d", seq),
+			Version:   fmt.Sprintf("1.%d", seq),
+			Arch:      arch,
+			Component: "main",
+		})
+	}
+	release.Items = append(release.Items, index, &testarchive.Gzip{Item: index})
+	base, err := url.Parse(s.base)
+	if err != nil {
+		panic(err)
+	}
+	release.Render(base.Path, s.responses)
+	return release
+}
+
+func (s *httpSuite) TestFetchDebianPackage(c *C) {
+	s.base = "http://deb.debian.org/debian/"
+
+	s.prepareArchiveAdjustRelease("bookworm", "12", "arm64", []string{"main"}, func(r *testarchive.Release) {
+		r.Label = "Debian"
+	})
+
+	options := archive.Options{
+		Label:      "debian",
+		Version:    "12",
+		Arch:       "arm64",
+		Suites:     []string{"bookworm"},
+		Components: []string{"main"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+		Kind:       archive.DebianKind,
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg2")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg2 1.2 data")
+}
+
+func (s *httpSuite) TestFetchFlatPackage(c *C) {
+	s.base = "http://repo.example.com/debs/"
+
+	s.prepareFlatArchive("amd64", s.privKey)
+
+	options := archive.Options{
+		Label:    "local",
+		Arch:     "amd64",
+		CacheDir: c.MkDir(),
+		PubKeys:  []*packet.PublicKey{s.pubKey},
+		URL:      "http://repo.example.com/debs/",
+		Kind:     archive.FlatKind,
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+	c.Assert(s.requests, HasLen, 3)
+	c.Assert(s.requests[0].URL.String(), Equals, "http://repo.example.com/debs/InRelease")
+	c.Assert(s.requests[1].URL.String(), Equals, "http://repo.example.com/debs/Packages.gz")
+	c.Assert(s.requests[2].URL.String(), Equals, "http://repo.example.com/debs/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb")
+}
+
+func (s *httpSuite) TestFetchTrustedFlatPackage(c *C) {
+	s.base = "http://repo.example.com/debs/"
+
+	s.prepareFlatArchive("amd64", nil)
+
+	options := archive.Options{
+		Label:    "local",
+		Arch:     "amd64",
+		CacheDir: c.MkDir(),
+		URL:      "http://repo.example.com/debs/",
+		Kind:     archive.FlatKind,
+		Trusted:  true,
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg2")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg2 1.2 data")
+	c.Assert(s.requests[0].URL.String(), Equals, "http://repo.example.com/debs/Release")
+}
+
+func (s *httpSuite) TestFetchRetries(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	// Every location fails twice before working.
+	attempts := make(map[string]int)
+	s.hook = func(req *http.Request) (*http.Response, error) {
+		attempts[req.URL.Path]++
+		switch attempts[req.URL.Path] {
+		case 1:
+			return nil, errors.New("connection reset by peer")
+		case 2:
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader("")),
+				StatusCode: 503,
+				Status:     "503 Service Unavailable",
+			}, nil
+		}
+		return nil, nil
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	c.Assert(s.requests, HasLen, 12)
+}
+
+func (s *httpSuite) TestFetchRetriesExhausted(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	var poolRequests int
+	s.hook = func(req *http.Request) (*http.Response, error) {
+		if !strings.Contains(req.URL.Path, "/pool/") {
+			return nil, nil
+		}
+		poolRequests++
+		return &http.Response{
+			Body:       io.NopCloser(strings.NewReader("")),
+			StatusCode: 502,
+			Status:     "502 Bad Gateway",
+		}, nil
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	_, err = archive.Fetch("mypkg1")
+	c.Assert(err, ErrorMatches, "error from archive: 502 Bad Gateway")
+	c.Assert(poolRequests, Equals, 3)
+}
+
+// interruptedResponse sends the first n bytes of data and then fails.
+func interruptedResponse(data []byte, n int) *http.Response {
+	return &http.Response{
+		Body: io.NopCloser(io.MultiReader(
+			bytes.NewReader(data[:n]),
+			iotest.ErrReader(errors.New("connection reset by peer")),
+		)),
+		ContentLength: int64(len(data)),
+		StatusCode:    200,
+	}
+}
+
+type fetchResumeTest struct {
+	summary string
+	// ignoreRange makes the server send all content on the second request.
+	ignoreRange bool
+	// resumed is the Range header expected on the second request.
+	resumed string
+}
+
+var fetchResumeTests = []fetchResumeTest{{
+	summary: "Download resumes where it stopped",
+	resumed: "bytes=5-",
+}, {
+	summary:     "Server ignores the range",
+	ignoreRange: true,
+	resumed:     "bytes=5-",
+}}
+
+func (s *httpSuite) TestFetchResume(c *C) {
+	for _, test := range fetchResumeTests {
+		c.Logf("Summary: %s", test.summary)
+
+		s.requests = nil
+		s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+		var ranges []string
+		s.hook = func(req *http.Request) (*http.Response, error) {
+			if !strings.Contains(req.URL.Path, "/pool/") {
+				return nil, nil
+			}
+			data := s.responses[path.Clean(req.URL.Path)]
+			ranges = append(ranges, req.Header.Get("Range"))
+			if len(ranges) == 1 {
+				return interruptedResponse(data, 5), nil
+			}
+			if test.ignoreRange {
+				return nil, nil
+			}
+			return &http.Response{
+				Body:          io.NopCloser(bytes.NewReader(data[5:])),
+				ContentLength: int64(len(data) - 5),
+				Header: http.Header{
+					"Content-Range": {fmt.Sprintf("bytes 5-%d/%d", len(data)-1, len(data))},
+				},
+				StatusCode: 206,
+			}, nil
+		}
+
+		var progress [][2]int64
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       "amd64",
+			Suites:     []string{"jammy"},
+			Components: []string{"main", "universe"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*packet.PublicKey{s.pubKey},
+			Progress: func(pkg string, received, total int64) {
+				c.Assert(pkg, Equals, "mypkg1")
+				progress = append(progress, [2]int64{received, total})
+			},
+		}
+
+		archive, err := archive.Open(&options)
+		c.Assert(err, IsNil)
+
+		pkg, err := archive.Fetch("mypkg1")
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+		c.Assert(ranges, DeepEquals, []string{"", test.resumed})
+		c.Assert(progress[0], Equals, [2]int64{5, 15})
+		c.Assert(progress[len(progress)-1], Equals, [2]int64{15, 15})
+	}
+}
+
+func (s *httpSuite) TestFetchResumeLater(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	// The server fails partway and then stops answering, so all attempts
+	// of the first fetch fail, and the next fetch continues the download.
+	var ranges []string
+	s.hook = func(req *http.Request) (*http.Response, error) {
+		if !strings.Contains(req.URL.Path, "/pool/") {
+			return nil, nil
+		}
+		data := s.responses[path.Clean(req.URL.Path)]
+		ranges = append(ranges, req.Header.Get("Range"))
+		switch len(ranges) {
+		case 1:
+			return interruptedResponse(data, 5), nil
+		case 2, 3:
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader("")),
+				StatusCode: 503,
+				Status:     "503 Service Unavailable",
+			}, nil
+		}
+		return &http.Response{
+			Body:          io.NopCloser(bytes.NewReader(data[5:])),
+			ContentLength: int64(len(data) - 5),
+			Header: http.Header{
+				"Content-Range": {fmt.Sprintf("bytes 5-%d/%d", len(data)-1, len(data))},
+			},
+			StatusCode: 206,
+		}, nil
+	}
+
+	cacheDir := c.MkDir()
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   cacheDir,
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	archive1, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	_, err = archive1.Fetch("mypkg1")
+	c.Assert(err, ErrorMatches, "error from archive: 503 Service Unavailable")
+	c.Assert(ranges, DeepEquals, []string{"", "bytes=5-", "bytes=5-"})
+
+	archive2, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	pkg, err := archive2.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	c.Assert(ranges, DeepEquals, []string{"", "bytes=5-", "bytes=5-", "bytes=5-"})
+
+	// Nothing partial is left in the cache.
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "sha256"))
+	c.Assert(err, IsNil)
+	for _, entry := range entries {
+		c.Assert(entry.Name(), Not(Matches), ".*\\.(partial|tmp\\..*)")
+	}
+}
+
+func (s *httpSuite) TestFetchRestartIndex(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main"})
+
+	// Compressed indexes cannot be resumed, so they are fetched again.
+	var ranges []string
+	s.hook = func(req *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(req.URL.Path, "Packages.gz") {
+			return nil, nil
+		}
+		ranges = append(ranges, req.Header.Get("Range"))
+		if len(ranges) == 1 {
+			return interruptedResponse(s.responses[req.URL.Path], 5), nil
+		}
+		return nil, nil
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, DeepEquals, []string{"", ""})
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+}
+
 func (s *httpSuite) TestFetchSecurityPackage(c *C) {
 
 	for i, suite := range []string{"jammy", "jammy-updates", "jammy-security"} {
@@ -285,6 +846,52 @@ func (s *httpSuite) TestFetchSecurityPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg2 1.2 data")
 }
 
+func (s *httpSuite) TestFetchConstrainedPackage(c *C) {
+
+	for i, suite := range []string{"jammy", "jammy-updates", "jammy-security"} {
+		release := s.prepareArchive(suite, "22.04", "amd64", []string{"main", "universe"})
+		release.Walk(func(item testarchive.Item) error {
+			if p, ok := item.(*testarchive.Package); ok && p.Name == "mypkg1" {
+				p.Version = fmt.Sprintf("%s.%d", p.Version, i)
+				p.Data = []byte("package from " + suite)
+			}
+			return nil
+		})
+		release.Render("/ubuntu", s.responses)
+	}
+
+	mustParse := func(constraint string) *deb.VersionConstraint {
+		parsed, err := deb.ParseVersionConstraint(constraint)
+		c.Assert(err, IsNil)
+		return parsed
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		CacheDir:   c.MkDir(),
+		Arch:       "amd64",
+		Suites:     []string{"jammy", "jammy-security", "jammy-updates"},
+		Components: []string{"main", "universe"},
+		PubKeys:    []*packet.PublicKey{s.pubKey},
+		Constraints: map[string]*deb.VersionConstraint{
+			"mypkg1": mustParse("<< 1.1.2"),
+			"mypkg2": mustParse(">= 2.0"),
+		},
+	}
+
+	archive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, err := archive.Fetch("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "package from jammy-updates")
+
+	c.Assert(archive.Exists("mypkg2"), Equals, false)
+	_, err = archive.Fetch("mypkg2")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg2" with version >= 2.0 in archive`)
+}
+
 func (s *httpSuite) TestArchiveLabels(c *C) {
 	setLabel := func(label string) func(*testarchive.Release) {
 		return func(r *testarchive.Release) {
@@ -351,6 +958,13 @@ func (s *httpSuite) TestArchiveLabels(c *C) {
 
 	_, err = archive.Open(&options)
 	c.Assert(err, ErrorMatches, `.*\bno Ubuntu section`)
+
+	// Debian-style archives accept any label.
+	options.Kind = archive.DebianKind
+	options.URL = "http://archive.ubuntu.com/ubuntu/"
+
+	_, err = archive.Open(&options)
+	c.Assert(err, IsNil)
 }
 
 type verifyArchiveReleaseTest struct {
@@ -2,6 +2,7 @@ package archive
 
 import (
 	"net/http"
+	"time"
 )
 
 func FakeDo(do func(req *http.Request) (*http.Response, error)) (restore func()) {
@@ -19,3 +20,11 @@ type Credentials = credentials
 
 var FindCredentials = findCredentials
 var FindCredentialsInDir = findCredentialsInDir
+
+func FakeFetchBackoff(backoff time.Duration) (restore func()) {
+	_fetchBackoff := fetchBackoff
+	fetchBackoff = backoff
+	return func() {
+		fetchBackoff = _fetchBackoff
+	}
+}
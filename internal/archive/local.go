@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/canonical/chisel/internal/control"
+	"github.com/canonical/chisel/internal/deb"
+)
+
+// localArchive serves packages from a directory on the local filesystem,
+// which allows cutting without network access. The directory may hold a
+// Packages or Packages.gz index next to the .deb files, as in a flat
+// repository. Otherwise the index is built by scanning the .deb files
+// found under it. No signatures are involved, so the content of the
+// directory is trusted.
+type localArchive struct {
+	options Options
+	dir     string
+	// packages holds the index stanzas of every version of each package,
+	// as the directory may hold several of them.
+	packages map[string][]control.Section
+}
+
+func isLocalURL(archiveURL string) bool {
+	return strings.HasPrefix(archiveURL, "file:")
+}
+
+func openLocal(options *Options) (Archive, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil || u.Path == "" || u.Host != "" {
+		return nil, fmt.Errorf("invalid local archive URL: %q", options.URL)
+	}
+	dir := filepath.FromSlash(u.Path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open local archive: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cannot open local archive: %s is not a directory", dir)
+	}
+
+	archive := &localArchive{
+		options: *options,
+		dir:     dir,
+	}
+	logf("Reading %s local archive at %s...", options.Label, dir)
+	archive.packages, err = readLocalIndex(dir)
+	if err == nil {
+		return archive, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	archive.packages, err = scanLocalIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// readLocalIndex reads the stanzas of the Packages index in dir, grouped
+// by package name.
+func readLocalIndex(dir string) (map[string][]control.Section, error) {
+	var reader io.Reader
+	file, err := os.Open(filepath.Join(dir, "Packages"))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(dir, "Packages.gz"))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress local archive index: %v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer file.Close()
+		reader = file
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read local archive index: %v", err)
+	}
+	packages := make(map[string][]control.Section)
+	for _, stanza := range strings.Split(string(data), "\n\n") {
+		if strings.TrimSpace(stanza) == "" {
+			continue
+		}
+		section := control.ParseSection(stanza)
+		name := section.Get("Package")
+		if name == "" {
+			return nil, fmt.Errorf("cannot parse local archive index: stanza has no Package field")
+		}
+		packages[name] = append(packages[name], section)
+	}
+	return packages, nil
+}
+
+// scanLocalIndex builds the index stanzas of the .deb files under dir out
+// of their control files, grouped by package name.
+func scanLocalIndex(dir string) (map[string][]control.Section, error) {
+	packages := make(map[string][]control.Section)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".deb") {
+			return nil
+		}
+		section, err := scanLocalPackage(dir, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		name := section.Get("Package")
+		packages[name] = append(packages[name], section)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan local archive: %v", err)
+	}
+	return packages, nil
+}
+
+// scanLocalPackage returns the index stanza of the .deb file at path,
+// streaming its content to compute the digest.
+func scanLocalPackage(dir, path string) (control.Section, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	controlData, err := deb.ReadControl(file)
+	if err != nil {
+		return nil, err
+	}
+	// The name is not known upfront, so parse the single section
+	// without looking it up.
+	if control.ParseSection(string(controlData)).Get("Package") == "" {
+		return nil, fmt.Errorf("package control file has no Package field")
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	stanza := strings.TrimRight(string(controlData), "\n") + "\n" +
+		"Filename: " + filepath.ToSlash(relPath) + "\n" +
+		"Size: " + strconv.FormatInt(size, 10) + "\n" +
+		"SHA256: " + hex.EncodeToString(hash.Sum(nil)) + "\n"
+	return control.ParseSection(stanza), nil
+}
+
+func (a *localArchive) Options() *Options {
+	return &a.options
+}
+
+func (a *localArchive) Exists(pkg string) bool {
+	_, err := a.selectPackage(pkg)
+	return err == nil
+}
+
+// selectPackage returns the index stanza of the highest version of pkg for
+// the archive architecture that satisfies its version constraint.
+func (a *localArchive) selectPackage(pkg string) (control.Section, error) {
+	constraint := a.options.Constraints[pkg]
+	var selected control.Section
+	for _, section := range a.packages[pkg] {
+		if section.Get("Filename") == "" {
+			continue
+		}
+		arch := section.Get("Architecture")
+		if arch != a.options.Arch && arch != "all" {
+			continue
+		}
+		version := section.Get("Version")
+		if constraint != nil && !constraint.Match(version) {
+			continue
+		}
+		if selected != nil && deb.CompareVersions(selected.Get("Version"), version) >= 0 {
+			continue
+		}
+		selected = section
+	}
+	if selected == nil {
+		return nil, missingPackageError(pkg, constraint)
+	}
+	return selected, nil
+}
+
+func (a *localArchive) Info(pkg string) (*PackageInfo, error) {
+	section, err := a.selectPackage(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return packageInfo(section), nil
+}
+
+func (a *localArchive) Fetch(pkg string) (io.ReadCloser, error) {
+	section, err := a.selectPackage(pkg)
+	if err != nil {
+		return nil, err
+	}
+	suffix := section.Get("Filename")
+	logf("Fetching %s...", suffix)
+	file, err := os.Open(filepath.Join(a.dir, filepath.FromSlash(suffix)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch from local archive: %v", err)
+	}
+	if digest := section.Get("SHA256"); digest != "" {
+		hash := sha256.New()
+		_, err = io.Copy(hash, file)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("cannot fetch from local archive: %v", err)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != digest {
+			file.Close()
+			return nil, fmt.Errorf("cannot fetch from local archive: expected digest %s, got %s", digest, sum)
+		}
+	}
+	return file, nil
+}
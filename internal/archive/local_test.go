@@ -0,0 +1,192 @@
+package archive_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+func makeLocalDeb(c *C, dir, name, version, arch string) []byte {
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nSource: %s-src\n"+
+		"Depends: libc6 (>= 2.34)\nPre-Depends: dpkg\n", name, version, arch, name)
+	data := testutil.MustMakeDebWithControl(control, []testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./version", version),
+	})
+	debPath := filepath.Join(dir, "pool", fmt.Sprintf("%s_%s_%s.deb", name, version, arch))
+	err := os.MkdirAll(filepath.Dir(debPath), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(debPath, data, 0644)
+	c.Assert(err, IsNil)
+	return data
+}
+
+func readAll(c *C, a archive.Archive, pkg string) string {
+	reader, err := a.Fetch(pkg)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	return read(reader)
+}
+
+func (s *S) TestLocalArchiveScan(c *C) {
+	dir := c.MkDir()
+	makeLocalDeb(c, dir, "mypkg1", "1.0", "amd64")
+	newer := makeLocalDeb(c, dir, "mypkg1", "1.1", "amd64")
+	makeLocalDeb(c, dir, "mypkg1", "1.2", "arm64")
+	indep := makeLocalDeb(c, dir, "mypkg2", "2.0", "all")
+	makeLocalDeb(c, dir, "mypkg3", "3.0", "arm64")
+
+	options := archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		URL:   "file://" + dir,
+	}
+	a, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	c.Assert(a.Exists("mypkg1"), Equals, true)
+	c.Assert(a.Exists("mypkg2"), Equals, true)
+	c.Assert(a.Exists("mypkg3"), Equals, false)
+	c.Assert(a.Exists("mypkg4"), Equals, false)
+
+	info, err := a.Info("mypkg1")
+	c.Assert(err, IsNil)
+	c.Assert(info, DeepEquals, &archive.PackageInfo{
+		Name:       "mypkg1",
+		Version:    "1.1",
+		Arch:       "amd64",
+		SHA256:     fmt.Sprintf("%x", sha256.Sum256(newer)),
+		Size:       int64(len(newer)),
+		Source:     "mypkg1-src",
+		Depends:    "libc6 (>= 2.34)",
+		PreDepends: "dpkg",
+	})
+
+	c.Assert(readAll(c, a, "mypkg1"), Equals, string(newer))
+	c.Assert(readAll(c, a, "mypkg2"), Equals, string(indep))
+
+	_, err = a.Fetch("mypkg3")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg3" in archive`)
+}
+
+func (s *S) TestLocalArchiveConstraints(c *C) {
+	dir := c.MkDir()
+	older := makeLocalDeb(c, dir, "mypkg1", "1.0", "amd64")
+	makeLocalDeb(c, dir, "mypkg1", "1.1", "amd64")
+	makeLocalDeb(c, dir, "mypkg2", "1.0", "amd64")
+
+	constraint1, err := deb.ParseVersionConstraint("< 1.1")
+	c.Assert(err, IsNil)
+	constraint2, err := deb.ParseVersionConstraint(">= 2.0")
+	c.Assert(err, IsNil)
+
+	options := archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		URL:   "file://" + dir,
+		Constraints: map[string]*deb.VersionConstraint{
+			"mypkg1": constraint1,
+			"mypkg2": constraint2,
+		},
+	}
+	a, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	c.Assert(readAll(c, a, "mypkg1"), Equals, string(older))
+	_, err = a.Fetch("mypkg2")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg2" with version >= 2.0 in archive`)
+}
+
+func (s *S) TestLocalArchiveIndex(c *C) {
+	dir := c.MkDir()
+	data := makeLocalDeb(c, dir, "mypkg1", "1.0", "amd64")
+	makeLocalDeb(c, dir, "mypkg2", "1.0", "amd64")
+
+	// Only packages in the index are visible.
+	index := fmt.Sprintf("Package: mypkg1\nVersion: 1.0\nArchitecture: amd64\n"+
+		"Filename: pool/mypkg1_1.0_amd64.deb\nSHA256: %x\n\n"+
+		"Package: mypkg2\nVersion: 1.0\nArchitecture: amd64\n"+
+		"Filename: pool/mypkg2_1.0_amd64.deb\nSHA256: %x\n",
+		sha256.Sum256(data), sha256.Sum256([]byte("other")))
+	err := os.WriteFile(filepath.Join(dir, "Packages"), []byte(index), 0644)
+	c.Assert(err, IsNil)
+
+	options := archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		URL:   "file://" + dir,
+	}
+	a, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	c.Assert(readAll(c, a, "mypkg1"), Equals, string(data))
+
+	_, err = a.Fetch("mypkg2")
+	c.Assert(err, ErrorMatches, `cannot fetch from local archive: expected digest [0-9a-f]+, got [0-9a-f]+`)
+}
+
+func (s *S) TestLocalArchiveIndexVersions(c *C) {
+	dir := c.MkDir()
+	older := makeLocalDeb(c, dir, "mypkg1", "1.0", "amd64")
+	newer := makeLocalDeb(c, dir, "mypkg1", "1.1", "amd64")
+	other := makeLocalDeb(c, dir, "mypkg1", "1.2", "arm64")
+
+	// Every version listed in the index is considered, regardless of the
+	// order of the stanzas.
+	var index string
+	for _, pkg := range []struct {
+		version, arch string
+		data          []byte
+	}{{"1.1", "amd64", newer}, {"1.2", "arm64", other}, {"1.0", "amd64", older}} {
+		index += fmt.Sprintf("Package: mypkg1\nVersion: %s\nArchitecture: %s\n"+
+			"Filename: pool/mypkg1_%s_%s.deb\nSHA256: %x\n\n",
+			pkg.version, pkg.arch, pkg.version, pkg.arch, sha256.Sum256(pkg.data))
+	}
+	err := os.WriteFile(filepath.Join(dir, "Packages"), []byte(index), 0644)
+	c.Assert(err, IsNil)
+
+	options := archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		URL:   "file://" + dir,
+	}
+	a, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, a, "mypkg1"), Equals, string(newer))
+
+	constraint, err := deb.ParseVersionConstraint("< 1.1")
+	c.Assert(err, IsNil)
+	options.Constraints = map[string]*deb.VersionConstraint{"mypkg1": constraint}
+	a, err = archive.Open(&options)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, a, "mypkg1"), Equals, string(older))
+}
+
+func (s *S) TestLocalArchiveErrors(c *C) {
+	dir := c.MkDir()
+
+	options := archive.Options{
+		Label: "local",
+		Arch:  "amd64",
+		URL:   "file://" + filepath.Join(dir, "missing"),
+	}
+	_, err := archive.Open(&options)
+	c.Assert(err, ErrorMatches, `cannot open local archive: .*: no such file or directory`)
+
+	options.URL = "file://host/path"
+	_, err = archive.Open(&options)
+	c.Assert(err, ErrorMatches, `invalid local archive URL: "file://host/path"`)
+
+	err = os.WriteFile(filepath.Join(dir, "broken.deb"), []byte("broken"), 0644)
+	c.Assert(err, IsNil)
+	options.URL = "file://" + dir
+	_, err = archive.Open(&options)
+	c.Assert(err, ErrorMatches, `cannot scan local archive: .*/broken.deb: cannot read package control file: .*`)
+}
@@ -106,7 +106,12 @@ type Release struct {
 	Version string
 	Label   string
 	Items   []Item
+	// PrivKey signs the release as InRelease. When nil, the release
+	// is unsigned and named Release.
 	PrivKey *packet.PrivateKey
+	// Flat renders the release as a flat repository, with all items
+	// directly under the prefix.
+	Flat bool
 }
 
 func (r *Release) Walk(f func(Item) error) error {
@@ -114,6 +119,9 @@ func (r *Release) Walk(f func(Item) error) error {
 }
 
 func (r *Release) Path() string {
+	if r.PrivKey == nil {
+		return "Release"
+	}
 	return "InRelease"
 }
 
@@ -140,6 +148,9 @@ func (r *Release) Content() []byte {
 		SHA256:
 		%s
 	`)), r.Label, r.Suite, r.Version, r.Version, digests.String())
+	if r.PrivKey == nil {
+		return []byte(content)
+	}
 
 	var buf bytes.Buffer
 	writer, err := clearsign.Encode(&buf, r.PrivKey, nil)
@@ -160,7 +171,7 @@ func (r *Release) Content() []byte {
 func (r *Release) Render(prefix string, content map[string][]byte) error {
 	return r.Walk(func(item Item) error {
 		itemPath := item.Path()
-		if strings.HasPrefix(itemPath, "pool/") {
+		if r.Flat || strings.HasPrefix(itemPath, "pool/") {
 			itemPath = path.Join(prefix, itemPath)
 		} else {
 			itemPath = path.Join(prefix, "dists", r.Suite, itemPath)
@@ -185,6 +196,10 @@ type PackageIndex struct {
 }
 
 func (pi *PackageIndex) Path() string {
+	if pi.Component == "" {
+		// Index of a flat repository.
+		return "Packages"
+	}
 	return fmt.Sprintf("%s/binary-%s/Packages", pi.Component, pi.Arch)
 }
 
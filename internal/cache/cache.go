@@ -85,6 +85,39 @@ func (cw *Writer) Close() error {
 	return nil
 }
 
+var errDiscarded = fmt.Errorf("cache writer discarded")
+
+// Discard abandons the data written so far, leaving nothing in the cache.
+func (cw *Writer) Discard() {
+	if cw.err == nil {
+		cw.fail(errDiscarded)
+	}
+}
+
+var errSuspended = fmt.Errorf("cache writer suspended")
+
+// Suspend stops writing and keeps the data written so far apart from the
+// cached content, so that a later writer obtained with Resume for the same
+// digest may continue it.
+func (cw *Writer) Suspend() error {
+	if cw.err != nil {
+		return cw.err
+	}
+	if cw.digest == "" {
+		return cw.fail(fmt.Errorf("internal error: cannot suspend cache writer without digest"))
+	}
+	err := cw.file.Close()
+	if err != nil {
+		return cw.fail(err)
+	}
+	err = os.Rename(cw.file.Name(), filepath.Join(filepath.Dir(cw.file.Name()), cw.digest+partialSuffix))
+	if err != nil {
+		return cw.fail(err)
+	}
+	cw.err = errSuspended
+	return nil
+}
+
 func (cw *Writer) Digest() string {
 	return cw.digest
 }
@@ -105,12 +138,10 @@ func (c *Cache) Create(digest string) *Writer {
 	if err != nil {
 		return &Writer{err: fmt.Errorf("cannot create cache directory: %v", err)}
 	}
-	var file *os.File
-	if digest == "" {
-		file, err = os.CreateTemp(c.filePath(""), "tmp.*")
-	} else {
-		file, err = os.Create(c.filePath(digest + ".tmp"))
-	}
+	// Every writer gets its own temporary file, even for the same digest,
+	// so that concurrent writers cannot corrupt each other's data. The
+	// final rename into place is atomic.
+	file, err := os.CreateTemp(c.filePath(""), digest+".tmp.*")
 	if err != nil {
 		return &Writer{err: fmt.Errorf("cannot create cache file: %v", err)}
 	}
@@ -122,6 +153,47 @@ func (c *Cache) Create(digest string) *Writer {
 	}
 }
 
+// partialSuffix is appended to the digest to name the data kept by a
+// suspended writer.
+const partialSuffix = ".partial"
+
+// Resume returns a writer that continues the data kept for digest by a
+// suspended writer, and the size of that data. When there is no such data,
+// it returns a new writer as Create does, and zero.
+func (c *Cache) Resume(digest string) (*Writer, int64) {
+	if c.Dir == "" || digest == "" {
+		return c.Create(digest), 0
+	}
+	cw := c.Create(digest)
+	if cw.err != nil {
+		return cw, 0
+	}
+	// Moving the partial data over the file of the new writer ensures
+	// that only one writer may resume it.
+	err := os.Rename(c.filePath(digest+partialSuffix), cw.file.Name())
+	if os.IsNotExist(err) {
+		return cw, 0
+	} else if err != nil {
+		cw.fail(fmt.Errorf("cannot resume cache file: %v", err))
+		return cw, 0
+	}
+	fname := cw.file.Name()
+	cw.file.Close()
+	file, err := os.OpenFile(fname, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		os.Remove(fname)
+		cw.err = fmt.Errorf("cannot resume cache file: %v", err)
+		return cw, 0
+	}
+	cw.file = file
+	size, err := io.Copy(cw.hash, cw.file)
+	if err != nil {
+		cw.fail(fmt.Errorf("cannot resume cache file: %v", err))
+		return cw, 0
+	}
+	return cw, size
+}
+
 func (c *Cache) Write(digest string, data []byte) error {
 	f := c.Create(digest)
 	_, err1 := f.Write(data)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/canonical/chisel/internal/cache"
@@ -151,3 +152,87 @@ func (s *S) TestCacheOpen(c *C) {
 
 	c.Assert(string(data1), Equals, "data1")
 }
+
+func (s *S) TestCacheConcurrentWrites(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	// Writers for the same digest must not interfere with each other.
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := cc.Create(data1Digest)
+			for _, chunk := range []string{"da", "ta", "1"} {
+				_, err := w.Write([]byte(chunk))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			errs[i] = w.Close()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		c.Assert(err, IsNil)
+	}
+
+	data1, err := cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	c.Assert(string(data1), Equals, "data1")
+
+	entries, err := os.ReadDir(filepath.Join(cc.Dir, "sha256"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+}
+
+func (s *S) TestCacheDiscard(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	w := cc.Create("")
+	_, err := w.Write([]byte("data1"))
+	c.Assert(err, IsNil)
+	w.Discard()
+	c.Assert(w.Close(), ErrorMatches, "cache writer discarded")
+
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, Equals, cache.MissErr)
+	entries, err := os.ReadDir(filepath.Join(cc.Dir, "sha256"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
+func (s *S) TestCacheResume(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	// Nothing to resume yet.
+	w, size := cc.Resume(data1Digest)
+	c.Assert(size, Equals, int64(0))
+	_, err := w.Write([]byte("da"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Suspend(), IsNil)
+	c.Assert(w.Close(), ErrorMatches, "cache writer suspended")
+
+	// Suspended data is not cached content.
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, Equals, cache.MissErr)
+
+	w, size = cc.Resume(data1Digest)
+	c.Assert(size, Equals, int64(2))
+	_, err = w.Write([]byte("ta1"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	data, err := cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data1")
+	entries, err := os.ReadDir(filepath.Join(cc.Dir, "sha256"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+
+	// Suspending requires the digest to resume.
+	w = cc.Create("")
+	c.Assert(w.Suspend(), ErrorMatches, "internal error: cannot suspend cache writer without digest")
+}
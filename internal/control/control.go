@@ -142,3 +142,14 @@ func ParseString(sectionKey, content string) (File, error) {
 		sectionKey: sectionKey,
 	}, nil
 }
+
+// ParseSection parses content holding a single section, such as the control
+// file of a package, which has no field that can be used to index it.
+// Content after the first blank line is ignored.
+func ParseSection(content string) Section {
+	content = strings.TrimLeft(content, "\n")
+	if end := strings.Index(content, "\n\n"); end >= 0 {
+		content = content[:end]
+	}
+	return &ctrlSection{content}
+}
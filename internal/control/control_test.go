@@ -80,6 +80,18 @@ func (s *S) TestParseReader(c *C) {
 	}
 }
 
+func (s *S) TestParseSection(c *C) {
+	section := control.ParseSection(testFile)
+	for key, value := range testFileResults["one"] {
+		c.Assert(section.Get(key), Equals, value, Commentf("Key %q", key))
+	}
+	c.Assert(section.Get("Other"), Equals, "")
+
+	section = control.ParseSection("\nLine: line\nMulti:\n multi\n line\n")
+	c.Assert(section.Get("Line"), Equals, "line")
+	c.Assert(section.Get("Multi"), Equals, "multi\nline")
+}
+
 func BenchmarkParse(b *testing.B) {
 	data, err := os.ReadFile("Packages")
 	if err != nil {
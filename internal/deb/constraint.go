@@ -0,0 +1,60 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VersionConstraint restricts package versions by relating them to a
+// reference version, as in "<< 2.36" or ">= 1.0-1".
+type VersionConstraint struct {
+	Op      string
+	Version string
+}
+
+// The relations follow the ones in Debian package relationships, with "<"
+// and ">" also accepted as the strict "<<" and ">>" respectively.
+var constraintOps = []string{"<<", "<=", ">=", ">>", "=", "<", ">"}
+
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	constraint = strings.TrimSpace(constraint)
+	for _, op := range constraintOps {
+		if !strings.HasPrefix(constraint, op) {
+			continue
+		}
+		version := strings.TrimSpace(constraint[len(op):])
+		if version == "" || strings.ContainsAny(version, " \t") {
+			break
+		}
+		switch op {
+		case "<":
+			op = "<<"
+		case ">":
+			op = ">>"
+		}
+		return &VersionConstraint{Op: op, Version: version}, nil
+	}
+	return nil, fmt.Errorf("invalid version constraint: %q", constraint)
+}
+
+// Match reports whether version satisfies the constraint.
+func (c *VersionConstraint) Match(version string) bool {
+	cmp := CompareVersions(version, c.Version)
+	switch c.Op {
+	case "<<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "=":
+		return cmp == 0
+	case ">=":
+		return cmp >= 0
+	case ">>":
+		return cmp > 0
+	}
+	return false
+}
+
+func (c *VersionConstraint) String() string {
+	return c.Op + " " + c.Version
+}
@@ -0,0 +1,78 @@
+package deb_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/deb"
+)
+
+var versionConstraintTests = []struct {
+	constraint string
+	parsed     string
+	match      []string
+	mismatch   []string
+	error      string
+}{{
+	constraint: "<< 2.36",
+	parsed:     "<< 2.36",
+	match:      []string{"2.35", "2.36~rc1", "1.0"},
+	mismatch:   []string{"2.36", "2.36-1", "3"},
+}, {
+	constraint: "< 2.36",
+	parsed:     "<< 2.36",
+	match:      []string{"2.35-0ubuntu3.1"},
+	mismatch:   []string{"2.36"},
+}, {
+	constraint: "<=2.36",
+	parsed:     "<= 2.36",
+	match:      []string{"2.36", "2.35"},
+	mismatch:   []string{"2.36-1"},
+}, {
+	constraint: "= 1.0-1",
+	parsed:     "= 1.0-1",
+	match:      []string{"1.0-1"},
+	mismatch:   []string{"1.0", "1.0-2"},
+}, {
+	constraint: " >= 1.0 ",
+	parsed:     ">= 1.0",
+	match:      []string{"1.0", "1.0-1", "2"},
+	mismatch:   []string{"0.9"},
+}, {
+	constraint: ">> 1.0",
+	parsed:     ">> 1.0",
+	match:      []string{"1.0-1"},
+	mismatch:   []string{"1.0"},
+}, {
+	constraint: "> 1.0",
+	parsed:     ">> 1.0",
+	match:      []string{"1.1"},
+	mismatch:   []string{"1.0"},
+}, {
+	constraint: "1.0",
+	error:      `invalid version constraint: "1.0"`,
+}, {
+	constraint: ">=",
+	error:      `invalid version constraint: ">="`,
+}, {
+	constraint: "= 1.0 2.0",
+	error:      `invalid version constraint: "= 1.0 2.0"`,
+}}
+
+func (s *S) TestVersionConstraint(c *C) {
+	for _, test := range versionConstraintTests {
+		c.Logf("Constraint: %q", test.constraint)
+		constraint, err := deb.ParseVersionConstraint(test.constraint)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(constraint.String(), Equals, test.parsed)
+		for _, version := range test.match {
+			c.Assert(constraint.Match(version), Equals, true, Commentf("version %s", version))
+		}
+		for _, version := range test.mismatch {
+			c.Assert(constraint.Match(version), Equals, false, Commentf("version %s", version))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package deb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blakesmith/ar"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ReadControl returns the content of the control file in the package.
+func ReadControl(pkgReader io.Reader) (data []byte, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot read package control file: %w", err)
+		}
+	}()
+
+	arReader := ar.NewReader(pkgReader)
+	var controlReader io.Reader
+	for controlReader == nil {
+		arHeader, err := arReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no control payload")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch arHeader.Name {
+		case "control.tar":
+			controlReader = arReader
+		case "control.tar.gz":
+			gzipReader, err := gzip.NewReader(arReader)
+			if err != nil {
+				return nil, err
+			}
+			defer gzipReader.Close()
+			controlReader = gzipReader
+		case "control.tar.xz":
+			xzReader, err := xz.NewReader(arReader)
+			if err != nil {
+				return nil, err
+			}
+			controlReader = xzReader
+		case "control.tar.zst":
+			zstdReader, err := zstd.NewReader(arReader)
+			if err != nil {
+				return nil, err
+			}
+			defer zstdReader.Close()
+			controlReader = zstdReader
+		}
+	}
+
+	tarReader := tar.NewReader(controlReader)
+	for {
+		tarHeader, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no control file in control payload")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(tarHeader.Name, "./") == "control" {
+			return io.ReadAll(tarReader)
+		}
+	}
+}
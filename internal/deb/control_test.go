@@ -0,0 +1,27 @@
+package deb_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var testControl = `Package: test-package
+Version: 1.0
+Architecture: amd64
+`
+
+func (s *S) TestReadControl(c *C) {
+	pkgData := testutil.MustMakeDebWithControl(testControl, testutil.TestPackageEntries)
+	data, err := deb.ReadControl(bytes.NewReader(pkgData))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testControl)
+}
+
+func (s *S) TestReadControlMissing(c *C) {
+	_, err := deb.ReadControl(bytes.NewReader(testutil.PackageData["test-package"]))
+	c.Assert(err, ErrorMatches, "cannot read package control file: no control payload")
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/canonical/chisel/internal/fsutil"
 	"github.com/canonical/chisel/internal/strdist"
+	"github.com/canonical/chisel/internal/tarutil"
 )
 
 type ExtractOptions struct {
@@ -62,6 +63,11 @@ func getValidOptions(options *ExtractOptions) (*ExtractOptions, error) {
 	return options, nil
 }
 
+// Extract extracts the selected paths from the package. Hard links selected
+// without their targets are created as copies of the targets, whose content
+// is read in a second pass over the package. When pkgReader does not
+// implement io.Seeker, the package is spooled to a temporary file while
+// reading it so that it may be read again.
 func Extract(pkgReader io.Reader, options *ExtractOptions) (err error) {
 	defer func() {
 		if err != nil {
@@ -83,43 +89,99 @@ func Extract(pkgReader io.Reader, options *ExtractOptions) (err error) {
 		return err
 	}
 
+	packageReader := pkgReader
+	seeker, seekable := pkgReader.(io.ReadSeeker)
+	var spool *os.File
+	if !seekable {
+		spool, err = os.CreateTemp("", "chisel-deb-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+		packageReader = io.TeeReader(pkgReader, spool)
+		seeker = spool
+	}
+
+	dataReader, closeData, err := openData(packageReader)
+	if err != nil {
+		return err
+	}
+	hardLinks, err := extractData(dataReader, validOpts)
+	closeData()
+	if err != nil || len(hardLinks) == 0 {
+		return err
+	}
+
+	// Some hard links were selected without their targets, so the content
+	// of the targets must be read again to materialise them as copies.
+	if spool != nil {
+		// Complete the spooled copy with what was not read yet.
+		if _, err := io.Copy(spool, pkgReader); err != nil {
+			return err
+		}
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dataReader, closeData, err = openData(seeker)
+	if err != nil {
+		return err
+	}
+	defer closeData()
+	return extractHardLinkCopies(dataReader, hardLinks, validOpts)
+}
+
+// openData returns a reader for the data payload of the package, and a
+// function that must be called once the reader is no longer needed.
+func openData(pkgReader io.Reader) (io.Reader, func(), error) {
 	arReader := ar.NewReader(pkgReader)
-	var dataReader io.Reader
-	for dataReader == nil {
+	for {
 		arHeader, err := arReader.Next()
 		if err == io.EOF {
-			return fmt.Errorf("no data payload")
+			return nil, nil, fmt.Errorf("no data payload")
 		}
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		switch arHeader.Name {
 		case "data.tar.gz":
 			gzipReader, err := gzip.NewReader(arReader)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			defer gzipReader.Close()
-			dataReader = gzipReader
+			return gzipReader, func() { gzipReader.Close() }, nil
 		case "data.tar.xz":
 			xzReader, err := xz.NewReader(arReader)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			dataReader = xzReader
+			return xzReader, func() {}, nil
 		case "data.tar.zst":
 			zstdReader, err := zstd.NewReader(arReader)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			defer zstdReader.Close()
-			dataReader = zstdReader
+			return zstdReader, zstdReader.Close, nil
 		}
 	}
-	return extractData(dataReader, validOpts)
 }
 
-func extractData(dataReader io.Reader, options *ExtractOptions) error {
+// hardLinkCopy is a hard link selected for extraction whose target was not
+// extracted, and which is therefore materialised as a copy of the target.
+type hardLinkCopy struct {
+	sourcePath   string
+	targetPath   string
+	extractInfos []ExtractInfo
+	options      *fsutil.CreateOptions
+}
+
+// extractData extracts the selected entries from the data tarball, and
+// returns the hard links that must be materialised as copies because their
+// targets were not extracted.
+func extractData(dataReader io.Reader, options *ExtractOptions) ([]*hardLinkCopy, error) {
 
 	oldUmask := syscall.Umask(0)
 	defer func() {
@@ -143,6 +205,11 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 	// before the entry for the file itself. This is the case for .deb files but
 	// not for all tarballs.
 	tarDirMode := make(map[string]fs.FileMode)
+	tarDirHeader := make(map[string]*tar.Header)
+	// Regular files are mapped to their first target path so that hard
+	// links to them, which appear later in the tarball, may be created.
+	extracted := make(map[string]string)
+	var hardLinks []*hardLinkCopy
 	tarReader := tar.NewReader(dataReader)
 	for {
 		tarHeader, err := tarReader.Next()
@@ -150,7 +217,7 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		sourcePath := tarHeader.Name
@@ -165,6 +232,7 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 		sourceIsDir := sourcePath[len(sourcePath)-1] == '/'
 		if sourceIsDir {
 			tarDirMode[sourcePath] = tarHeader.FileInfo().Mode()
+			tarDirHeader[sourcePath] = tarHeader
 		}
 
 		// Find all globs and copies that require this source, and map them by
@@ -201,12 +269,13 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 			// is speed over memory efficiency.
 			data, err := io.ReadAll(tarReader)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			contentCache = data
 		}
 
 		var pathReader io.Reader = tarReader
+		tarMode := tarHeader.Mode
 		for targetPath, extractInfos := range targetPaths {
 			if contentIsCached {
 				pathReader = bytes.NewReader(contentCache)
@@ -217,9 +286,10 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 					if mode < extractInfo.Mode {
 						mode, extractInfo.Mode = extractInfo.Mode, mode
 					}
-					return fmt.Errorf("path %s requested twice with diverging mode: 0%03o != 0%03o", targetPath, mode, extractInfo.Mode)
+					return nil, fmt.Errorf("path %s requested twice with diverging mode: 0%03o != 0%03o", targetPath, mode, extractInfo.Mode)
 				}
 			}
+			tarHeader.Mode = tarMode
 			if mode != 0 {
 				tarHeader.Mode = int64(mode)
 			}
@@ -239,10 +309,14 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 					Path:        filepath.Join(options.TargetDir, path),
 					Mode:        mode,
 					MakeParents: true,
+					MTime:       tarDirHeader[path].ModTime,
+					UID:         tarDirHeader[path].Uid,
+					GID:         tarDirHeader[path].Gid,
+					Xattrs:      tarutil.Xattrs(tarDirHeader[path]),
 				}
 				err := options.Create(nil, createOptions)
 				if err != nil {
-					return err
+					return nil, err
 				}
 			}
 			// Create the entry itself.
@@ -252,10 +326,37 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 				Data:        pathReader,
 				Link:        tarHeader.Linkname,
 				MakeParents: true,
+				MTime:       tarHeader.ModTime,
+				UID:         tarHeader.Uid,
+				GID:         tarHeader.Gid,
+				Xattrs:      tarutil.Xattrs(tarHeader),
+				Major:       uint32(tarHeader.Devmajor),
+				Minor:       uint32(tarHeader.Devminor),
+			}
+			if tarHeader.Typeflag == tar.TypeLink {
+				// Hard links share the mode of their target, so a link with
+				// its own mode is materialised as a copy as well.
+				linkSource := strings.TrimPrefix(tarHeader.Linkname, ".")
+				linkPath, ok := extracted[linkSource]
+				if ok && mode == 0 {
+					createOptions.Data = nil
+					createOptions.Link = linkPath
+				} else {
+					hardLinks = append(hardLinks, &hardLinkCopy{
+						sourcePath:   linkSource,
+						targetPath:   targetPath,
+						extractInfos: extractInfos,
+						options:      createOptions,
+					})
+					continue
+				}
 			}
 			err := options.Create(extractInfos, createOptions)
 			if err != nil {
-				return err
+				return nil, err
+			}
+			if tarHeader.Typeflag == tar.TypeReg && extracted[sourcePath] == "" {
+				extracted[sourcePath] = createOptions.Path
 			}
 		}
 	}
@@ -266,13 +367,68 @@ func extractData(dataReader io.Reader, options *ExtractOptions) error {
 			pendingList = append(pendingList, pendingPath)
 		}
 		if len(pendingList) == 1 {
-			return fmt.Errorf("no content at %s", pendingList[0])
+			return nil, fmt.Errorf("no content at %s", pendingList[0])
 		} else {
 			sort.Strings(pendingList)
-			return fmt.Errorf("no content at:\n- %s", strings.Join(pendingList, "\n- "))
+			return nil, fmt.Errorf("no content at:\n- %s", strings.Join(pendingList, "\n- "))
+		}
+	}
+
+	return hardLinks, nil
+}
+
+// extractHardLinkCopies creates the provided hard links as regular files
+// holding the content of their targets in the data tarball.
+func extractHardLinkCopies(dataReader io.Reader, hardLinks []*hardLinkCopy, options *ExtractOptions) error {
+	oldUmask := syscall.Umask(0)
+	defer func() {
+		syscall.Umask(oldUmask)
+	}()
+
+	pending := make(map[string][]*hardLinkCopy)
+	for _, hardLink := range hardLinks {
+		pending[hardLink.sourcePath] = append(pending[hardLink.sourcePath], hardLink)
+	}
+	tarReader := tar.NewReader(dataReader)
+	for len(pending) > 0 {
+		tarHeader, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sourcePath := strings.TrimPrefix(tarHeader.Name, ".")
+		links, ok := pending[sourcePath]
+		if !ok || tarHeader.Typeflag != tar.TypeReg {
+			continue
+		}
+		delete(pending, sourcePath)
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			createOptions := *link.options
+			createOptions.Data = bytes.NewReader(data)
+			createOptions.Link = ""
+			err := options.Create(link.extractInfos, &createOptions)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	if len(pending) > 0 {
+		var missing []*hardLinkCopy
+		for _, links := range pending {
+			missing = append(missing, links...)
+		}
+		sort.Slice(missing, func(i, j int) bool {
+			return missing[i].targetPath < missing[j].targetPath
+		})
+		return fmt.Errorf("cannot extract hard link %s: no content at %s", missing[0].targetPath, missing[0].sourcePath)
+	}
 	return nil
 }
 
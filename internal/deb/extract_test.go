@@ -2,6 +2,8 @@ package deb_test
 
 import (
 	"bytes"
+	"io"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -24,6 +26,14 @@ type extractTest struct {
 	error      string
 }
 
+var hardLinkPackage = testutil.MustMakeDeb([]testutil.TarEntry{
+	testutil.Dir(0755, "./"),
+	testutil.Dir(0755, "./usr/"),
+	testutil.Dir(0755, "./usr/bin/"),
+	testutil.Reg(0755, "./usr/bin/perl5.34.0", "perl"),
+	testutil.Hlk(0755, "./usr/bin/perl", "./usr/bin/perl5.34.0"),
+})
+
 var extractTests = []extractTest{{
 	summary: "Extract nothing",
 	pkgdata: testutil.PackageData["test-package"],
@@ -352,6 +362,55 @@ var extractTests = []extractTest{{
 		},
 	},
 	error: `cannot extract from package "test-package": path /dir/ requested twice with diverging mode: 0777 != 0000`,
+}, {
+	summary: "Hard link extracted with its target",
+	pkgdata: hardLinkPackage,
+	options: deb.ExtractOptions{
+		Extract: map[string][]deb.ExtractInfo{
+			"/usr/bin/perl*": []deb.ExtractInfo{{
+				Path: "/usr/bin/perl*",
+			}},
+		},
+	},
+	result: map[string]string{
+		"/usr/":               "dir 0755",
+		"/usr/bin/":           "dir 0755",
+		"/usr/bin/perl":       "file 0755 f0c929a9",
+		"/usr/bin/perl5.34.0": "file 0755 f0c929a9",
+	},
+}, {
+	summary: "Hard link without its target is extracted as a copy",
+	pkgdata: hardLinkPackage,
+	options: deb.ExtractOptions{
+		Extract: map[string][]deb.ExtractInfo{
+			"/usr/bin/perl": []deb.ExtractInfo{{
+				Path: "/usr/bin/perl",
+			}, {
+				Path: "/usr/bin/perl-copy",
+				Mode: 0700,
+			}},
+		},
+	},
+	result: map[string]string{
+		"/usr/":              "dir 0755",
+		"/usr/bin/":          "dir 0755",
+		"/usr/bin/perl":      "file 0755 f0c929a9",
+		"/usr/bin/perl-copy": "file 0700 f0c929a9",
+	},
+}, {
+	summary: "Hard link without its target in the package",
+	pkgdata: testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Hlk(0755, "./perl", "./missing"),
+	}),
+	options: deb.ExtractOptions{
+		Extract: map[string][]deb.ExtractInfo{
+			"/perl": []deb.ExtractInfo{{
+				Path: "/perl",
+			}},
+		},
+	},
+	error: `cannot extract from package "test-package": cannot extract hard link /perl: no content at /missing`,
 }}
 
 func (s *S) TestExtract(c *C) {
@@ -377,7 +436,7 @@ func (s *S) TestExtract(c *C) {
 			test.hackopt(&options)
 		}
 
-		err := deb.Extract(bytes.NewBuffer(test.pkgdata), &options)
+		err := deb.Extract(bytes.NewReader(test.pkgdata), &options)
 		if test.error != "" {
 			c.Assert(err, ErrorMatches, test.error)
 			continue
@@ -402,6 +461,82 @@ func (s *S) TestExtract(c *C) {
 	}
 }
 
+func (s *S) TestExtractHardLinks(c *C) {
+	dir := c.MkDir()
+	options := deb.ExtractOptions{
+		Package:   "test-package",
+		TargetDir: dir,
+		Extract: map[string][]deb.ExtractInfo{
+			"/usr/bin/perl5.34.0": []deb.ExtractInfo{{
+				Path: "/usr/bin/perl5.34.0",
+			}},
+			"/usr/bin/perl": []deb.ExtractInfo{{
+				Path: "/usr/bin/perl",
+			}},
+		},
+	}
+	err := deb.Extract(bytes.NewReader(hardLinkPackage), &options)
+	c.Assert(err, IsNil)
+
+	target, err := os.Stat(filepath.Join(dir, "usr/bin/perl5.34.0"))
+	c.Assert(err, IsNil)
+	link, err := os.Stat(filepath.Join(dir, "usr/bin/perl"))
+	c.Assert(err, IsNil)
+	c.Assert(os.SameFile(target, link), Equals, true)
+
+	// Copies are materialised by reading the package twice, from a spooled
+	// copy of it when the package reader cannot seek.
+	delete(options.Extract, "/usr/bin/perl5.34.0")
+	for _, pkgReader := range []io.Reader{bytes.NewReader(hardLinkPackage), bytes.NewBuffer(hardLinkPackage)} {
+		dir := c.MkDir()
+		options.TargetDir = dir
+		err = deb.Extract(pkgReader, &options)
+		c.Assert(err, IsNil)
+		c.Assert(testutil.TreeDump(dir), DeepEquals, map[string]string{
+			"/usr/":         "dir 0755",
+			"/usr/bin/":     "dir 0755",
+			"/usr/bin/perl": "file 0755 f0c929a9",
+		})
+	}
+}
+
+func (s *S) TestExtractXattrs(c *C) {
+	dir := testutil.Dir(0755, "./dir/")
+	dir.Header.PAXRecords = map[string]string{"SCHILY.xattr.user.dir": "dir"}
+	file := testutil.Reg(0755, "./dir/ping", "ping")
+	file.Header.PAXRecords = map[string]string{
+		"SCHILY.xattr.security.capability": "caps",
+		"comment":                          "not an xattr",
+	}
+	pkgData := testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		dir,
+		file,
+	})
+
+	xattrs := make(map[string]map[string]string)
+	targetDir := c.MkDir()
+	options := deb.ExtractOptions{
+		Package:   "test-package",
+		TargetDir: targetDir,
+		Extract: map[string][]deb.ExtractInfo{
+			"/dir/ping": []deb.ExtractInfo{{
+				Path: "/dir/ping",
+			}},
+		},
+		Create: func(_ []deb.ExtractInfo, o *fsutil.CreateOptions) error {
+			xattrs[strings.TrimPrefix(o.Path, targetDir)] = o.Xattrs
+			return nil
+		},
+	}
+	err := deb.Extract(bytes.NewReader(pkgData), &options)
+	c.Assert(err, IsNil)
+	c.Assert(xattrs, DeepEquals, map[string]map[string]string{
+		"/dir":      {"user.dir": "dir"},
+		"/dir/ping": {"security.capability": "caps"},
+	})
+}
+
 var extractCreateCallbackTests = []struct {
 	summary string
 	pkgdata []byte
@@ -0,0 +1,126 @@
+package fsutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CapabilityXattr is the extended attribute holding file capabilities.
+const CapabilityXattr = "security.capability"
+
+var capabilityNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+const (
+	vfsCapRevision2      = 0x02000000
+	vfsCapFlagsEffective = 0x000001
+)
+
+// ParseCapabilities parses file capabilities in the textual form used by
+// setcap, such as "cap_net_raw+ep" or "cap_chown,cap_fowner=p", and returns
+// them encoded as the value of the security.capability extended attribute.
+//
+// As enforced by the kernel, capabilities are either all effective or none is.
+func ParseCapabilities(text string) (string, error) {
+	var permitted, inheritable uint64
+	var effective, nonEffective bool
+	clauses := strings.Fields(text)
+	if len(clauses) == 0 {
+		return "", fmt.Errorf("invalid capabilities %q: empty", text)
+	}
+	for _, clause := range clauses {
+		i := strings.IndexAny(clause, "=+")
+		if i <= 0 || i == len(clause)-1 {
+			return "", fmt.Errorf("invalid capabilities %q: expected <names>=<flags> or <names>+<flags>", text)
+		}
+		var caps uint64
+		for _, name := range strings.Split(clause[:i], ",") {
+			index := -1
+			for j, capName := range capabilityNames {
+				if strings.EqualFold(name, capName) {
+					index = j
+					break
+				}
+			}
+			if index < 0 {
+				return "", fmt.Errorf("invalid capabilities %q: unknown capability %q", text, name)
+			}
+			caps |= 1 << index
+		}
+		clauseEffective := false
+		for _, flag := range clause[i+1:] {
+			switch flag {
+			case 'e':
+				clauseEffective = true
+			case 'p':
+				permitted |= caps
+			case 'i':
+				inheritable |= caps
+			default:
+				return "", fmt.Errorf("invalid capabilities %q: unknown flag %q", text, flag)
+			}
+		}
+		if clauseEffective {
+			effective = true
+		} else {
+			nonEffective = true
+		}
+	}
+	if effective && nonEffective {
+		return "", fmt.Errorf("invalid capabilities %q: capabilities must be either all or none effective", text)
+	}
+
+	magic := uint32(vfsCapRevision2)
+	if effective {
+		magic |= vfsCapFlagsEffective
+	}
+	data := make([]byte, 20)
+	binary.LittleEndian.PutUint32(data[0:], magic)
+	binary.LittleEndian.PutUint32(data[4:], uint32(permitted))
+	binary.LittleEndian.PutUint32(data[8:], uint32(inheritable))
+	binary.LittleEndian.PutUint32(data[12:], uint32(permitted>>32))
+	binary.LittleEndian.PutUint32(data[16:], uint32(inheritable>>32))
+	return string(data), nil
+}
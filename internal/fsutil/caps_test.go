@@ -0,0 +1,55 @@
+package fsutil_test
+
+import (
+	"encoding/hex"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/fsutil"
+)
+
+var parseCapabilitiesTests = []struct {
+	text   string
+	result string
+	error  string
+}{{
+	text:   "cap_net_raw+ep",
+	result: "0100000200200000000000000000000000000000",
+}, {
+	text:   "cap_net_raw=p",
+	result: "0000000200200000000000000000000000000000",
+}, {
+	text:   "cap_chown,CAP_FOWNER=pi cap_net_bind_service+i",
+	result: "0000000209000000090400000000000000000000",
+}, {
+	text:   "cap_checkpoint_restore+ep",
+	result: "0100000200000000000000000001000000000000",
+}, {
+	text:  "",
+	error: `invalid capabilities "": empty`,
+}, {
+	text:  "cap_net_raw",
+	error: `invalid capabilities "cap_net_raw": expected <names>=<flags> or <names>\+<flags>`,
+}, {
+	text:  "cap_foo+ep",
+	error: `invalid capabilities "cap_foo\+ep": unknown capability "cap_foo"`,
+}, {
+	text:  "cap_net_raw+x",
+	error: `invalid capabilities "cap_net_raw\+x": unknown flag 'x'`,
+}, {
+	text:  "cap_net_raw+ep cap_chown+p",
+	error: `invalid capabilities "cap_net_raw\+ep cap_chown\+p": capabilities must be either all or none effective`,
+}}
+
+func (s *S) TestParseCapabilities(c *C) {
+	for _, test := range parseCapabilitiesTests {
+		c.Logf("Capabilities: %q", test.text)
+		value, err := fsutil.ParseCapabilities(test.text)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(hex.EncodeToString([]byte(value)), Equals, test.result)
+	}
+}
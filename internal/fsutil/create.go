@@ -9,28 +9,60 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 type CreateOptions struct {
 	Path string
 	Mode fs.FileMode
 	Data io.Reader
+	// Link is the target of symlinks. When set for a regular file, a hard
+	// link to the existing entry at Link is created instead, and Data is
+	// ignored.
 	Link string
 	// If MakeParents is true, missing parent directories of Path are
 	// created with permissions 0755.
 	MakeParents bool
+	// If MTime is not zero, it is set as the modification time of the
+	// entry, without following symlinks.
+	MTime time.Time
+	// UID and GID are the owner of the entry. As with Mode, they are
+	// only set when the entry is created, and on disk only when running
+	// as root.
+	UID int
+	GID int
+	// Xattrs holds extended attributes to set on the entry, indexed by
+	// name. Attributes which cannot be set due to missing privileges are
+	// ignored when not running as root.
+	Xattrs map[string]string
+	// Major and Minor are the device numbers of character and block
+	// devices. Such devices are only created when running as root, and
+	// are otherwise just returned as an entry.
+	Major uint32
+	Minor uint32
 }
 
 type Entry struct {
-	Path string
-	Mode fs.FileMode
-	Hash string
-	Size int
-	Link string
+	Path   string
+	Mode   fs.FileMode
+	Hash   string
+	Size   int
+	Link   string
+	UID    int
+	GID    int
+	Xattrs map[string]string
+	Major  uint32
+	Minor  uint32
 }
 
 // Create creates a filesystem entry according to the provided options and returns
-// the information about the created entry.
+// the information about the created entry. Block and character devices can only
+// be created with root privileges, so without them they are skipped, but the
+// entry describing them is still returned.
 func Create(options *CreateOptions) (*Entry, error) {
 	rp := &readerProxy{inner: options.Data, h: sha256.New()}
 	// Use the proxy instead of the raw Reader.
@@ -40,6 +72,8 @@ func Create(options *CreateOptions) (*Entry, error) {
 
 	var err error
 	var hash string
+	_, err = os.Lstat(o.Path)
+	existed := err == nil
 	if o.MakeParents {
 		if err := os.MkdirAll(filepath.Dir(o.Path), 0755); err != nil {
 			return nil, err
@@ -48,12 +82,32 @@ func Create(options *CreateOptions) (*Entry, error) {
 
 	switch o.Mode & fs.ModeType {
 	case 0:
-		err = createFile(o)
+		if o.Link != "" {
+			err = createHardLink(o)
+			if err == nil {
+				err = hashFile(o.Path, rp)
+			}
+		} else {
+			err = createFile(o)
+		}
 		hash = hex.EncodeToString(rp.h.Sum(nil))
 	case fs.ModeDir:
 		err = createDir(o)
 	case fs.ModeSymlink:
 		err = createSymlink(o)
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice, fs.ModeNamedPipe:
+		if o.Mode&fs.ModeDevice != 0 && os.Geteuid() != 0 {
+			debugf("Skipping device without privileges: %s (%d:%d)", o.Path, o.Major, o.Minor)
+			return &Entry{
+				Path:  o.Path,
+				Mode:  o.Mode,
+				UID:   o.UID,
+				GID:   o.GID,
+				Major: o.Major,
+				Minor: o.Minor,
+			}, nil
+		}
+		err = createDevice(o)
 	default:
 		err = fmt.Errorf("unsupported file type: %s", o.Path)
 	}
@@ -65,16 +119,65 @@ func Create(options *CreateOptions) (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
+	uid, gid := o.UID, o.GID
+	if stat, ok := s.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+		// Hard links share the owner of their target.
+		hardLink := o.Link != "" && o.Mode&fs.ModeType == 0
+		if (!existed && !hardLink) || s.Mode()&fs.ModeSymlink != 0 {
+			s, err = setOwner(o.Path, s, int(stat.Uid), int(stat.Gid), o.UID, o.GID)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+	// Changing the owner or the content drops capabilities, so extended
+	// attributes are only set afterwards.
+	if err := setXattrs(o.Path, o.Xattrs); err != nil {
+		return nil, err
+	}
+	if !o.MTime.IsZero() {
+		if err := setMTime(o.Path, o.MTime); err != nil {
+			return nil, err
+		}
+	}
+
 	entry := &Entry{
-		Path: o.Path,
-		Mode: s.Mode(),
-		Hash: hash,
-		Size: rp.size,
-		Link: o.Link,
+		Path:   o.Path,
+		Mode:   s.Mode(),
+		Hash:   hash,
+		Size:   rp.size,
+		Link:   o.Link,
+		UID:    uid,
+		GID:    gid,
+		Xattrs: o.Xattrs,
+		Major:  o.Major,
+		Minor:  o.Minor,
 	}
 	return entry, nil
 }
 
+// setOwner changes the owner of the entry at path from oldUID and oldGID to
+// uid and gid, and returns the resulting file information.
+func setOwner(path string, info fs.FileInfo, oldUID, oldGID, uid, gid int) (fs.FileInfo, error) {
+	if uid == oldUID && gid == oldGID {
+		return info, nil
+	}
+	err := os.Lchown(path, uid, gid)
+	if err != nil {
+		return nil, err
+	}
+	// Changing the owner clears the setuid and setgid bits.
+	if info.Mode()&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+		err = os.Chmod(path, info.Mode())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return os.Lstat(path)
+}
+
 func createDir(o *CreateOptions) error {
 	debugf("Creating directory: %s (mode %#o)", o.Path, o.Mode)
 	err := os.Mkdir(o.Path, o.Mode)
@@ -121,6 +224,106 @@ func createSymlink(o *CreateOptions) error {
 	return os.Symlink(o.Link, o.Path)
 }
 
+func createHardLink(o *CreateOptions) error {
+	debugf("Creating hard link: %s => %s", o.Path, o.Link)
+	err := os.Link(o.Link, o.Path)
+	if !os.IsExist(err) {
+		return err
+	}
+	linkInfo, err := os.Lstat(o.Link)
+	if err != nil {
+		return err
+	}
+	pathInfo, err := os.Lstat(o.Path)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(linkInfo, pathInfo) {
+		return nil
+	}
+	err = os.Remove(o.Path)
+	if err != nil {
+		return err
+	}
+	return os.Link(o.Link, o.Path)
+}
+
+// hashFile reads the content of the file at path through rp, so that its
+// hash and size are recorded.
+func hashFile(path string, rp *readerProxy) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rp.inner = file
+	_, err = io.Copy(io.Discard, rp)
+	return err
+}
+
+func createDevice(o *CreateOptions) error {
+	debugf("Creating device: %s (mode %#o, %d:%d)", o.Path, o.Mode, o.Major, o.Minor)
+	mode := uint32(o.Mode.Perm())
+	switch o.Mode.Type() {
+	case fs.ModeNamedPipe:
+		mode |= unix.S_IFIFO
+	case fs.ModeDevice | fs.ModeCharDevice:
+		mode |= unix.S_IFCHR
+	default:
+		mode |= unix.S_IFBLK
+	}
+	dev := unix.Mkdev(o.Major, o.Minor)
+	err := unix.Mknod(o.Path, mode, int(dev))
+	if err == unix.EEXIST {
+		var stat unix.Stat_t
+		err = unix.Lstat(o.Path, &stat)
+		if err == nil && stat.Mode&unix.S_IFMT == mode&unix.S_IFMT && stat.Rdev == dev {
+			return nil
+		}
+		if err := os.Remove(o.Path); err != nil {
+			return err
+		}
+		err = unix.Mknod(o.Path, mode, int(dev))
+	}
+	if err != nil {
+		return &fs.PathError{Op: "mknod", Path: o.Path, Err: err}
+	}
+	return nil
+}
+
+// setXattrs sets the provided extended attributes on the entry at path,
+// without following symlinks.
+func setXattrs(path string, xattrs map[string]string) error {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := unix.Lsetxattr(path, name, []byte(xattrs[name]), 0)
+		if err == nil {
+			continue
+		}
+		if os.Geteuid() != 0 && (err == unix.EPERM || err == unix.EACCES || err == unix.ENOTSUP) {
+			debugf("Cannot set extended attribute %s on %s: %v", name, path, err)
+			continue
+		}
+		return &fs.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// setMTime sets both the access and modification times of the entry at path
+// to mtime, without following symlinks.
+func setMTime(path string, mtime time.Time) error {
+	ts := unix.NsecToTimespec(mtime.UnixNano())
+	err := unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return &fs.PathError{Op: "utimensat", Path: path, Err: err}
+	}
+	return nil
+}
+
 // readerProxy implements the io.Reader interface proxying the calls to its
 // inner io.Reader. On each read, the proxy keeps track of the file size and hash.
 type readerProxy struct {
@@ -137,3 +340,19 @@ func (rp *readerProxy) Read(p []byte) (n int, err error) {
 	rp.size += n
 	return n, err
 }
+
+// UnixPerm returns the permission bits of mode in their traditional unix
+// representation, including the setuid, setgid and sticky bits.
+func UnixPerm(mode fs.FileMode) (perm uint32) {
+	perm = uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
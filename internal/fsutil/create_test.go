@@ -1,13 +1,15 @@
 package fsutil_test
 
 import (
-	"bytes"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"golang.org/x/sys/unix"
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/chisel/internal/fsutil"
@@ -24,7 +26,7 @@ type createTest struct {
 var createTests = []createTest{{
 	options: fsutil.CreateOptions{
 		Path:        "foo/bar",
-		Data:        bytes.NewBufferString("data1"),
+		Data:        strings.NewReader("data1"),
 		Mode:        0444,
 		MakeParents: true,
 	},
@@ -84,7 +86,7 @@ var createTests = []createTest{{
 		Path: "foo",
 		// Mode should be ignored for existing entry.
 		Mode: 0644,
-		Data: bytes.NewBufferString("changed"),
+		Data: strings.NewReader("changed"),
 	},
 	hackdir: func(c *C, dir string) {
 		c.Assert(os.WriteFile(filepath.Join(dir, "foo"), []byte("data"), 0666), IsNil)
@@ -113,6 +115,7 @@ func (s *S) TestCreate(c *C) {
 		}
 		options := test.options
 		options.Path = filepath.Join(dir, options.Path)
+		rewindData(c, &options)
 		entry, err := fsutil.Create(&options)
 
 		if test.error != "" {
@@ -133,3 +136,188 @@ func (s *S) TestCreate(c *C) {
 		c.Assert(testutil.TreeDumpEntry(entry), DeepEquals, test.result[slashPath])
 	}
 }
+
+// rewindData allows the table data to be read by several tests.
+func rewindData(c *C, options *fsutil.CreateOptions) {
+	if seeker, ok := options.Data.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *S) TestCreateMTime(c *C) {
+	mtime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir := c.MkDir()
+	for _, options := range []*fsutil.CreateOptions{{
+		Path: filepath.Join(dir, "file"),
+		Mode: 0644,
+		Data: strings.NewReader("data"),
+	}, {
+		Path: filepath.Join(dir, "dir"),
+		Mode: fs.ModeDir | 0755,
+	}, {
+		// The symlink itself is changed, not its missing target.
+		Path: filepath.Join(dir, "link"),
+		Mode: fs.ModeSymlink,
+		Link: "missing",
+	}} {
+		options.MTime = mtime
+		_, err := fsutil.Create(options)
+		c.Assert(err, IsNil)
+		info, err := os.Lstat(options.Path)
+		c.Assert(err, IsNil)
+		c.Assert(info.ModTime().Equal(mtime), Equals, true, Commentf("%s", options.Path))
+	}
+}
+
+func (s *S) TestCreateHardLink(c *C) {
+	dir := c.MkDir()
+	target := filepath.Join(dir, "target")
+	_, err := fsutil.Create(&fsutil.CreateOptions{
+		Path: target,
+		Mode: 0755,
+		Data: strings.NewReader("data"),
+	})
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(dir, "link"), []byte("other"), 0644)
+	c.Assert(err, IsNil)
+
+	// Creating the link twice keeps it, and existing files are replaced.
+	for i := 0; i < 2; i++ {
+		entry, err := fsutil.Create(&fsutil.CreateOptions{
+			Path: filepath.Join(dir, "link"),
+			Mode: 0644,
+			Link: target,
+		})
+		c.Assert(err, IsNil)
+		c.Assert(entry.Mode, Equals, fs.FileMode(0755))
+		c.Assert(entry.Link, Equals, target)
+		c.Assert(testutil.TreeDumpEntry(entry), Equals, "file 0755 3a6eb079")
+	}
+	targetInfo, err := os.Stat(target)
+	c.Assert(err, IsNil)
+	linkInfo, err := os.Stat(filepath.Join(dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(os.SameFile(targetInfo, linkInfo), Equals, true)
+
+	_, err = fsutil.Create(&fsutil.CreateOptions{
+		Path: filepath.Join(dir, "broken"),
+		Mode: 0644,
+		Link: filepath.Join(dir, "missing"),
+	})
+	c.Assert(err, ErrorMatches, `link .*/missing .*/broken: no such file or directory`)
+}
+
+func (s *S) TestCreateDevice(c *C) {
+	oldUmask := syscall.Umask(0)
+	defer func() {
+		syscall.Umask(oldUmask)
+	}()
+
+	dir := c.MkDir()
+	for _, options := range []*fsutil.CreateOptions{{
+		Path: filepath.Join(dir, "fifo"),
+		Mode: fs.ModeNamedPipe | 0600,
+	}, {
+		Path:  filepath.Join(dir, "null"),
+		Mode:  fs.ModeDevice | fs.ModeCharDevice | 0666,
+		Major: 1,
+		Minor: 3,
+	}, {
+		Path:  filepath.Join(dir, "sda"),
+		Mode:  fs.ModeDevice | 0660,
+		Major: 8,
+	}} {
+		// Creating devices twice keeps them.
+		for i := 0; i < 2; i++ {
+			entry, err := fsutil.Create(options)
+			c.Assert(err, IsNil)
+			c.Assert(entry.Mode, Equals, options.Mode)
+			c.Assert(entry.Major, Equals, options.Major)
+			c.Assert(entry.Minor, Equals, options.Minor)
+		}
+	}
+
+	expected := map[string]string{
+		"/fifo": "fifo 0600",
+		"/null": "char 0666 1:3",
+		"/sda":  "block 0660 8:0",
+	}
+	if os.Geteuid() != 0 {
+		// Devices are only created with privileges.
+		delete(expected, "/null")
+		delete(expected, "/sda")
+	}
+	c.Assert(testutil.TreeDump(dir), DeepEquals, expected)
+}
+
+func (s *S) TestCreateXattrs(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "file")
+	entry, err := fsutil.Create(&fsutil.CreateOptions{
+		Path:   path,
+		Mode:   0644,
+		Data:   strings.NewReader("data"),
+		Xattrs: map[string]string{"user.chisel": "value"},
+	})
+	if err != nil && strings.Contains(err.Error(), "operation not supported") {
+		c.Skip("extended attributes not supported by the filesystem")
+	}
+	c.Assert(err, IsNil)
+	c.Assert(entry.Xattrs, DeepEquals, map[string]string{"user.chisel": "value"})
+	data := make([]byte, 16)
+	n, err := unix.Lgetxattr(path, "user.chisel", data)
+	c.Assert(err, IsNil)
+	c.Assert(string(data[:n]), Equals, "value")
+}
+
+func (s *S) TestCreateOwner(c *C) {
+	if os.Geteuid() != 0 {
+		c.Skip("changing the owner requires root")
+	}
+	dir := c.MkDir()
+	for _, options := range []*fsutil.CreateOptions{{
+		Path: filepath.Join(dir, "file"),
+		Mode: fs.ModeSetuid | 0755,
+		Data: strings.NewReader("data"),
+	}, {
+		Path: filepath.Join(dir, "dir"),
+		Mode: fs.ModeDir | 0755,
+	}, {
+		Path: filepath.Join(dir, "link"),
+		Mode: fs.ModeSymlink,
+		Link: "missing",
+	}} {
+		options.UID = 102
+		options.GID = 104
+		entry, err := fsutil.Create(options)
+		c.Assert(err, IsNil)
+		c.Assert(entry.UID, Equals, 102)
+		c.Assert(entry.GID, Equals, 104)
+		info, err := os.Lstat(options.Path)
+		c.Assert(err, IsNil)
+		stat := info.Sys().(*syscall.Stat_t)
+		c.Assert(int(stat.Uid), Equals, 102)
+		c.Assert(int(stat.Gid), Equals, 104)
+		if options.Mode.Type() != fs.ModeSymlink {
+			// The setuid bit is kept.
+			c.Assert(info.Mode(), Equals, options.Mode)
+		}
+	}
+
+	// The owner of existing entries is not changed.
+	entry, err := fsutil.Create(&fsutil.CreateOptions{
+		Path: filepath.Join(dir, "file"),
+		Mode: 0644,
+		Data: strings.NewReader("changed"),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(entry.UID, Equals, 102)
+	c.Assert(entry.GID, Equals, 104)
+}
+
+func (s *S) TestUnixPerm(c *C) {
+	c.Assert(fsutil.UnixPerm(0755), Equals, uint32(0755))
+	c.Assert(fsutil.UnixPerm(fs.ModeDir|0700), Equals, uint32(0700))
+	c.Assert(fsutil.UnixPerm(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky|0644), Equals, uint32(07644))
+}
@@ -0,0 +1,49 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FS is a filesystem where entries are created and then inspected.
+type FS interface {
+	// Create creates an entry as described for the Create function.
+	Create(options *CreateOptions) (*Entry, error)
+	ReadFile(path string) ([]byte, error)
+	ReadDir(path string) ([]fs.DirEntry, error)
+	Readlink(path string) (string, error)
+	Remove(path string) error
+	// SetMTime sets the modification time of the entry at path, without
+	// following symlinks.
+	SetMTime(path string, mtime time.Time) error
+}
+
+// DiskFS is the FS backed by the system filesystem.
+var DiskFS FS = diskFS{}
+
+type diskFS struct{}
+
+func (diskFS) Create(options *CreateOptions) (*Entry, error) {
+	return Create(options)
+}
+
+func (diskFS) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (diskFS) ReadDir(path string) ([]fs.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+func (diskFS) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+func (diskFS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (diskFS) SetMTime(path string, mtime time.Time) error {
+	return setMTime(path, mtime)
+}
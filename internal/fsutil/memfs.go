@@ -0,0 +1,430 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/canonical/chisel/internal/tarutil"
+)
+
+// MemFS is an FS holding all of its entries in memory. Paths are absolute,
+// with "/" being the root of the filesystem, and symlinks are resolved
+// within the filesystem itself.
+type MemFS struct {
+	entries map[string]*memEntry
+}
+
+type memEntry struct {
+	mode   fs.FileMode
+	data   []byte
+	link   string
+	mtime  time.Time
+	uid    int
+	gid    int
+	xattrs map[string]string
+	major  uint32
+	minor  uint32
+}
+
+var _ FS = (*MemFS)(nil)
+
+// NewMemFS returns an empty MemFS holding only the root directory.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		entries: map[string]*memEntry{
+			"/": {mode: fs.ModeDir | 0755},
+		},
+	}
+}
+
+// maxSymlinks is the number of symlinks followed while resolving a path
+// before giving up, as done by Linux.
+const maxSymlinks = 40
+
+// resolve returns the path of the entry designated by path after following
+// the symlinks in its parent directories, and in its last component when
+// followLast is true.
+func (m *MemFS) resolve(path string, followLast bool) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("internal error: relative path in memory filesystem: %s", path)
+	}
+	links := 0
+	resolved := "/"
+	rest := splitPath(path)
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		current := filepath.Join(resolved, name)
+		entry, ok := m.entries[current]
+		if !ok || entry.mode.Type() != fs.ModeSymlink || (len(rest) == 0 && !followLast) {
+			resolved = current
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", &fs.PathError{Op: "lstat", Path: path, Err: syscall.ELOOP}
+		}
+		target := entry.link
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		rest = append(splitPath(target), rest...)
+		resolved = "/"
+	}
+	return resolved, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(filepath.Clean(path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// lookup returns the entry at path, following symlinks as done by resolve.
+func (m *MemFS) lookup(op, path string, followLast bool) (string, *memEntry, error) {
+	resolved, err := m.resolve(path, followLast)
+	if err != nil {
+		return "", nil, err
+	}
+	entry, ok := m.entries[resolved]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: path, Err: syscall.ENOENT}
+	}
+	return resolved, entry, nil
+}
+
+// checkParent checks that the parent of the resolved path is a directory.
+func (m *MemFS) checkParent(op, path, resolved string) error {
+	parent, ok := m.entries[filepath.Dir(resolved)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: path, Err: syscall.ENOENT}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: path, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (m *MemFS) mkdirAll(path string) error {
+	resolved, err := m.resolve(path, true)
+	if err != nil {
+		return err
+	}
+	current := "/"
+	for _, name := range splitPath(resolved) {
+		current = filepath.Join(current, name)
+		entry, ok := m.entries[current]
+		if !ok {
+			m.entries[current] = &memEntry{mode: fs.ModeDir | 0755}
+		} else if !entry.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) hasChildren(path string) bool {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for entryPath := range m.entries {
+		if strings.HasPrefix(entryPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create creates an entry with the same semantics as the Create function.
+func (m *MemFS) Create(options *CreateOptions) (*Entry, error) {
+	if options.MakeParents {
+		if err := m.mkdirAll(filepath.Dir(options.Path)); err != nil {
+			return nil, err
+		}
+	}
+	path, err := m.resolve(options.Path, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkParent("open", options.Path, path); err != nil {
+		return nil, err
+	}
+
+	var hash string
+	rp := &readerProxy{inner: options.Data, h: sha256.New()}
+	switch options.Mode & fs.ModeType {
+	case 0:
+		if options.Link != "" {
+			debugf("Creating hard link: %s => %s", options.Path, options.Link)
+			_, linked, err := m.lookup("link", options.Link, false)
+			if err != nil {
+				return nil, err
+			}
+			if linked.mode.IsDir() {
+				return nil, &fs.PathError{Op: "link", Path: options.Path, Err: syscall.EPERM}
+			}
+			if entry, ok := m.entries[path]; ok && entry.mode.IsDir() {
+				return nil, &fs.PathError{Op: "link", Path: options.Path, Err: syscall.EEXIST}
+			}
+			// Both paths share the same entry, as they share an inode on disk.
+			m.entries[path] = linked
+			rp.inner = bytes.NewReader(linked.data)
+			if _, err := io.Copy(io.Discard, rp); err != nil {
+				return nil, err
+			}
+			hash = hex.EncodeToString(rp.h.Sum(nil))
+			break
+		}
+		debugf("Writing file: %s (mode %#o)", options.Path, options.Mode)
+		target, err := m.resolve(options.Path, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.checkParent("open", options.Path, target); err != nil {
+			return nil, err
+		}
+		var data []byte
+		if options.Data != nil {
+			data, err = io.ReadAll(rp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		hash = hex.EncodeToString(rp.h.Sum(nil))
+		entry, ok := m.entries[target]
+		if !ok {
+			m.entries[target] = &memEntry{mode: options.Mode, data: data, uid: options.UID, gid: options.GID}
+		} else if entry.mode.IsDir() {
+			return nil, &fs.PathError{Op: "open", Path: options.Path, Err: syscall.EISDIR}
+		} else {
+			// As on disk, the mode of existing files is not updated.
+			entry.data = data
+		}
+	case fs.ModeDir:
+		debugf("Creating directory: %s (mode %#o)", options.Path, options.Mode)
+		if _, ok := m.entries[path]; !ok {
+			m.entries[path] = &memEntry{mode: options.Mode, uid: options.UID, gid: options.GID}
+		}
+	case fs.ModeSymlink:
+		debugf("Creating symlink: %s => %s", options.Path, options.Link)
+		entry, ok := m.entries[path]
+		if ok && (entry.mode.Type() != fs.ModeSymlink || entry.link != options.Link) {
+			if entry.mode.IsDir() && m.hasChildren(path) {
+				return nil, &fs.PathError{Op: "remove", Path: options.Path, Err: syscall.ENOTEMPTY}
+			}
+			ok = false
+		}
+		if !ok {
+			// As on disk, symlinks always have all permissions.
+			m.entries[path] = &memEntry{mode: fs.ModeSymlink | 0777, link: options.Link}
+		}
+		m.entries[path].uid = options.UID
+		m.entries[path].gid = options.GID
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice, fs.ModeNamedPipe:
+		debugf("Creating device: %s (mode %#o, %d:%d)", options.Path, options.Mode, options.Major, options.Minor)
+		entry, ok := m.entries[path]
+		if ok && (entry.mode.Type() != options.Mode.Type() || entry.major != options.Major || entry.minor != options.Minor) {
+			if entry.mode.IsDir() && m.hasChildren(path) {
+				return nil, &fs.PathError{Op: "remove", Path: options.Path, Err: syscall.ENOTEMPTY}
+			}
+			ok = false
+		}
+		if !ok {
+			m.entries[path] = &memEntry{
+				mode:  options.Mode,
+				uid:   options.UID,
+				gid:   options.GID,
+				major: options.Major,
+				minor: options.Minor,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file type: %s", options.Path)
+	}
+
+	if !options.MTime.IsZero() {
+		m.entries[path].mtime = options.MTime
+	}
+	for name, value := range options.Xattrs {
+		if m.entries[path].xattrs == nil {
+			m.entries[path].xattrs = make(map[string]string)
+		}
+		m.entries[path].xattrs[name] = value
+	}
+
+	entry := m.entries[path]
+	return &Entry{
+		Path:   options.Path,
+		Mode:   entry.mode,
+		Hash:   hash,
+		Size:   rp.size,
+		Link:   options.Link,
+		UID:    entry.uid,
+		GID:    entry.gid,
+		Xattrs: options.Xattrs,
+		Major:  entry.major,
+		Minor:  entry.minor,
+	}, nil
+}
+
+func (m *MemFS) ReadFile(path string) ([]byte, error) {
+	_, entry, err := m.lookup("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+	if entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), entry.data...), nil
+}
+
+func (m *MemFS) ReadDir(path string) ([]fs.DirEntry, error) {
+	resolved, entry, err := m.lookup("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: path, Err: syscall.ENOTDIR}
+	}
+	var dirEntries []fs.DirEntry
+	for entryPath, entry := range m.entries {
+		if entryPath != resolved && filepath.Dir(entryPath) == resolved {
+			dirEntries = append(dirEntries, fs.FileInfoToDirEntry(&memFileInfo{
+				name:  filepath.Base(entryPath),
+				entry: entry,
+			}))
+		}
+	}
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+func (m *MemFS) Readlink(path string) (string, error) {
+	_, entry, err := m.lookup("readlink", path, false)
+	if err != nil {
+		return "", err
+	}
+	if entry.mode.Type() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: syscall.EINVAL}
+	}
+	return entry.link, nil
+}
+
+func (m *MemFS) Remove(path string) error {
+	resolved, entry, err := m.lookup("remove", path, false)
+	if err != nil {
+		return err
+	}
+	if resolved == "/" {
+		return &fs.PathError{Op: "remove", Path: path, Err: syscall.EBUSY}
+	}
+	if entry.mode.IsDir() && m.hasChildren(resolved) {
+		return &fs.PathError{Op: "remove", Path: path, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.entries, resolved)
+	return nil
+}
+
+func (m *MemFS) SetMTime(path string, mtime time.Time) error {
+	_, entry, err := m.lookup("utimensat", path, false)
+	if err != nil {
+		return err
+	}
+	entry.mtime = mtime
+	return nil
+}
+
+// WriteTar writes all entries in the filesystem, except for the root
+// directory, as a tar archive ordered by path. Hard links are written as
+// links to the first of their paths in that order. Entries without a
+// modification time have it set to the Unix epoch, so that the same
+// content always results in the same archive.
+func (m *MemFS) WriteTar(w io.Writer) error {
+	paths := make([]string, 0, len(m.entries))
+	for path := range m.entries {
+		if path != "/" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	tw := tar.NewWriter(w)
+	// Paths sharing an entry are hard links to the first one written.
+	written := make(map[*memEntry]string)
+	for _, path := range paths {
+		entry := m.entries[path]
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(path, "/"),
+			Mode:    int64(UnixPerm(entry.mode)),
+			Uid:     entry.uid,
+			Gid:     entry.gid,
+			ModTime: entry.mtime,
+		}
+		if header.ModTime.IsZero() {
+			header.ModTime = time.Unix(0, 0)
+		}
+		tarutil.SetXattrs(header, entry.xattrs)
+		data := entry.data
+		switch entry.mode.Type() {
+		case 0:
+			if first, ok := written[entry]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = strings.TrimPrefix(first, "/")
+				data = nil
+				break
+			}
+			written[entry] = path
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.data))
+		case fs.ModeDir:
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case fs.ModeSymlink:
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+		case fs.ModeDevice | fs.ModeCharDevice:
+			header.Typeflag = tar.TypeChar
+			header.Devmajor = int64(entry.major)
+			header.Devminor = int64(entry.minor)
+		case fs.ModeDevice:
+			header.Typeflag = tar.TypeBlock
+			header.Devmajor = int64(entry.major)
+			header.Devminor = int64(entry.minor)
+		case fs.ModeNamedPipe:
+			header.Typeflag = tar.TypeFifo
+		default:
+			return fmt.Errorf("internal error: unsupported file type: %s", path)
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+type memFileInfo struct {
+	name  string
+	entry *memEntry
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return int64(len(fi.entry.data)) }
+func (fi *memFileInfo) Mode() fs.FileMode  { return fi.entry.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.entry.mtime }
+func (fi *memFileInfo) IsDir() bool        { return fi.entry.mode.IsDir() }
+func (fi *memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,277 @@
+package fsutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/tarutil"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+func (s *S) TestMemFSCreate(c *C) {
+	for _, test := range createTests {
+		if test.hackdir != nil {
+			continue
+		}
+		if test.result == nil {
+			test.result = make(map[string]string)
+		}
+		c.Logf("Options: %v", test.options)
+		mfs := fsutil.NewMemFS()
+		options := test.options
+		options.Path = "/" + options.Path
+		rewindData(c, &options)
+		entry, err := mfs.Create(&options)
+
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(treeDumpMemFS(c, mfs), DeepEquals, test.result)
+		slashPath := options.Path
+		if test.options.Mode.IsDir() {
+			slashPath = slashPath + "/"
+		}
+		c.Assert(testutil.TreeDumpEntry(entry), DeepEquals, test.result[slashPath])
+	}
+}
+
+func (s *S) TestMemFSSymlinks(c *C) {
+	mfs := fsutil.NewMemFS()
+	create := func(path string, mode fs.FileMode, data, link string) {
+		_, err := mfs.Create(&fsutil.CreateOptions{
+			Path:        path,
+			Mode:        mode,
+			Data:        bytes.NewBufferString(data),
+			Link:        link,
+			MakeParents: true,
+		})
+		c.Assert(err, IsNil)
+	}
+	create("/usr/lib/", fs.ModeDir|0755, "", "")
+	create("/lib", fs.ModeSymlink|0777, "", "usr/lib")
+	create("/lib/file", 0644, "data", "")
+	create("/usr/lib/abs-link", fs.ModeSymlink|0777, "", "/lib/file")
+	create("/usr/lib/loop", fs.ModeSymlink|0777, "", "loop")
+
+	// Parent symlinks are followed when creating entries.
+	c.Assert(treeDumpMemFS(c, mfs), DeepEquals, map[string]string{
+		"/lib":              "symlink usr/lib",
+		"/usr/":             "dir 0755",
+		"/usr/lib/":         "dir 0755",
+		"/usr/lib/abs-link": "symlink /lib/file",
+		"/usr/lib/file":     "file 0644 3a6eb079",
+		"/usr/lib/loop":     "symlink loop",
+	})
+
+	data, err := mfs.ReadFile("/usr/lib/abs-link")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+
+	link, err := mfs.Readlink("/lib")
+	c.Assert(err, IsNil)
+	c.Assert(link, Equals, "usr/lib")
+
+	entries, err := mfs.ReadDir("/lib")
+	c.Assert(err, IsNil)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	c.Assert(names, DeepEquals, []string{"abs-link", "file", "loop"})
+
+	_, err = mfs.ReadFile("/usr/lib/loop")
+	c.Assert(err, ErrorMatches, `lstat /usr/lib/loop: too many levels of symbolic links`)
+	_, err = mfs.ReadFile("/missing")
+	c.Assert(err, ErrorMatches, `open /missing: no such file or directory`)
+	_, err = mfs.Readlink("/usr/lib/file")
+	c.Assert(err, ErrorMatches, `readlink /usr/lib/file: invalid argument`)
+}
+
+func (s *S) TestMemFSRemove(c *C) {
+	mfs := fsutil.NewMemFS()
+	_, err := mfs.Create(&fsutil.CreateOptions{
+		Path:        "/dir/file",
+		Mode:        0644,
+		Data:        bytes.NewBufferString("data"),
+		MakeParents: true,
+	})
+	c.Assert(err, IsNil)
+
+	err = mfs.Remove("/dir")
+	c.Assert(err, ErrorMatches, `remove /dir: directory not empty`)
+	err = mfs.Remove("/dir/file")
+	c.Assert(err, IsNil)
+	err = mfs.Remove("/dir/file")
+	c.Assert(err, ErrorMatches, `remove /dir/file: no such file or directory`)
+	err = mfs.Remove("/dir")
+	c.Assert(err, IsNil)
+	c.Assert(treeDumpMemFS(c, mfs), DeepEquals, map[string]string{})
+}
+
+func (s *S) TestMemFSWriteTar(c *C) {
+	mfs := fsutil.NewMemFS()
+	for _, options := range []*fsutil.CreateOptions{{
+		Path:        "/usr/bin/hello",
+		Mode:        fs.ModeSetuid | 0755,
+		Data:        bytes.NewBufferString("hello"),
+		MakeParents: true,
+		UID:         102,
+		GID:         104,
+	}, {
+		Path: "/tmp/",
+		Mode: fs.ModeDir | fs.ModeSticky | 0777,
+	}, {
+		Path:  "/usr/bin/hi",
+		Mode:  fs.ModeSymlink | 0777,
+		Link:  "hello",
+		MTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, {
+		Path:   "/usr/bin/ping",
+		Mode:   0755,
+		Data:   bytes.NewBufferString("ping"),
+		Xattrs: map[string]string{fsutil.CapabilityXattr: "caps"},
+	}} {
+		_, err := mfs.Create(options)
+		c.Assert(err, IsNil)
+	}
+
+	var buf bytes.Buffer
+	err := mfs.WriteTar(&buf)
+	c.Assert(err, IsNil)
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Name == "usr/bin/hi" {
+			c.Assert(hdr.ModTime.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)), Equals, true)
+		} else {
+			c.Assert(hdr.ModTime.Equal(time.Unix(0, 0)), Equals, true)
+		}
+		if hdr.Name == "usr/bin/ping" {
+			c.Assert(tarutil.Xattrs(hdr), DeepEquals, map[string]string{fsutil.CapabilityXattr: "caps"})
+		} else {
+			c.Assert(tarutil.Xattrs(hdr), IsNil)
+		}
+		if hdr.Name == "usr/bin/hello" {
+			c.Assert(hdr.Mode, Equals, int64(04755))
+			c.Assert(hdr.Uid, Equals, 102)
+			c.Assert(hdr.Gid, Equals, 104)
+		} else {
+			c.Assert(hdr.Uid, Equals, 0)
+			c.Assert(hdr.Gid, Equals, 0)
+		}
+		names = append(names, hdr.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"tmp/", "usr/", "usr/bin/", "usr/bin/hello", "usr/bin/hi", "usr/bin/ping"})
+
+	// The same content always results in the same archive.
+	var again bytes.Buffer
+	err = mfs.WriteTar(&again)
+	c.Assert(err, IsNil)
+	c.Assert(again.Bytes(), DeepEquals, buf.Bytes())
+}
+
+func (s *S) TestMemFSHardLinks(c *C) {
+	mfs := fsutil.NewMemFS()
+	_, err := mfs.Create(&fsutil.CreateOptions{
+		Path:        "/usr/bin/perl5.34.0",
+		Mode:        0755,
+		Data:        bytes.NewBufferString("data"),
+		MakeParents: true,
+	})
+	c.Assert(err, IsNil)
+	entry, err := mfs.Create(&fsutil.CreateOptions{
+		Path: "/usr/bin/perl",
+		Mode: 0755,
+		Link: "/usr/bin/perl5.34.0",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(testutil.TreeDumpEntry(entry), Equals, "file 0755 3a6eb079")
+
+	// Writing to either path changes both.
+	_, err = mfs.Create(&fsutil.CreateOptions{
+		Path: "/usr/bin/perl",
+		Mode: 0755,
+		Data: bytes.NewBufferString("changed"),
+	})
+	c.Assert(err, IsNil)
+	data, err := mfs.ReadFile("/usr/bin/perl5.34.0")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "changed")
+
+	var buf bytes.Buffer
+	err = mfs.WriteTar(&buf)
+	c.Assert(err, IsNil)
+	tr := tar.NewReader(&buf)
+	links := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			links[hdr.Name] = hdr.Linkname
+		}
+	}
+	c.Assert(links, DeepEquals, map[string]string{"usr/bin/perl5.34.0": "usr/bin/perl"})
+
+	_, err = mfs.Create(&fsutil.CreateOptions{
+		Path: "/usr/lib",
+		Mode: 0644,
+		Link: "/usr",
+	})
+	c.Assert(err, ErrorMatches, `link /usr/lib: operation not permitted`)
+	_, err = mfs.Create(&fsutil.CreateOptions{
+		Path: "/usr/bin/broken",
+		Mode: 0644,
+		Link: "/missing",
+	})
+	c.Assert(err, ErrorMatches, `link /missing: no such file or directory`)
+}
+
+func (s *S) TestMemFSDevices(c *C) {
+	mfs := fsutil.NewMemFS()
+	for _, options := range []*fsutil.CreateOptions{{
+		Path:        "/dev/null",
+		Mode:        fs.ModeDevice | fs.ModeCharDevice | 0666,
+		Major:       1,
+		Minor:       3,
+		MakeParents: true,
+	}, {
+		Path:  "/dev/sda",
+		Mode:  fs.ModeDevice | 0660,
+		Major: 8,
+	}, {
+		Path: "/dev/initctl",
+		Mode: fs.ModeNamedPipe | 0600,
+	}} {
+		entry, err := mfs.Create(options)
+		c.Assert(err, IsNil)
+		c.Assert(entry.Major, Equals, options.Major)
+		c.Assert(entry.Minor, Equals, options.Minor)
+	}
+	c.Assert(treeDumpMemFS(c, mfs), DeepEquals, map[string]string{
+		"/dev/":        "dir 0755",
+		"/dev/initctl": "fifo 0600",
+		"/dev/null":    "char 0666 1:3",
+		"/dev/sda":     "block 0660 8:0",
+	})
+}
+
+func treeDumpMemFS(c *C, mfs *fsutil.MemFS) map[string]string {
+	var buf bytes.Buffer
+	err := mfs.WriteTar(&buf)
+	c.Assert(err, IsNil)
+	return testutil.TarDump(&buf)
+}
@@ -0,0 +1,428 @@
+package ldcache
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/canonical/chisel/internal/fsutil"
+)
+
+// Library is a shared library listed in the cache.
+type Library struct {
+	// Name is the name the library is looked up by, usually its soname.
+	Name string
+	// Path is the absolute path the dynamic linker loads the library from.
+	Path string
+	// Flags identify the ABI of the library.
+	Flags int32
+}
+
+// Cache holds the content of the cache of shared libraries used by the
+// dynamic linker, as written by ldconfig into /etc/ld.so.cache.
+type Cache struct {
+	ByteOrder binary.ByteOrder
+	Libraries []*Library
+}
+
+const (
+	flagELFLibc6 = 0x0003
+
+	flagX8664Lib64        = 0x0300
+	flagS390Lib64         = 0x0400
+	flagPowerPCLib64      = 0x0500
+	flagARMLibHF          = 0x0900
+	flagAArch64Lib64      = 0x0a00
+	flagRISCVFloatDouble  = 0x1000
+	cacheFlagLittleEndian = 2
+	cacheFlagBigEndian    = 3
+)
+
+type abi struct {
+	triplet   string
+	machine   elf.Machine
+	class     elf.Class
+	flags     int32
+	byteOrder binary.ByteOrder
+}
+
+var abis = map[string]abi{
+	"amd64":   {"x86_64-linux-gnu", elf.EM_X86_64, elf.ELFCLASS64, flagELFLibc6 | flagX8664Lib64, binary.LittleEndian},
+	"arm64":   {"aarch64-linux-gnu", elf.EM_AARCH64, elf.ELFCLASS64, flagELFLibc6 | flagAArch64Lib64, binary.LittleEndian},
+	"armhf":   {"arm-linux-gnueabihf", elf.EM_ARM, elf.ELFCLASS32, flagELFLibc6 | flagARMLibHF, binary.LittleEndian},
+	"i386":    {"i386-linux-gnu", elf.EM_386, elf.ELFCLASS32, flagELFLibc6, binary.LittleEndian},
+	"ppc64el": {"powerpc64le-linux-gnu", elf.EM_PPC64, elf.ELFCLASS64, flagELFLibc6 | flagPowerPCLib64, binary.LittleEndian},
+	"riscv64": {"riscv64-linux-gnu", elf.EM_RISCV, elf.ELFCLASS64, flagELFLibc6 | flagRISCVFloatDouble, binary.LittleEndian},
+	"s390x":   {"s390x-linux-gnu", elf.EM_S390, elf.ELFCLASS64, flagELFLibc6 | flagS390Lib64, binary.BigEndian},
+}
+
+// maxSymlinks bounds the number of symlinks followed when resolving a path.
+const maxSymlinks = 40
+
+type ScanOptions struct {
+	FS fsutil.FS
+	// RootDir is the directory holding the tree to scan.
+	RootDir string
+	// Arch is the architecture of the libraries to list.
+	Arch string
+}
+
+// Scan lists the shared libraries of the given architecture found in the
+// directories configured in /etc/ld.so.conf and in the trusted system
+// directories, as ldconfig does. Libraries are only listed when the path
+// named after their soname exists, since links are not created.
+func Scan(options *ScanOptions) (*Cache, error) {
+	abi, ok := abis[options.Arch]
+	if !ok {
+		return nil, fmt.Errorf("cannot scan shared libraries: unsupported architecture %q", options.Arch)
+	}
+	s := &scanner{
+		fsys:    options.FS,
+		rootDir: options.RootDir,
+		abi:     abi,
+		confs:   make(map[string]bool),
+	}
+	dirs, err := s.readConf("/etc/ld.so.conf")
+	if err != nil {
+		return nil, err
+	}
+	dirs = append(dirs, "/lib/"+abi.triplet, "/usr/lib/"+abi.triplet, "/lib", "/usr/lib")
+
+	cache := &Cache{ByteOrder: abi.byteOrder}
+	seenDirs := make(map[string]bool)
+	seenNames := make(map[string]bool)
+	for _, dir := range dirs {
+		realDir, err := s.resolve(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if seenDirs[realDir] {
+			continue
+		}
+		seenDirs[realDir] = true
+		entries, err := s.fsys.ReadDir(s.realPath(realDir))
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot scan shared libraries: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, "lib") && !strings.HasPrefix(name, "ld-") || !strings.Contains(name, ".so") {
+				continue
+			}
+			soname, ok := s.soname(path.Join(realDir, name))
+			if !ok {
+				continue
+			}
+			names := []string{soname}
+			if entry.Type() == fs.ModeSymlink && name != soname && strings.HasSuffix(name, ".so") && strings.HasPrefix(soname, name) {
+				// Development links such as libfoo.so -> libfoo.so.1 are
+				// listed as well.
+				names = append(names, name)
+			}
+			for _, name := range names {
+				if seenNames[name] {
+					continue
+				}
+				if _, err := s.resolve(path.Join(realDir, name)); err != nil {
+					continue
+				}
+				seenNames[name] = true
+				cache.Libraries = append(cache.Libraries, &Library{
+					Name:  name,
+					Path:  path.Join(dir, name),
+					Flags: abi.flags,
+				})
+			}
+		}
+	}
+	return cache, nil
+}
+
+type scanner struct {
+	fsys    fsutil.FS
+	rootDir string
+	abi     abi
+	confs   map[string]bool
+}
+
+func (s *scanner) realPath(relPath string) string {
+	return filepath.Join(s.rootDir, relPath)
+}
+
+// resolve returns the path that relPath refers to once all the symlinks in
+// it are followed, without leaving the root directory.
+func (s *scanner) resolve(relPath string) (string, error) {
+	resolved := "/"
+	parts := strings.Split(relPath, "/")
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, part)
+		target, err := s.fsys.Readlink(s.realPath(next))
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		} else if err != nil {
+			// Not a symlink.
+			resolved = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("cannot resolve %s: too many levels of symbolic links", relPath)
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return resolved, nil
+}
+
+// soname returns the soname of the shared library at relPath, or its file
+// name when it has none. Files which are not shared libraries of the
+// expected architecture are ignored, as ldconfig does.
+func (s *scanner) soname(relPath string) (string, bool) {
+	realPath, err := s.resolve(relPath)
+	if err != nil {
+		return "", false
+	}
+	data, err := s.fsys.ReadFile(s.realPath(realPath))
+	if err != nil {
+		debugf("Ignoring %s: %v", relPath, err)
+		return "", false
+	}
+	file, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		// Not an ELF file, such as a linker script.
+		return "", false
+	}
+	if file.Type != elf.ET_DYN || file.Machine != s.abi.machine || file.Class != s.abi.class {
+		return "", false
+	}
+	sonames, err := file.DynString(elf.DT_SONAME)
+	if err != nil {
+		debugf("Ignoring %s: %v", relPath, err)
+		return "", false
+	}
+	if len(sonames) > 0 && sonames[0] != "" {
+		return sonames[0], true
+	}
+	return path.Base(relPath), true
+}
+
+// readConf returns the directories listed in the ld.so.conf file at
+// relPath, following its include directives.
+func (s *scanner) readConf(relPath string) ([]string, error) {
+	realPath, err := s.resolve(relPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if s.confs[realPath] {
+		return nil, nil
+	}
+	s.confs[realPath] = true
+	data, err := s.fsys.ReadFile(s.realPath(realPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", relPath, err)
+	}
+
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "include":
+			for _, pattern := range fields[1:] {
+				if !path.IsAbs(pattern) {
+					pattern = path.Join(path.Dir(relPath), pattern)
+				}
+				matches, err := s.glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("cannot read %s: %w", relPath, err)
+				}
+				for _, match := range matches {
+					included, err := s.readConf(match)
+					if err != nil {
+						return nil, err
+					}
+					dirs = append(dirs, included...)
+				}
+			}
+		case "hwcap":
+			// Obsolete, and ignored by ldconfig as well.
+		default:
+			for _, field := range fields {
+				if path.IsAbs(field) {
+					dirs = append(dirs, path.Clean(field))
+				}
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// glob returns the paths matching pattern, which may only have wildcards
+// in its last element.
+func (s *scanner) glob(pattern string) ([]string, error) {
+	dir, filePattern := path.Split(pattern)
+	if _, err := path.Match(filePattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	realDir, err := s.resolve(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries, err := s.fsys.ReadDir(s.realPath(realDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, entry := range entries {
+		if ok, _ := path.Match(filePattern, entry.Name()); ok {
+			matches = append(matches, path.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+const (
+	cacheMagic = "glibc-ld.so.cache1.1"
+	headerSize = 48
+	entrySize  = 24
+)
+
+type cacheHeader struct {
+	Magic           [len(cacheMagic)]byte
+	NLibs           uint32
+	StringsLen      uint32
+	Flags           uint8
+	_               [3]uint8
+	ExtensionOffset uint32
+	_               [3]uint32
+}
+
+type cacheEntry struct {
+	Flags     int32
+	Key       uint32
+	Value     uint32
+	OSVersion uint32
+	HWCap     uint64
+}
+
+// Write writes the cache in the format used by glibc since version 2.32.
+// Libraries are ordered as the dynamic linker expects to search for them.
+func (c *Cache) Write(w io.Writer) error {
+	libs := slices.Clone(c.Libraries)
+	sort.SliceStable(libs, func(i, j int) bool {
+		return compareNames(libs[i].Name, libs[j].Name) > 0
+	})
+
+	// Offsets of the strings are relative to the start of the file.
+	stringsOffset := headerSize + entrySize*len(libs)
+	var stringTable bytes.Buffer
+	addString := func(s string) uint32 {
+		offset := stringsOffset + stringTable.Len()
+		stringTable.WriteString(s)
+		stringTable.WriteByte(0)
+		return uint32(offset)
+	}
+	entries := make([]cacheEntry, len(libs))
+	for i, lib := range libs {
+		entries[i] = cacheEntry{
+			Flags: lib.Flags,
+			Key:   addString(lib.Name),
+			Value: addString(lib.Path),
+		}
+	}
+
+	header := cacheHeader{
+		NLibs:      uint32(len(libs)),
+		StringsLen: uint32(stringTable.Len()),
+		Flags:      cacheFlagLittleEndian,
+	}
+	copy(header.Magic[:], cacheMagic)
+	byteOrder := c.ByteOrder
+	if byteOrder == nil {
+		byteOrder = binary.LittleEndian
+	}
+	if byteOrder == binary.BigEndian {
+		header.Flags = cacheFlagBigEndian
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, byteOrder, &header)
+	binary.Write(&buf, byteOrder, entries)
+	buf.Write(stringTable.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// compareNames compares library names as the dynamic linker does, with
+// sequences of digits compared by their numeric value.
+func compareNames(a, b string) int {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			va, vb := 0, 0
+			for ; i < len(a) && isDigit(a[i]); i++ {
+				va = va*10 + int(a[i]-'0')
+			}
+			for ; j < len(b) && isDigit(b[j]); j++ {
+				vb = vb*10 + int(b[j]-'0')
+			}
+			if va != vb {
+				return va - vb
+			}
+			continue
+		}
+		if isDigit(a[i]) {
+			return 1
+		}
+		if isDigit(b[j]) {
+			return -1
+		}
+		if a[i] != b[j] {
+			return int(a[i]) - int(b[j])
+		}
+		i++
+		j++
+	}
+	return (len(a) - i) - (len(b) - j)
+}
@@ -0,0 +1,200 @@
+package ldcache_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/ldcache"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+type scanTest struct {
+	summary string
+	arch    string
+	// files maps paths to their content, or to "-> target" for symlinks.
+	files    map[string]string
+	expected []*ldcache.Library
+	error    string
+}
+
+var libfoo = string(testutil.MakeSharedObject(elf.EM_X86_64, "libfoo.so.1"))
+
+var scanTests = []scanTest{{
+	summary: "Libraries are listed by soname",
+	arch:    "amd64",
+	files: map[string]string{
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1.2": libfoo,
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1":   "-> libfoo.so.1.2",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so":     "-> libfoo.so.1",
+		"/usr/lib/libbar.so":                      string(testutil.MakeSharedObject(elf.EM_X86_64, "")),
+	},
+	expected: []*ldcache.Library{{
+		Name:  "libfoo.so.1",
+		Path:  "/usr/lib/x86_64-linux-gnu/libfoo.so.1",
+		Flags: 0x0303,
+	}, {
+		Name:  "libfoo.so",
+		Path:  "/usr/lib/x86_64-linux-gnu/libfoo.so",
+		Flags: 0x0303,
+	}, {
+		Name:  "libbar.so",
+		Path:  "/usr/lib/libbar.so",
+		Flags: 0x0303,
+	}},
+}, {
+	summary: "Libraries without a link named after their soname are not listed",
+	arch:    "amd64",
+	files: map[string]string{
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1.2": libfoo,
+	},
+}, {
+	summary: "Other files are ignored",
+	arch:    "amd64",
+	files: map[string]string{
+		"/usr/lib/x86_64-linux-gnu/libc.so":        "GROUP ( libc.so.6 )",
+		"/usr/lib/x86_64-linux-gnu/libarm.so.1":    string(testutil.MakeSharedObject(elf.EM_AARCH64, "libarm.so.1")),
+		"/usr/lib/x86_64-linux-gnu/other.so.1":     libfoo,
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1/":   "",
+		"/usr/lib/x86_64-linux-gnu/libbroken.so.1": "-> missing",
+	},
+}, {
+	summary: "Directories are scanned once under the first path they are found",
+	arch:    "amd64",
+	files: map[string]string{
+		"/lib": "-> usr/lib",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1.2": libfoo,
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1":   "-> /lib/x86_64-linux-gnu/libfoo.so.1.2",
+	},
+	expected: []*ldcache.Library{{
+		Name:  "libfoo.so.1",
+		Path:  "/lib/x86_64-linux-gnu/libfoo.so.1",
+		Flags: 0x0303,
+	}},
+}, {
+	summary: "Configured directories come first",
+	arch:    "amd64",
+	files: map[string]string{
+		"/etc/ld.so.conf":                       "include /etc/ld.so.conf.d/*.conf\n",
+		"/etc/ld.so.conf.d/a.conf":              "# Comment\n/opt/a\n",
+		"/etc/ld.so.conf.d/b.conf":              "include b.conf\n/opt/b /opt/missing\n",
+		"/etc/ld.so.conf.d/ignored":             "/opt/ignored\n",
+		"/opt/a/libfoo.so.1":                    libfoo,
+		"/opt/b/libfoo.so.1":                    libfoo,
+		"/opt/b/libbaz.so.2":                    string(testutil.MakeSharedObject(elf.EM_X86_64, "libbaz.so.2")),
+		"/opt/ignored/libqux.so.1":              string(testutil.MakeSharedObject(elf.EM_X86_64, "libqux.so.1")),
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1": libfoo,
+	},
+	expected: []*ldcache.Library{{
+		Name:  "libfoo.so.1",
+		Path:  "/opt/a/libfoo.so.1",
+		Flags: 0x0303,
+	}, {
+		Name:  "libbaz.so.2",
+		Path:  "/opt/b/libbaz.so.2",
+		Flags: 0x0303,
+	}},
+}, {
+	summary: "Unsupported architecture",
+	arch:    "foo",
+	error:   `cannot scan shared libraries: unsupported architecture "foo"`,
+}}
+
+func (s *S) TestScan(c *C) {
+	for _, test := range scanTests {
+		c.Logf("Summary: %s", test.summary)
+		dir := c.MkDir()
+		for path, content := range test.files {
+			fullPath := filepath.Join(dir, path)
+			c.Assert(os.MkdirAll(filepath.Dir(fullPath), 0755), IsNil)
+			if strings.HasSuffix(path, "/") {
+				c.Assert(os.Mkdir(fullPath, 0755), IsNil)
+			} else if target, ok := strings.CutPrefix(content, "-> "); ok {
+				c.Assert(os.Symlink(target, fullPath), IsNil)
+			} else {
+				c.Assert(os.WriteFile(fullPath, []byte(content), 0644), IsNil)
+			}
+		}
+
+		cache, err := ldcache.Scan(&ldcache.ScanOptions{
+			FS:      fsutil.DiskFS,
+			RootDir: dir,
+			Arch:    test.arch,
+		})
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(cache.Libraries, DeepEquals, test.expected)
+	}
+}
+
+func (s *S) TestWrite(c *C) {
+	cache := &ldcache.Cache{
+		ByteOrder: binary.LittleEndian,
+		Libraries: []*ldcache.Library{
+			{Name: "ld-linux-x86-64.so.2", Path: "/lib64/ld-linux-x86-64.so.2", Flags: 0x0303},
+			{Name: "libc.so.6", Path: "/lib/x86_64-linux-gnu/libc.so.6", Flags: 0x0303},
+			{Name: "libfoo.so.9", Path: "/lib/libfoo.so.9", Flags: 0x0303},
+			{Name: "libfoo.so.10", Path: "/lib/libfoo.so.10", Flags: 0x0303},
+		},
+	}
+	var buf bytes.Buffer
+	err := cache.Write(&buf)
+	c.Assert(err, IsNil)
+	data := buf.Bytes()
+
+	c.Assert(string(data[:20]), Equals, "glibc-ld.so.cache1.1")
+	nlibs := binary.LittleEndian.Uint32(data[20:])
+	stringsLen := binary.LittleEndian.Uint32(data[24:])
+	c.Assert(nlibs, Equals, uint32(4))
+	c.Assert(data[28], Equals, byte(2))
+	c.Assert(len(data), Equals, 48+24*4+int(stringsLen))
+
+	readString := func(offset uint32) string {
+		end := bytes.IndexByte(data[offset:], 0)
+		return string(data[offset : int(offset)+end])
+	}
+	var entries []string
+	for i := 0; i < int(nlibs); i++ {
+		entry := data[48+24*i:]
+		flags := binary.LittleEndian.Uint32(entry[0:])
+		key := readString(binary.LittleEndian.Uint32(entry[4:]))
+		value := readString(binary.LittleEndian.Uint32(entry[8:]))
+		c.Assert(flags, Equals, uint32(0x0303))
+		entries = append(entries, key+" => "+value)
+	}
+	// Entries are sorted in descending order, comparing numbers by value.
+	c.Assert(entries, DeepEquals, []string{
+		"libfoo.so.10 => /lib/libfoo.so.10",
+		"libfoo.so.9 => /lib/libfoo.so.9",
+		"libc.so.6 => /lib/x86_64-linux-gnu/libc.so.6",
+		"ld-linux-x86-64.so.2 => /lib64/ld-linux-x86-64.so.2",
+	})
+
+	// The original order is kept.
+	c.Assert(cache.Libraries[0].Name, Equals, "ld-linux-x86-64.so.2")
+}
+
+func (s *S) TestWriteBigEndian(c *C) {
+	cache := &ldcache.Cache{
+		ByteOrder: binary.BigEndian,
+		Libraries: []*ldcache.Library{
+			{Name: "libc.so.6", Path: "/lib/s390x-linux-gnu/libc.so.6", Flags: 0x0403},
+		},
+	}
+	var buf bytes.Buffer
+	err := cache.Write(&buf)
+	c.Assert(err, IsNil)
+	data := buf.Bytes()
+	c.Assert(binary.BigEndian.Uint32(data[20:]), Equals, uint32(1))
+	c.Assert(data[28], Equals, byte(3))
+	c.Assert(binary.BigEndian.Uint32(data[48:]), Equals, uint32(0x0403))
+}
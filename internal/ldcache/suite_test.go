@@ -0,0 +1,25 @@
+package ldcache_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/ldcache"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (s *S) SetUpTest(c *C) {
+	ldcache.SetDebug(true)
+	ldcache.SetLogger(c)
+}
+
+func (s *S) TearDownTest(c *C) {
+	ldcache.SetDebug(false)
+	ldcache.SetLogger(nil)
+}
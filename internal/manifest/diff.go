@@ -0,0 +1,248 @@
+package manifest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// PackageChange describes a package that differs between two manifests.
+type PackageChange struct {
+	Name       string     `json:"name"`
+	Kind       ChangeKind `json:"kind"`
+	OldVersion string     `json:"old_version,omitempty"`
+	NewVersion string     `json:"new_version,omitempty"`
+}
+
+// SliceChange describes a slice present in only one of two manifests.
+type SliceChange struct {
+	Name string     `json:"name"`
+	Kind ChangeKind `json:"kind"`
+}
+
+// PathChange describes a path that differs between two manifests. The
+// slices listing the path in one manifest only are reported as added or
+// removed, and Detail summarises the other differences, if any.
+type PathChange struct {
+	Path          string     `json:"path"`
+	Kind          ChangeKind `json:"kind"`
+	Detail        string     `json:"detail,omitempty"`
+	SizeDelta     int64      `json:"size_delta"`
+	AddedSlices   []string   `json:"added_slices,omitempty"`
+	RemovedSlices []string   `json:"removed_slices,omitempty"`
+}
+
+// Diff holds the differences between two manifests, sorted by name and path.
+type Diff struct {
+	Packages []*PackageChange `json:"packages"`
+	Slices   []*SliceChange   `json:"slices"`
+	Paths    []*PathChange    `json:"paths"`
+}
+
+// Empty returns whether there are no differences.
+func (diff *Diff) Empty() bool {
+	return len(diff.Packages) == 0 && len(diff.Slices) == 0 && len(diff.Paths) == 0
+}
+
+// Compare returns the differences from the old manifest to the new one.
+// Packages differ by version and digest, and paths by type, mode, link,
+// device, slices and content, as recorded after mutation.
+func Compare(oldManifest, newManifest *Manifest) (diff *Diff, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot compare manifests: %w", err)
+		}
+	}()
+
+	oldPkgs, err := manifestPackages(oldManifest)
+	if err != nil {
+		return nil, err
+	}
+	newPkgs, err := manifestPackages(newManifest)
+	if err != nil {
+		return nil, err
+	}
+	oldSlices, err := manifestSlices(oldManifest)
+	if err != nil {
+		return nil, err
+	}
+	newSlices, err := manifestSlices(newManifest)
+	if err != nil {
+		return nil, err
+	}
+	oldPaths, err := manifestPaths(oldManifest)
+	if err != nil {
+		return nil, err
+	}
+	newPaths, err := manifestPaths(newManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	diff = &Diff{
+		Packages: []*PackageChange{},
+		Slices:   []*SliceChange{},
+		Paths:    []*PathChange{},
+	}
+	for name, oldPkg := range oldPkgs {
+		newPkg := newPkgs[name]
+		if newPkg == nil {
+			diff.Packages = append(diff.Packages, &PackageChange{Name: name, Kind: ChangeRemoved, OldVersion: oldPkg.Version})
+		} else if oldPkg.Version != newPkg.Version || oldPkg.Digest != newPkg.Digest {
+			diff.Packages = append(diff.Packages, &PackageChange{
+				Name:       name,
+				Kind:       ChangeModified,
+				OldVersion: oldPkg.Version,
+				NewVersion: newPkg.Version,
+			})
+		}
+	}
+	for name, newPkg := range newPkgs {
+		if oldPkgs[name] == nil {
+			diff.Packages = append(diff.Packages, &PackageChange{Name: name, Kind: ChangeAdded, NewVersion: newPkg.Version})
+		}
+	}
+	sort.Slice(diff.Packages, func(i, j int) bool { return diff.Packages[i].Name < diff.Packages[j].Name })
+
+	for name := range oldSlices {
+		if !newSlices[name] {
+			diff.Slices = append(diff.Slices, &SliceChange{Name: name, Kind: ChangeRemoved})
+		}
+	}
+	for name := range newSlices {
+		if !oldSlices[name] {
+			diff.Slices = append(diff.Slices, &SliceChange{Name: name, Kind: ChangeAdded})
+		}
+	}
+	sort.Slice(diff.Slices, func(i, j int) bool { return diff.Slices[i].Name < diff.Slices[j].Name })
+
+	for relPath, oldPath := range oldPaths {
+		change := comparePath(oldPath, newPaths[relPath])
+		if change != nil {
+			diff.Paths = append(diff.Paths, change)
+		}
+	}
+	for relPath, newPath := range newPaths {
+		if oldPaths[relPath] == nil {
+			diff.Paths = append(diff.Paths, comparePath(nil, newPath))
+		}
+	}
+	sort.Slice(diff.Paths, func(i, j int) bool { return diff.Paths[i].Path < diff.Paths[j].Path })
+	return diff, nil
+}
+
+// comparePath returns the change from oldPath to newPath, either of which
+// may be nil, or nil when they do not differ.
+func comparePath(oldPath, newPath *Path) *PathChange {
+	switch {
+	case newPath == nil:
+		return &PathChange{
+			Path:          oldPath.Path,
+			Kind:          ChangeRemoved,
+			SizeDelta:     -int64(oldPath.Size),
+			RemovedSlices: sortedSlices(oldPath.Slices),
+		}
+	case oldPath == nil:
+		return &PathChange{
+			Path:        newPath.Path,
+			Kind:        ChangeAdded,
+			SizeDelta:   int64(newPath.Size),
+			AddedSlices: sortedSlices(newPath.Slices),
+		}
+	}
+
+	var details []string
+	oldType, newType := pathType(oldPath), pathType(newPath)
+	if oldType != newType {
+		details = append(details, fmt.Sprintf("%s to %s", oldType, newType))
+	} else {
+		if oldPath.Mode != newPath.Mode && newType != "symlink" {
+			details = append(details, fmt.Sprintf("mode %s to %s", oldPath.Mode, newPath.Mode))
+		}
+		if oldPath.Link != newPath.Link {
+			details = append(details, fmt.Sprintf("link %q to %q", oldPath.Link, newPath.Link))
+		}
+		if oldPath.Major != newPath.Major || oldPath.Minor != newPath.Minor {
+			details = append(details, fmt.Sprintf("device %d:%d to %d:%d", oldPath.Major, oldPath.Minor, newPath.Major, newPath.Minor))
+		}
+		if finalHash(oldPath) != finalHash(newPath) {
+			details = append(details, "content")
+		}
+	}
+	var added, removed []string
+	for _, sliceName := range newPath.Slices {
+		if !slices.Contains(oldPath.Slices, sliceName) {
+			added = append(added, sliceName)
+		}
+	}
+	for _, sliceName := range oldPath.Slices {
+		if !slices.Contains(newPath.Slices, sliceName) {
+			removed = append(removed, sliceName)
+		}
+	}
+	sizeDelta := int64(newPath.Size) - int64(oldPath.Size)
+	if len(details) == 0 && len(added) == 0 && len(removed) == 0 && sizeDelta == 0 {
+		return nil
+	}
+	return &PathChange{
+		Path:          newPath.Path,
+		Kind:          ChangeModified,
+		Detail:        strings.Join(details, ", "),
+		SizeDelta:     sizeDelta,
+		AddedSlices:   sortedSlices(added),
+		RemovedSlices: sortedSlices(removed),
+	}
+}
+
+// finalHash returns the hash of the content of the path after mutation.
+func finalHash(path *Path) string {
+	if path.FinalHash != "" {
+		return path.FinalHash
+	}
+	return path.Hash
+}
+
+func sortedSlices(sliceNames []string) []string {
+	if len(sliceNames) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(sliceNames)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func manifestPackages(manifest *Manifest) (map[string]*Package, error) {
+	pkgs := make(map[string]*Package)
+	err := manifest.IteratePackages(func(pkg *Package) error {
+		pkgs[pkg.Name] = pkg
+		return nil
+	})
+	return pkgs, err
+}
+
+func manifestSlices(manifest *Manifest) (map[string]bool, error) {
+	sliceNames := make(map[string]bool)
+	err := manifest.IterateSlices("", func(slice *Slice) error {
+		sliceNames[slice.Name] = true
+		return nil
+	})
+	return sliceNames, err
+}
+
+func manifestPaths(manifest *Manifest) (map[string]*Path, error) {
+	paths := make(map[string]*Path)
+	err := manifest.IteratePaths("", func(path *Path) error {
+		paths[path.Path] = path
+		return nil
+	})
+	return paths, err
+}
@@ -0,0 +1,174 @@
+package manifest_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var diffOldManifest = &manifest.WriteOptions{
+	Packages: []*manifest.Package{
+		{Name: "mypkg", Version: "1.0", Digest: "a"},
+		{Name: "oldpkg", Version: "1.0", Digest: "b"},
+		{Name: "samepkg", Version: "1.0", Digest: "c"},
+	},
+	Slices: []*setup.Slice{
+		{Package: "mypkg", Name: "myslice"},
+		{Package: "mypkg", Name: "oldslice"},
+		{Package: "oldpkg", Name: "myslice"},
+		{Package: "samepkg", Name: "myslice"},
+	},
+	Paths: []*manifest.Path{{
+		Path:   "/dir/",
+		Mode:   "0755",
+		Slices: []string{"mypkg_myslice"},
+	}, {
+		Path:   "/dir/file",
+		Mode:   "0644",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   sha256Hex("data"),
+		Size:   4,
+	}, {
+		Path:      "/dir/mutated",
+		Mode:      "0644",
+		Slices:    []string{"mypkg_myslice", "mypkg_oldslice"},
+		Hash:      sha256Hex("data"),
+		FinalHash: sha256Hex("mutated"),
+		Size:      7,
+	}, {
+		Path:   "/dir/link",
+		Mode:   "0777",
+		Slices: []string{"mypkg_myslice"},
+		Link:   "file",
+	}, {
+		Path:   "/old",
+		Mode:   "0644",
+		Slices: []string{"oldpkg_myslice"},
+		Hash:   sha256Hex("old"),
+		Size:   3,
+	}, {
+		Path:   "/same",
+		Mode:   "0644",
+		Slices: []string{"samepkg_myslice"},
+		Hash:   sha256Hex("same"),
+		Size:   4,
+	}},
+}
+
+var diffNewManifest = &manifest.WriteOptions{
+	Packages: []*manifest.Package{
+		{Name: "mypkg", Version: "1.1", Digest: "d"},
+		{Name: "newpkg", Version: "2.0", Digest: "e"},
+		{Name: "samepkg", Version: "1.0", Digest: "c"},
+	},
+	Slices: []*setup.Slice{
+		{Package: "mypkg", Name: "myslice"},
+		{Package: "mypkg", Name: "newslice"},
+		{Package: "newpkg", Name: "myslice"},
+		{Package: "samepkg", Name: "myslice"},
+	},
+	Paths: []*manifest.Path{{
+		Path:   "/dir/",
+		Mode:   "0700",
+		Slices: []string{"mypkg_myslice"},
+	}, {
+		Path:   "/dir/file",
+		Mode:   "0755",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   sha256Hex("new data"),
+		Size:   8,
+	}, {
+		Path:      "/dir/mutated",
+		Mode:      "0644",
+		Slices:    []string{"mypkg_newslice", "mypkg_myslice"},
+		Hash:      sha256Hex("new data"),
+		FinalHash: sha256Hex("mutated"),
+		Size:      7,
+	}, {
+		Path:   "/dir/link",
+		Mode:   "0777",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   sha256Hex("link"),
+		Size:   4,
+	}, {
+		Path:   "/new",
+		Mode:   "0644",
+		Slices: []string{"newpkg_myslice"},
+		Hash:   sha256Hex("new"),
+		Size:   3,
+	}, {
+		Path:   "/same",
+		Mode:   "0644",
+		Slices: []string{"samepkg_myslice"},
+		Hash:   sha256Hex("same"),
+		Size:   4,
+	}},
+}
+
+func writeDiffManifest(c *C, options *manifest.WriteOptions) *manifest.Manifest {
+	var buf bytes.Buffer
+	err := manifest.Write(&buf, options)
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+	return mfest
+}
+
+func (s *S) TestCompare(c *C) {
+	oldManifest := writeDiffManifest(c, diffOldManifest)
+	newManifest := writeDiffManifest(c, diffNewManifest)
+
+	diff, err := manifest.Compare(oldManifest, newManifest)
+	c.Assert(err, IsNil)
+	c.Assert(diff.Empty(), Equals, false)
+	c.Assert(diff, DeepEquals, &manifest.Diff{
+		Packages: []*manifest.PackageChange{
+			{Name: "mypkg", Kind: manifest.ChangeModified, OldVersion: "1.0", NewVersion: "1.1"},
+			{Name: "newpkg", Kind: manifest.ChangeAdded, NewVersion: "2.0"},
+			{Name: "oldpkg", Kind: manifest.ChangeRemoved, OldVersion: "1.0"},
+		},
+		Slices: []*manifest.SliceChange{
+			{Name: "mypkg_newslice", Kind: manifest.ChangeAdded},
+			{Name: "mypkg_oldslice", Kind: manifest.ChangeRemoved},
+			{Name: "newpkg_myslice", Kind: manifest.ChangeAdded},
+			{Name: "oldpkg_myslice", Kind: manifest.ChangeRemoved},
+		},
+		Paths: []*manifest.PathChange{{
+			Path:   "/dir/",
+			Kind:   manifest.ChangeModified,
+			Detail: "mode 0755 to 0700",
+		}, {
+			Path:      "/dir/file",
+			Kind:      manifest.ChangeModified,
+			Detail:    "mode 0644 to 0755, content",
+			SizeDelta: 4,
+		}, {
+			Path:      "/dir/link",
+			Kind:      manifest.ChangeModified,
+			Detail:    "symlink to file",
+			SizeDelta: 4,
+		}, {
+			Path:          "/dir/mutated",
+			Kind:          manifest.ChangeModified,
+			AddedSlices:   []string{"mypkg_newslice"},
+			RemovedSlices: []string{"mypkg_oldslice"},
+		}, {
+			Path:        "/new",
+			Kind:        manifest.ChangeAdded,
+			SizeDelta:   3,
+			AddedSlices: []string{"newpkg_myslice"},
+		}, {
+			Path:          "/old",
+			Kind:          manifest.ChangeRemoved,
+			SizeDelta:     -3,
+			RemovedSlices: []string{"oldpkg_myslice"},
+		}},
+	})
+
+	diff, err = manifest.Compare(newManifest, newManifest)
+	c.Assert(err, IsNil)
+	c.Assert(diff.Empty(), Equals, true)
+}
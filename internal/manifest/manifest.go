@@ -4,12 +4,23 @@ import (
 	"fmt"
 	"io"
 	"slices"
+	"strings"
 
 	"github.com/canonical/chisel/internal/jsonwall"
 	"github.com/canonical/chisel/internal/setup"
 )
 
-const schema = "1.0"
+// Schema is the version of the manifest format. Fields added to the format
+// since its introduction, such as the inode and device information of paths,
+// are optional and omitted when unset, so manifests remain readable by older
+// readers, which ignore unknown fields: they see hard links as regular files
+// and devices as paths without content.
+// The version must be bumped when the meaning of existing fields changes.
+const Schema = "1.0"
+
+// Filename is the name of the manifest file written into each directory
+// marked with "generate: manifest".
+const Filename = "manifest.wall"
 
 type Package struct {
 	Kind    string `json:"kind"`
@@ -33,6 +44,10 @@ type Path struct {
 	FinalHash string   `json:"final_sha256,omitempty"`
 	Size      uint64   `json:"size,omitempty"`
 	Link      string   `json:"link,omitempty"`
+	Inode     uint64   `json:"inode,omitempty"`
+	Device    string   `json:"device,omitempty"`
+	Major     uint32   `json:"major,omitempty"`
+	Minor     uint32   `json:"minor,omitempty"`
 }
 
 type Content struct {
@@ -59,7 +74,7 @@ func Read(reader io.Reader) (manifest *Manifest, err error) {
 		return nil, err
 	}
 	mfestSchema := db.Schema()
-	if mfestSchema != schema {
+	if mfestSchema != Schema {
 		return nil, fmt.Errorf("unknown schema version %q", mfestSchema)
 	}
 
@@ -158,6 +173,130 @@ func Validate(manifest *Manifest) (err error) {
 	return nil
 }
 
+// WriteOptions holds the content of a manifest to be written.
+type WriteOptions struct {
+	// Packages lists the packages from which the slices were cut.
+	Packages []*Package
+	// Slices lists the selected slices.
+	Slices []*setup.Slice
+	// Paths lists the installed paths, each referring to the slices that
+	// installed it by their full name (e.g. "pkg_slice").
+	Paths []*Path
+}
+
+// Write writes a manifest with the provided packages, slices and paths into
+// w. The kind of each entry is filled in automatically, and the content entries
+// are derived from the slices of each path. The options are checked beforehand
+// so that the written manifest is always valid (see Validate).
+func Write(w io.Writer, options *WriteOptions) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot write manifest: %s", err)
+		}
+	}()
+
+	err = validateWriteOptions(options)
+	if err != nil {
+		return err
+	}
+
+	dbw := jsonwall.NewDBWriter(&jsonwall.DBWriterOptions{
+		Schema: Schema,
+	})
+	for _, pkg := range options.Packages {
+		pkgCopy := *pkg
+		pkgCopy.Kind = "package"
+		err := dbw.Add(&pkgCopy)
+		if err != nil {
+			return err
+		}
+	}
+	for _, slice := range options.Slices {
+		err := dbw.Add(&Slice{
+			Kind: "slice",
+			Name: slice.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range options.Paths {
+		pathCopy := *path
+		pathCopy.Kind = "path"
+		pathCopy.Slices = slices.Clone(path.Slices)
+		slices.Sort(pathCopy.Slices)
+		err := dbw.Add(&pathCopy)
+		if err != nil {
+			return err
+		}
+		for _, sliceName := range pathCopy.Slices {
+			err := dbw.Add(&Content{
+				Kind:  "content",
+				Slice: sliceName,
+				Path:  path.Path,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = dbw.WriteTo(w)
+	return err
+}
+
+// validateWriteOptions checks the same properties as Validate, but on the
+// options provided to Write, before anything is written.
+func validateWriteOptions(options *WriteOptions) error {
+	pkgExist := map[string]bool{}
+	for _, pkg := range options.Packages {
+		if pkg.Name == "" {
+			return fmt.Errorf("package has no name")
+		}
+		if pkgExist[pkg.Name] {
+			return fmt.Errorf("package %q listed twice", pkg.Name)
+		}
+		pkgExist[pkg.Name] = true
+	}
+
+	sliceExist := map[string]bool{}
+	for _, slice := range options.Slices {
+		sk, err := setup.ParseSliceKey(slice.String())
+		if err != nil {
+			return err
+		}
+		if !pkgExist[sk.Package] {
+			return fmt.Errorf("package %q not found in packages", sk.Package)
+		}
+		if sliceExist[slice.String()] {
+			return fmt.Errorf("slice %s listed twice", slice)
+		}
+		sliceExist[slice.String()] = true
+	}
+
+	pathExist := map[string]bool{}
+	for _, path := range options.Paths {
+		if !strings.HasPrefix(path.Path, "/") {
+			return fmt.Errorf("invalid path: %q", path.Path)
+		}
+		if pathExist[path.Path] {
+			return fmt.Errorf("path %s listed twice", path.Path)
+		}
+		pathExist[path.Path] = true
+		if len(path.Slices) == 0 {
+			return fmt.Errorf("path %s has no slices", path.Path)
+		}
+		for i, sliceName := range path.Slices {
+			if !sliceExist[sliceName] {
+				return fmt.Errorf("path %s refers to slice %s not found in slices", path.Path, sliceName)
+			}
+			if slices.Contains(path.Slices[:i], sliceName) {
+				return fmt.Errorf("path %s lists slice %s twice", path.Path, sliceName)
+			}
+		}
+	}
+	return nil
+}
+
 type prefixable interface {
 	Path | Content | Package | Slice
 }
@@ -1,6 +1,8 @@
 package manifest_test
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path"
 	"slices"
@@ -9,6 +11,8 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/testutil"
 )
 
 type manifestContents struct {
@@ -206,3 +210,156 @@ func dumpManifestContents(c *C, mfest *manifest.Manifest) *manifestContents {
 	}
 	return &mc
 }
+
+var writeTests = []struct {
+	summary string
+	options *manifest.WriteOptions
+	output  string
+	error   string
+}{{
+	summary: "All types",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{
+			{Name: "pkg2", Version: "v2", Digest: "hash2", Arch: "arch2"},
+			{Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "arch1"},
+		},
+		Slices: []*setup.Slice{
+			{Package: "pkg1", Name: "myslice"},
+			{Package: "pkg1", Name: "manifest"},
+			{Package: "pkg2", Name: "myotherslice"},
+		},
+		Paths: []*manifest.Path{
+			{Path: "/dir/file", Mode: "0644", Slices: []string{"pkg1_myslice"}, Hash: "hash", FinalHash: "finalhash", Size: 21},
+			{Path: "/dir/foo/bar/", Mode: "01777", Slices: []string{"pkg2_myotherslice", "pkg1_myslice"}},
+			{Path: "/dir/link/file", Mode: "0644", Slices: []string{"pkg1_myslice"}, Link: "/dir/file"},
+			{Path: "/manifest/manifest.wall", Mode: "0644", Slices: []string{"pkg1_manifest"}},
+		},
+	},
+	output: `
+		{"jsonwall":"1.0","schema":"1.0","count":15}
+		{"kind":"content","slice":"pkg1_manifest","path":"/manifest/manifest.wall"}
+		{"kind":"content","slice":"pkg1_myslice","path":"/dir/file"}
+		{"kind":"content","slice":"pkg1_myslice","path":"/dir/foo/bar/"}
+		{"kind":"content","slice":"pkg1_myslice","path":"/dir/link/file"}
+		{"kind":"content","slice":"pkg2_myotherslice","path":"/dir/foo/bar/"}
+		{"kind":"package","name":"pkg1","version":"v1","sha256":"hash1","arch":"arch1"}
+		{"kind":"package","name":"pkg2","version":"v2","sha256":"hash2","arch":"arch2"}
+		{"kind":"path","path":"/dir/file","mode":"0644","slices":["pkg1_myslice"],"sha256":"hash","final_sha256":"finalhash","size":21}
+		{"kind":"path","path":"/dir/foo/bar/","mode":"01777","slices":["pkg1_myslice","pkg2_myotherslice"]}
+		{"kind":"path","path":"/dir/link/file","mode":"0644","slices":["pkg1_myslice"],"link":"/dir/file"}
+		{"kind":"path","path":"/manifest/manifest.wall","mode":"0644","slices":["pkg1_manifest"]}
+		{"kind":"slice","name":"pkg1_manifest"}
+		{"kind":"slice","name":"pkg1_myslice"}
+		{"kind":"slice","name":"pkg2_myotherslice"}
+	`,
+}, {
+	summary: "Empty manifest",
+	options: &manifest.WriteOptions{},
+	output: `
+		{"jsonwall":"1.0","schema":"1.0","count":1}
+	`,
+}, {
+	summary: "Package without name",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Version: "v1"}},
+	},
+	error: `cannot write manifest: package has no name`,
+}, {
+	summary: "Package listed twice",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}, {Name: "pkg1"}},
+	},
+	error: `cannot write manifest: package "pkg1" listed twice`,
+}, {
+	summary: "Package not found",
+	options: &manifest.WriteOptions{
+		Slices: []*setup.Slice{{Package: "pkg1", Name: "myslice"}},
+	},
+	error: `cannot write manifest: package "pkg1" not found in packages`,
+}, {
+	summary: "Slice listed twice",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}},
+		Slices: []*setup.Slice{
+			{Package: "pkg1", Name: "myslice"},
+			{Package: "pkg1", Name: "myslice"},
+		},
+	},
+	error: `cannot write manifest: slice pkg1_myslice listed twice`,
+}, {
+	summary: "Slice not found",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}},
+		Paths:    []*manifest.Path{{Path: "/file", Slices: []string{"pkg1_myslice"}}},
+	},
+	error: `cannot write manifest: path /file refers to slice pkg1_myslice not found in slices`,
+}, {
+	summary: "Path without slices",
+	options: &manifest.WriteOptions{
+		Paths: []*manifest.Path{{Path: "/file"}},
+	},
+	error: `cannot write manifest: path /file has no slices`,
+}, {
+	summary: "Relative path",
+	options: &manifest.WriteOptions{
+		Paths: []*manifest.Path{{Path: "file"}},
+	},
+	error: `cannot write manifest: invalid path: "file"`,
+}, {
+	summary: "Path listed twice",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}},
+		Slices:   []*setup.Slice{{Package: "pkg1", Name: "myslice"}},
+		Paths: []*manifest.Path{
+			{Path: "/file", Slices: []string{"pkg1_myslice"}},
+			{Path: "/file", Slices: []string{"pkg1_myslice"}},
+		},
+	},
+	error: `cannot write manifest: path /file listed twice`,
+}, {
+	summary: "Slice listed twice in path",
+	options: &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}},
+		Slices:   []*setup.Slice{{Package: "pkg1", Name: "myslice"}},
+		Paths:    []*manifest.Path{{Path: "/file", Slices: []string{"pkg1_myslice", "pkg1_myslice"}}},
+	},
+	error: `cannot write manifest: path /file lists slice pkg1_myslice twice`,
+}}
+
+func (s *S) TestWrite(c *C) {
+	for _, test := range writeTests {
+		c.Logf("Summary: %s", test.summary)
+
+		var buf bytes.Buffer
+		err := manifest.Write(&buf, test.options)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		output := strings.TrimSpace(string(testutil.Reindent(test.output))) + "\n"
+		c.Assert(buf.String(), Equals, output)
+
+		// The written manifest must always be valid.
+		mfest, err := manifest.Read(&buf)
+		c.Assert(err, IsNil)
+		err = manifest.Validate(mfest)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *S) TestWriteKeepsOptions(c *C) {
+	path := &manifest.Path{Path: "/file", Slices: []string{"pkg1_slice2", "pkg1_slice1"}}
+	options := &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "pkg1"}},
+		Slices: []*setup.Slice{
+			{Package: "pkg1", Name: "slice1"},
+			{Package: "pkg1", Name: "slice2"},
+		},
+		Paths: []*manifest.Path{path},
+	}
+	err := manifest.Write(io.Discard, options)
+	c.Assert(err, IsNil)
+	c.Assert(path, DeepEquals, &manifest.Path{Path: "/file", Slices: []string{"pkg1_slice2", "pkg1_slice1"}})
+	c.Assert(options.Packages[0].Kind, Equals, "")
+}
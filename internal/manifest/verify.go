@@ -0,0 +1,242 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/canonical/chisel/internal/fsutil"
+)
+
+type ProblemKind string
+
+const (
+	ProblemMissing  ProblemKind = "missing"
+	ProblemModified ProblemKind = "modified"
+	ProblemExtra    ProblemKind = "extra"
+)
+
+// Problem describes a path in which the filesystem differs from the manifest.
+type Problem struct {
+	Path   string      `json:"path"`
+	Kind   ProblemKind `json:"kind"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// Verify compares the tree at rootDir with the paths in the manifest and
+// returns the problems found, sorted by path. Every path in the manifest
+// must exist with the same type, mode, link, size and content, as recorded
+// after mutation, and every path in the tree must be in the manifest,
+// except for the parent directories of the paths in the manifest, as these
+// are not listed in it. The content of the manifest files themselves is
+// not compared, as they cannot describe their own digest and size.
+//
+// Ownership and extended attributes, including file capabilities, are not
+// recorded in manifests and so they are not verified. Character and block
+// devices are only created when cutting as root, so when not running as root
+// they are allowed to be missing.
+func Verify(manifest *Manifest, rootDir string) (problems []*Problem, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot verify manifest: %w", err)
+		}
+	}()
+	rootDir = filepath.Clean(rootDir)
+
+	paths := make(map[string]*Path)
+	parents := make(map[string]bool)
+	err = manifest.IteratePaths("", func(path *Path) error {
+		paths[path.Path] = path
+		for dir := parentDir(path.Path); dir != "/" && !parents[dir]; dir = parentDir(dir) {
+			parents[dir] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		problem, err := verifyPath(rootDir, path)
+		if err != nil {
+			return nil, err
+		}
+		if problem != nil {
+			problems = append(problems, problem)
+		}
+	}
+
+	err = filepath.WalkDir(rootDir, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(rootDir, fullPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.Clean("/" + relPath)
+		if relPath == "/" {
+			return nil
+		}
+		if d.IsDir() {
+			relPath += "/"
+		}
+		if paths[relPath] != nil || parents[relPath] {
+			return nil
+		}
+		problems = append(problems, &Problem{Path: relPath, Kind: ProblemExtra})
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+func verifyPath(rootDir string, path *Path) (*Problem, error) {
+	fullPath := filepath.Join(rootDir, path.Path)
+	info, err := os.Lstat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		if (path.Device == "char" || path.Device == "block") && os.Geteuid() != 0 {
+			return nil, nil
+		}
+		return &Problem{Path: path.Path, Kind: ProblemMissing}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	modified := func(format string, args ...any) (*Problem, error) {
+		return &Problem{
+			Path:   path.Path,
+			Kind:   ProblemModified,
+			Detail: fmt.Sprintf(format, args...),
+		}, nil
+	}
+
+	expectedType := pathType(path)
+	foundType := modeType(info.Mode())
+	if foundType != expectedType {
+		return modified("expected %s, found %s", expectedType, foundType)
+	}
+	if path.Mode != "" && foundType != "symlink" {
+		mode, err := strconv.ParseUint(path.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("path %s has invalid mode: %q", path.Path, path.Mode)
+		}
+		if foundMode := fsutil.UnixPerm(info.Mode()); foundMode != uint32(mode) {
+			return modified("expected mode 0%o, found 0%o", mode, foundMode)
+		}
+	}
+
+	switch foundType {
+	case "symlink":
+		link, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if link != path.Link {
+			return modified("expected link %q, found %q", path.Link, link)
+		}
+	case "char device", "block device":
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil, fmt.Errorf("cannot read device numbers of %s", path.Path)
+		}
+		major, minor := unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev))
+		if major != path.Major || minor != path.Minor {
+			return modified("expected device %d:%d, found %d:%d", path.Major, path.Minor, major, minor)
+		}
+	case "file":
+		hash := path.FinalHash
+		if hash == "" {
+			hash = path.Hash
+		}
+		if hash == "" {
+			// Manifests do not describe their own content.
+			return nil, nil
+		}
+		if uint64(info.Size()) != path.Size {
+			return modified("expected size %d, found %d", path.Size, info.Size())
+		}
+		foundHash, err := fileHash(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if foundHash != hash {
+			return modified("expected sha256 %s, found %s", hash, foundHash)
+		}
+	}
+	return nil, nil
+}
+
+// pathType returns the type of the path, as named by modeType.
+func pathType(path *Path) string {
+	switch {
+	case strings.HasSuffix(path.Path, "/"):
+		return "directory"
+	case path.Link != "":
+		return "symlink"
+	case path.Device == "char":
+		return "char device"
+	case path.Device == "block":
+		return "block device"
+	case path.Device == "fifo":
+		return "fifo"
+	}
+	return "file"
+}
+
+func modeType(mode fs.FileMode) string {
+	switch mode.Type() {
+	case 0:
+		return "file"
+	case fs.ModeDir:
+		return "directory"
+	case fs.ModeSymlink:
+		return "symlink"
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return "char device"
+	case fs.ModeDevice:
+		return "block device"
+	case fs.ModeNamedPipe:
+		return "fifo"
+	}
+	return "unsupported file type"
+}
+
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// parentDir returns the parent directory of path, with a trailing slash.
+func parentDir(path string) string {
+	dir := filepath.Dir(strings.TrimSuffix(path, "/"))
+	if dir == "/" {
+		return dir
+	}
+	return dir + "/"
+}
@@ -0,0 +1,194 @@
+package manifest_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+func sha256Hex(data string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+var verifyManifest = &manifest.WriteOptions{
+	Packages: []*manifest.Package{{Name: "mypkg"}},
+	Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+	Paths: []*manifest.Path{{
+		Path:   "/dir/",
+		Mode:   "01777",
+		Slices: []string{"mypkg_myslice"},
+	}, {
+		Path:   "/dir/file",
+		Mode:   "0644",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   sha256Hex("data"),
+		Size:   4,
+	}, {
+		Path:      "/dir/mutated",
+		Mode:      "0644",
+		Slices:    []string{"mypkg_myslice"},
+		Hash:      sha256Hex("data"),
+		FinalHash: sha256Hex("mutated"),
+		Size:      7,
+	}, {
+		Path:   "/dir/link",
+		Mode:   "0777",
+		Slices: []string{"mypkg_myslice"},
+		Link:   "file",
+	}, {
+		Path:   "/parent/sub/file",
+		Mode:   "0755",
+		Slices: []string{"mypkg_myslice"},
+		Hash:   sha256Hex(""),
+	}, {
+		Path:   "/db/manifest.wall",
+		Mode:   "0644",
+		Slices: []string{"mypkg_myslice"},
+	}},
+}
+
+// writeVerifyTree writes the tree described by verifyManifest into dir.
+func writeVerifyTree(c *C, dir string) {
+	c.Assert(os.Mkdir(filepath.Join(dir, "dir"), 0755), IsNil)
+	c.Assert(os.Chmod(filepath.Join(dir, "dir"), 0777|os.ModeSticky), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "dir/file"), []byte("data"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "dir/mutated"), []byte("mutated"), 0644), IsNil)
+	c.Assert(os.Symlink("file", filepath.Join(dir, "dir/link")), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "parent/sub"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "parent/sub/file"), nil, 0755), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "db"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "db/manifest.wall"), []byte("manifest"), 0644), IsNil)
+}
+
+var verifyTests = []struct {
+	summary  string
+	modify   func(c *C, dir string)
+	problems []*manifest.Problem
+}{{
+	summary: "Unmodified tree",
+}, {
+	summary: "Missing paths",
+	modify: func(c *C, dir string) {
+		c.Assert(os.Remove(filepath.Join(dir, "dir/link")), IsNil)
+		c.Assert(os.RemoveAll(filepath.Join(dir, "parent")), IsNil)
+	},
+	problems: []*manifest.Problem{
+		{Path: "/dir/link", Kind: manifest.ProblemMissing},
+		{Path: "/parent/sub/file", Kind: manifest.ProblemMissing},
+	},
+}, {
+	summary: "Modified content",
+	modify: func(c *C, dir string) {
+		c.Assert(os.WriteFile(filepath.Join(dir, "dir/file"), []byte("DATA"), 0644), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(dir, "dir/mutated"), []byte("data"), 0644), IsNil)
+	},
+	problems: []*manifest.Problem{{
+		Path:   "/dir/file",
+		Kind:   manifest.ProblemModified,
+		Detail: fmt.Sprintf("expected sha256 %s, found %s", sha256Hex("data"), sha256Hex("DATA")),
+	}, {
+		Path:   "/dir/mutated",
+		Kind:   manifest.ProblemModified,
+		Detail: "expected size 7, found 4",
+	}},
+}, {
+	summary: "Modified metadata",
+	modify: func(c *C, dir string) {
+		c.Assert(os.Chmod(filepath.Join(dir, "dir"), 0755), IsNil)
+		c.Assert(os.Chmod(filepath.Join(dir, "parent/sub/file"), 0644), IsNil)
+		c.Assert(os.Remove(filepath.Join(dir, "dir/link")), IsNil)
+		c.Assert(os.Symlink("mutated", filepath.Join(dir, "dir/link")), IsNil)
+		c.Assert(os.Remove(filepath.Join(dir, "dir/mutated")), IsNil)
+		c.Assert(os.Symlink("file", filepath.Join(dir, "dir/mutated")), IsNil)
+	},
+	problems: []*manifest.Problem{{
+		Path:   "/dir/",
+		Kind:   manifest.ProblemModified,
+		Detail: "expected mode 01777, found 0755",
+	}, {
+		Path:   "/dir/link",
+		Kind:   manifest.ProblemModified,
+		Detail: `expected link "file", found "mutated"`,
+	}, {
+		Path:   "/dir/mutated",
+		Kind:   manifest.ProblemModified,
+		Detail: "expected file, found symlink",
+	}, {
+		Path:   "/parent/sub/file",
+		Kind:   manifest.ProblemModified,
+		Detail: "expected mode 0755, found 0644",
+	}},
+}, {
+	summary: "Extra paths",
+	modify: func(c *C, dir string) {
+		c.Assert(os.WriteFile(filepath.Join(dir, "dir/extra"), nil, 0644), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(dir, "extra-dir/sub"), 0755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(dir, "extra-dir/sub/file"), nil, 0644), IsNil)
+		c.Assert(os.Symlink("dir", filepath.Join(dir, "parent/link")), IsNil)
+	},
+	problems: []*manifest.Problem{
+		{Path: "/dir/extra", Kind: manifest.ProblemExtra},
+		{Path: "/extra-dir/", Kind: manifest.ProblemExtra},
+		{Path: "/parent/link", Kind: manifest.ProblemExtra},
+	},
+}}
+
+func (s *S) TestVerify(c *C) {
+	var buf bytes.Buffer
+	err := manifest.Write(&buf, verifyManifest)
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+
+	for _, test := range verifyTests {
+		c.Logf("Summary: %s", test.summary)
+		dir := c.MkDir()
+		writeVerifyTree(c, dir)
+		if test.modify != nil {
+			test.modify(c, dir)
+		}
+		problems, err := manifest.Verify(mfest, dir)
+		c.Assert(err, IsNil)
+		c.Assert(problems, DeepEquals, test.problems)
+	}
+}
+
+func (s *S) TestVerifyMissingDevices(c *C) {
+	var buf bytes.Buffer
+	err := manifest.Write(&buf, &manifest.WriteOptions{
+		Packages: []*manifest.Package{{Name: "mypkg"}},
+		Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+		Paths: []*manifest.Path{{
+			Path:   "/dev/null",
+			Mode:   "0666",
+			Slices: []string{"mypkg_myslice"},
+			Device: "char",
+			Major:  1,
+			Minor:  3,
+		}, {
+			Path:   "/dev/fifo",
+			Mode:   "0644",
+			Slices: []string{"mypkg_myslice"},
+			Device: "fifo",
+		}},
+	})
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+
+	problems, err := manifest.Verify(mfest, c.MkDir())
+	c.Assert(err, IsNil)
+	expected := []*manifest.Problem{{Path: "/dev/fifo", Kind: manifest.ProblemMissing}}
+	if os.Geteuid() == 0 {
+		// Devices are only skipped when cutting without privileges.
+		expected = append(expected, &manifest.Problem{Path: "/dev/null", Kind: manifest.ProblemMissing})
+	}
+	c.Assert(problems, DeepEquals, expected)
+}
@@ -0,0 +1,103 @@
+package sbom
+
+import (
+	"time"
+)
+
+// The CycloneDX 1.5 JSON format, as documented in
+// https://cyclonedx.org/docs/1.5/json/.
+
+type cdxDoc struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []*cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     cdxTools      `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxTools struct {
+	Components []*cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string          `json:"type"`
+	BOMRef     string          `json:"bom-ref,omitempty"`
+	Name       string          `json:"name"`
+	Version    string          `json:"version,omitempty"`
+	Hashes     []cdxHash       `json:"hashes,omitempty"`
+	PURL       string          `json:"purl,omitempty"`
+	Components []*cdxComponent `json:"components,omitempty"`
+}
+
+type cdxHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+// cycloneDXDocument describes every package as a component with one
+// sub-component per slice, which in turn has the files the slice installed
+// as sub-components. Files installed by multiple slices are listed under
+// each of them, with a distinct reference.
+func cycloneDXDocument(options *Options, pkgs []*sbomPackage) *cdxDoc {
+	doc := &cdxDoc{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + documentUUID(options, pkgs),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: options.Created.UTC().Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []*cdxComponent{{
+					Type:    "application",
+					Name:    "chisel",
+					Version: options.ToolVersion,
+				}},
+			},
+		},
+		Components: []*cdxComponent{},
+	}
+	if options.Name != "" {
+		doc.Metadata.Component = &cdxComponent{
+			Type: "container",
+			Name: options.Name,
+		}
+	}
+	for _, pkg := range pkgs {
+		pkgComponent := &cdxComponent{
+			Type:    "library",
+			BOMRef:  "package:" + pkg.Name,
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			PURL:    packageURL(pkg, options.Distro),
+		}
+		if pkg.Digest != "" {
+			pkgComponent.Hashes = []cdxHash{{Algorithm: "SHA-256", Content: pkg.Digest}}
+		}
+		for _, slice := range pkg.slices {
+			sliceComponent := &cdxComponent{
+				Type:    "library",
+				BOMRef:  "slice:" + slice.name,
+				Name:    slice.name,
+				Version: pkg.Version,
+			}
+			for _, file := range slice.files {
+				sliceComponent.Components = append(sliceComponent.Components, &cdxComponent{
+					Type:   "file",
+					BOMRef: "file:" + slice.name + ":" + file.path,
+					Name:   file.path,
+					Hashes: []cdxHash{{Algorithm: "SHA-256", Content: file.hash}},
+				})
+			}
+			pkgComponent.Components = append(pkgComponent.Components, sliceComponent)
+		}
+		doc.Components = append(doc.Components, pkgComponent)
+	}
+	return doc
+}
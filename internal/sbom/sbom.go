@@ -0,0 +1,260 @@
+package sbom
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+type Format string
+
+const (
+	SPDX      Format = "spdx"
+	CycloneDX Format = "cyclonedx"
+)
+
+// Options holds the details of the SBOM to be written.
+type Options struct {
+	Format Format
+	// Name identifies the described content, such as the image name.
+	Name string
+	// Created is the creation time recorded in the SBOM.
+	Created time.Time
+	// ToolVersion is the version of chisel recorded as the SBOM creator.
+	ToolVersion string
+	// Content describes what was cut, as written into manifests.
+	Content *manifest.WriteOptions
+	// RootDir holds the content described. SPDX requires SHA1 checksums
+	// of files, which manifests do not record, so the files are read from
+	// there when writing SPDX.
+	RootDir string
+	// Distro is the distribution the packages come from, such as "ubuntu"
+	// or "debian", used as the namespace of package URLs. Manifests do not
+	// record it, so package URLs are left out when it is empty.
+	Distro string
+}
+
+// Write writes an SBOM in the requested format describing the packages,
+// slices and paths of options.Content. Each package is listed with the
+// slices cut from it, and each slice with the paths it installed, so that
+// the SBOM describes exactly what was cut rather than whole packages.
+func Write(w io.Writer, options *Options) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot write SBOM: %w", err)
+		}
+	}()
+
+	pkgs, err := sortContent(options.Content)
+	if err != nil {
+		return err
+	}
+	var doc any
+	switch options.Format {
+	case SPDX:
+		err = readSHA1s(options.RootDir, pkgs)
+		if err != nil {
+			return err
+		}
+		doc = spdxDocument(options, pkgs)
+	case CycloneDX:
+		doc = cycloneDXDocument(options, pkgs)
+	default:
+		return fmt.Errorf("unknown format %q", options.Format)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// ManifestContent returns the content described by mfest in the form
+// expected by Options.
+func ManifestContent(mfest *manifest.Manifest) (*manifest.WriteOptions, error) {
+	content := &manifest.WriteOptions{}
+	err := mfest.IteratePackages(func(pkg *manifest.Package) error {
+		content.Packages = append(content.Packages, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IterateSlices("", func(slice *manifest.Slice) error {
+		sk, err := setup.ParseSliceKey(slice.Name)
+		if err != nil {
+			return err
+		}
+		content.Slices = append(content.Slices, &setup.Slice{
+			Package: sk.Package,
+			Name:    sk.Slice,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IteratePaths("", func(path *manifest.Path) error {
+		content.Paths = append(content.Paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+type sbomPackage struct {
+	*manifest.Package
+	slices []*sbomSlice
+}
+
+type sbomSlice struct {
+	name  string
+	files []*sbomFile
+}
+
+type sbomFile struct {
+	path string
+	hash string
+	sha1 string
+}
+
+// sortContent groups the files of content by the slices that installed
+// them, and the slices by their package. Only paths with content, and thus
+// a hash, are listed. Everything is sorted by name.
+func sortContent(content *manifest.WriteOptions) ([]*sbomPackage, error) {
+	var pkgs []*sbomPackage
+	pkgsByName := make(map[string]*sbomPackage)
+	for _, pkg := range content.Packages {
+		sbomPkg := &sbomPackage{Package: pkg}
+		pkgs = append(pkgs, sbomPkg)
+		pkgsByName[pkg.Name] = sbomPkg
+	}
+	slicesByName := make(map[string]*sbomSlice)
+	for _, slice := range content.Slices {
+		pkg, ok := pkgsByName[slice.Package]
+		if !ok {
+			return nil, fmt.Errorf("slice %s refers to unknown package %q", slice, slice.Package)
+		}
+		sbomSlice := &sbomSlice{name: slice.String()}
+		pkg.slices = append(pkg.slices, sbomSlice)
+		slicesByName[sbomSlice.name] = sbomSlice
+	}
+	for _, path := range content.Paths {
+		hash := path.FinalHash
+		if hash == "" {
+			hash = path.Hash
+		}
+		if hash == "" {
+			continue
+		}
+		file := &sbomFile{path: path.Path, hash: hash}
+		for _, sliceName := range path.Slices {
+			slice, ok := slicesByName[sliceName]
+			if !ok {
+				return nil, fmt.Errorf("path %s refers to unknown slice %s", path.Path, sliceName)
+			}
+			slice.files = append(slice.files, file)
+		}
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	for _, pkg := range pkgs {
+		sort.Slice(pkg.slices, func(i, j int) bool { return pkg.slices[i].name < pkg.slices[j].name })
+		for _, slice := range pkg.slices {
+			sort.Slice(slice.files, func(i, j int) bool { return slice.files[i].path < slice.files[j].path })
+		}
+	}
+	return pkgs, nil
+}
+
+// readSHA1s sets the SHA1 checksum of every file by reading it from rootDir.
+// Files must have the content recorded in the manifest, so that the checksums
+// describe the same data.
+func readSHA1s(rootDir string, pkgs []*sbomPackage) error {
+	if rootDir == "" {
+		return fmt.Errorf("cannot compute file checksums: no root directory")
+	}
+	for _, pkg := range pkgs {
+		for _, slice := range pkg.slices {
+			for _, file := range slice.files {
+				if file.sha1 != "" {
+					continue
+				}
+				sum1, sum256, err := fileSums(filepath.Join(rootDir, file.path))
+				if err != nil {
+					return fmt.Errorf("cannot compute file checksums: %w", err)
+				}
+				if sum256 != file.hash {
+					return fmt.Errorf("file %s does not match the manifest", file.path)
+				}
+				file.sha1 = sum1
+			}
+		}
+	}
+	return nil
+}
+
+// fileSums returns the SHA1 and SHA256 checksums of the file at path.
+func fileSums(path string) (sum1, sum256 string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	h1 := sha1.New()
+	h256 := sha256.New()
+	_, err = io.Copy(io.MultiWriter(h1, h256), file)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil)), nil
+}
+
+// packageURL returns the package URL identifying pkg in distro, as
+// described in https://github.com/package-url/purl-spec, or an empty
+// string when distro is unknown.
+func packageURL(pkg *sbomPackage, distro string) string {
+	if distro == "" {
+		return ""
+	}
+	purl := "pkg:deb/" + url.PathEscape(distro) + "/" + url.PathEscape(pkg.Name)
+	if pkg.Version != "" {
+		purl += "@" + url.QueryEscape(pkg.Version)
+	}
+	if pkg.Arch != "" {
+		purl += "?arch=" + url.QueryEscape(pkg.Arch)
+	}
+	return purl
+}
+
+// documentUUID returns a UUID derived from everything the SBOM describes,
+// so that writing the same SBOM twice results in the same identifier.
+func documentUUID(options *Options, pkgs []*sbomPackage) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", options.Format, options.Name, options.Created.UTC().Format(time.RFC3339))
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "%s %s %s %s\n", pkg.Name, pkg.Version, pkg.Digest, pkg.Arch)
+		for _, slice := range pkg.slices {
+			fmt.Fprintf(h, "%s\n", slice.name)
+			for _, file := range slice.files {
+				fmt.Fprintf(h, "%s %s\n", file.path, file.hash)
+			}
+		}
+	}
+	sum := h.Sum(nil)
+	// Mark it as a name-based UUID (version 5) of the RFC 4122 variant.
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,500 @@
+package sbom_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/sbom"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+func sha1Hex(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// sbomFiles holds the content of the files in sbomContent.
+var sbomFiles = map[string]string{
+	"/dir/file1": "data1",
+	"/dir/file2": "mutated2",
+}
+
+// makeSBOMRoot writes the files of sbomContent into a new directory.
+func makeSBOMRoot(c *C) string {
+	rootDir := c.MkDir()
+	for path, data := range sbomFiles {
+		fpath := filepath.Join(rootDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, []byte(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	return rootDir
+}
+
+var sbomContent = &manifest.WriteOptions{
+	Packages: []*manifest.Package{{
+		Name:    "mypkg2",
+		Version: "2.0",
+		Digest:  "digest2",
+		Arch:    "amd64",
+	}, {
+		Name:    "mypkg1",
+		Version: "1.0",
+		Digest:  "digest1",
+		Arch:    "all",
+	}},
+	Slices: []*setup.Slice{
+		{Package: "mypkg1", Name: "myslice"},
+		{Package: "mypkg2", Name: "myslice2"},
+		{Package: "mypkg2", Name: "myslice1"},
+	},
+	Paths: []*manifest.Path{{
+		Path:   "/dir/",
+		Mode:   "0755",
+		Slices: []string{"mypkg1_myslice", "mypkg2_myslice1"},
+	}, {
+		Path:   "/dir/file1",
+		Mode:   "0644",
+		Slices: []string{"mypkg1_myslice", "mypkg2_myslice1"},
+		Hash:   sha256Hex("data1"),
+		Size:   5,
+	}, {
+		Path:      "/dir/file2",
+		Mode:      "0644",
+		Slices:    []string{"mypkg2_myslice2"},
+		Hash:      sha256Hex("data2"),
+		FinalHash: sha256Hex("mutated2"),
+		Size:      5,
+	}, {
+		Path:   "/dir/link",
+		Mode:   "0777",
+		Slices: []string{"mypkg2_myslice2"},
+		Link:   "file2",
+	}},
+}
+
+type sbomTest struct {
+	summary  string
+	options  sbom.Options
+	expected string
+	error    string
+}
+
+var sbomTests = []sbomTest{{
+	summary: "SPDX",
+	options: sbom.Options{
+		Format:      sbom.SPDX,
+		Name:        "myimage",
+		Created:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ToolVersion: "1.0",
+		Content:     sbomContent,
+		Distro:      "ubuntu",
+	},
+	expected: `{
+		"spdxVersion": "SPDX-2.3",
+		"dataLicense": "CC0-1.0",
+		"SPDXID": "SPDXRef-DOCUMENT",
+		"name": "myimage",
+		"documentNamespace": "urn:uuid:<uuid>",
+		"creationInfo": {
+			"created": "2024-01-02T03:04:05Z",
+			"creators": ["Tool: chisel-1.0"]
+		},
+		"packages": [{
+			"SPDXID": "SPDXRef-Package-mypkg1",
+			"name": "mypkg1",
+			"versionInfo": "1.0",
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed": false,
+			"checksums": [{"algorithm": "SHA256", "checksumValue": "digest1"}],
+			"externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/ubuntu/mypkg1@1.0?arch=all"}]
+		}, {
+			"SPDXID": "SPDXRef-Slice-mypkg1.5fmyslice",
+			"name": "mypkg1_myslice",
+			"versionInfo": "1.0",
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed": false,
+			"comment": "Slice mypkg1_myslice of package mypkg1."
+		}, {
+			"SPDXID": "SPDXRef-Package-mypkg2",
+			"name": "mypkg2",
+			"versionInfo": "2.0",
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed": false,
+			"checksums": [{"algorithm": "SHA256", "checksumValue": "digest2"}],
+			"externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/ubuntu/mypkg2@2.0?arch=amd64"}]
+		}, {
+			"SPDXID": "SPDXRef-Slice-mypkg2.5fmyslice1",
+			"name": "mypkg2_myslice1",
+			"versionInfo": "2.0",
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed": false,
+			"comment": "Slice mypkg2_myslice1 of package mypkg2."
+		}, {
+			"SPDXID": "SPDXRef-Slice-mypkg2.5fmyslice2",
+			"name": "mypkg2_myslice2",
+			"versionInfo": "2.0",
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed": false,
+			"comment": "Slice mypkg2_myslice2 of package mypkg2."
+		}],
+		"files": [{
+			"SPDXID": "SPDXRef-File-1",
+			"fileName": "/dir/file1",
+			"checksums": [
+				{"algorithm": "SHA1", "checksumValue": "` + sha1Hex("data1") + `"},
+				{"algorithm": "SHA256", "checksumValue": "` + sha256Hex("data1") + `"}
+			]
+		}, {
+			"SPDXID": "SPDXRef-File-2",
+			"fileName": "/dir/file2",
+			"checksums": [
+				{"algorithm": "SHA1", "checksumValue": "` + sha1Hex("mutated2") + `"},
+				{"algorithm": "SHA256", "checksumValue": "` + sha256Hex("mutated2") + `"}
+			]
+		}],
+		"relationships": [
+			{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-mypkg1"},
+			{"spdxElementId": "SPDXRef-Package-mypkg1", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-mypkg1.5fmyslice"},
+			{"spdxElementId": "SPDXRef-Slice-mypkg1.5fmyslice", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-1"},
+			{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-mypkg2"},
+			{"spdxElementId": "SPDXRef-Package-mypkg2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-mypkg2.5fmyslice1"},
+			{"spdxElementId": "SPDXRef-Slice-mypkg2.5fmyslice1", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-1"},
+			{"spdxElementId": "SPDXRef-Package-mypkg2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-mypkg2.5fmyslice2"},
+			{"spdxElementId": "SPDXRef-Slice-mypkg2.5fmyslice2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-2"}
+		]
+	}`,
+}, {
+	summary: "CycloneDX",
+	options: sbom.Options{
+		Format:      sbom.CycloneDX,
+		Name:        "myimage",
+		Created:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ToolVersion: "1.0",
+		Content:     sbomContent,
+		Distro:      "ubuntu",
+	},
+	expected: `{
+		"bomFormat": "CycloneDX",
+		"specVersion": "1.5",
+		"serialNumber": "urn:uuid:<uuid>",
+		"version": 1,
+		"metadata": {
+			"timestamp": "2024-01-02T03:04:05Z",
+			"tools": {"components": [{"type": "application", "name": "chisel", "version": "1.0"}]},
+			"component": {"type": "container", "name": "myimage"}
+		},
+		"components": [{
+			"type": "library",
+			"bom-ref": "package:mypkg1",
+			"name": "mypkg1",
+			"version": "1.0",
+			"hashes": [{"alg": "SHA-256", "content": "digest1"}],
+			"purl": "pkg:deb/ubuntu/mypkg1@1.0?arch=all",
+			"components": [{
+				"type": "library",
+				"bom-ref": "slice:mypkg1_myslice",
+				"name": "mypkg1_myslice",
+				"version": "1.0",
+				"components": [{
+					"type": "file",
+					"bom-ref": "file:mypkg1_myslice:/dir/file1",
+					"name": "/dir/file1",
+					"hashes": [{"alg": "SHA-256", "content": "` + sha256Hex("data1") + `"}]
+				}]
+			}]
+		}, {
+			"type": "library",
+			"bom-ref": "package:mypkg2",
+			"name": "mypkg2",
+			"version": "2.0",
+			"hashes": [{"alg": "SHA-256", "content": "digest2"}],
+			"purl": "pkg:deb/ubuntu/mypkg2@2.0?arch=amd64",
+			"components": [{
+				"type": "library",
+				"bom-ref": "slice:mypkg2_myslice1",
+				"name": "mypkg2_myslice1",
+				"version": "2.0",
+				"components": [{
+					"type": "file",
+					"bom-ref": "file:mypkg2_myslice1:/dir/file1",
+					"name": "/dir/file1",
+					"hashes": [{"alg": "SHA-256", "content": "` + sha256Hex("data1") + `"}]
+				}]
+			}, {
+				"type": "library",
+				"bom-ref": "slice:mypkg2_myslice2",
+				"name": "mypkg2_myslice2",
+				"version": "2.0",
+				"components": [{
+					"type": "file",
+					"bom-ref": "file:mypkg2_myslice2:/dir/file2",
+					"name": "/dir/file2",
+					"hashes": [{"alg": "SHA-256", "content": "` + sha256Hex("mutated2") + `"}]
+				}]
+			}]
+		}]
+	}`,
+}, {
+	summary: "Unknown format",
+	options: sbom.Options{
+		Format:  "foo",
+		Content: sbomContent,
+	},
+	error: `cannot write SBOM: unknown format "foo"`,
+}, {
+	summary: "Slice of unknown package",
+	options: sbom.Options{
+		Format: sbom.SPDX,
+		Content: &manifest.WriteOptions{
+			Slices: []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+		},
+	},
+	error: `cannot write SBOM: slice mypkg_myslice refers to unknown package "mypkg"`,
+}, {
+	summary: "Path of unknown slice",
+	options: sbom.Options{
+		Format: sbom.SPDX,
+		Content: &manifest.WriteOptions{
+			Paths: []*manifest.Path{{Path: "/file", Slices: []string{"mypkg_myslice"}, Hash: "hash"}},
+		},
+	},
+	error: `cannot write SBOM: path /file refers to unknown slice mypkg_myslice`,
+}, {
+	summary: "SPDX file changed since the manifest was written",
+	options: sbom.Options{
+		Format: sbom.SPDX,
+		Content: &manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "mypkg"}},
+			Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+			Paths:    []*manifest.Path{{Path: "/dir/file1", Slices: []string{"mypkg_myslice"}, Hash: "hash"}},
+		},
+	},
+	error: `cannot write SBOM: file /dir/file1 does not match the manifest`,
+}, {
+	summary: "SPDX file missing",
+	options: sbom.Options{
+		Format: sbom.SPDX,
+		Content: &manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "mypkg"}},
+			Slices:   []*setup.Slice{{Package: "mypkg", Name: "myslice"}},
+			Paths:    []*manifest.Path{{Path: "/missing", Slices: []string{"mypkg_myslice"}, Hash: "hash"}},
+		},
+	},
+	error: `cannot write SBOM: cannot compute file checksums: open .*/missing: no such file or directory`,
+}}
+
+func (s *S) TestWrite(c *C) {
+	rootDir := makeSBOMRoot(c)
+	for _, test := range sbomTests {
+		c.Logf("Summary: %s", test.summary)
+		options := test.options
+		options.RootDir = rootDir
+		var buf bytes.Buffer
+		err := sbom.Write(&buf, &options)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+
+		var obtained, expected map[string]any
+		err = json.Unmarshal(buf.Bytes(), &obtained)
+		c.Assert(err, IsNil)
+		err = json.Unmarshal([]byte(test.expected), &expected)
+		c.Assert(err, IsNil)
+
+		// The document UUID is checked separately below.
+		for _, key := range []string{"documentNamespace", "serialNumber"} {
+			if uuid, ok := obtained[key]; ok {
+				c.Assert(uuid, Matches, `urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`)
+				obtained[key] = "urn:uuid:<uuid>"
+			}
+		}
+		c.Assert(obtained, DeepEquals, expected)
+	}
+}
+
+func (s *S) TestWriteUUID(c *C) {
+	write := func(options sbom.Options) string {
+		var buf bytes.Buffer
+		err := sbom.Write(&buf, &options)
+		c.Assert(err, IsNil)
+		var doc map[string]any
+		err = json.Unmarshal(buf.Bytes(), &doc)
+		c.Assert(err, IsNil)
+		return doc["documentNamespace"].(string)
+	}
+	options := sbom.Options{
+		Format:  sbom.SPDX,
+		Name:    "myimage",
+		Content: sbomContent,
+		RootDir: makeSBOMRoot(c),
+	}
+	uuid := write(options)
+
+	// The same content always results in the same identifier.
+	c.Assert(write(options), Equals, uuid)
+
+	options.Name = "otherimage"
+	c.Assert(write(options), Not(Equals), uuid)
+}
+
+func (s *S) TestManifestContent(c *C) {
+	var buf bytes.Buffer
+	err := manifest.Write(&buf, sbomContent)
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(&buf)
+	c.Assert(err, IsNil)
+
+	content, err := sbom.ManifestContent(mfest)
+	c.Assert(err, IsNil)
+
+	// The SBOM written from the manifest is the same.
+	options := sbom.Options{Format: sbom.CycloneDX, Content: sbomContent}
+	var expected bytes.Buffer
+	err = sbom.Write(&expected, &options)
+	c.Assert(err, IsNil)
+	options.Content = content
+	var obtained bytes.Buffer
+	err = sbom.Write(&obtained, &options)
+	c.Assert(err, IsNil)
+	c.Assert(obtained.String(), Equals, expected.String())
+}
+
+func (s *S) TestWriteSPDXRequiredFields(c *C) {
+	var buf bytes.Buffer
+	err := sbom.Write(&buf, &sbom.Options{
+		Format:  sbom.SPDX,
+		Name:    "myimage",
+		Content: sbomContent,
+		RootDir: makeSBOMRoot(c),
+		Distro:  "ubuntu",
+	})
+	c.Assert(err, IsNil)
+	var doc map[string]any
+	err = json.Unmarshal(buf.Bytes(), &doc)
+	c.Assert(err, IsNil)
+
+	// Fields required by the SPDX 2.3 specification.
+	for _, key := range []string{"spdxVersion", "dataLicense", "SPDXID", "name", "documentNamespace"} {
+		c.Assert(doc[key], Not(Equals), "", Commentf("document %s", key))
+		c.Assert(doc[key], NotNil, Commentf("document %s", key))
+	}
+	creationInfo := doc["creationInfo"].(map[string]any)
+	c.Assert(creationInfo["created"], NotNil)
+	c.Assert(creationInfo["creators"], Not(HasLen), 0)
+
+	packages := doc["packages"].([]any)
+	c.Assert(packages, Not(HasLen), 0)
+	purls := 0
+	for _, pkg := range packages {
+		pkg := pkg.(map[string]any)
+		for _, key := range []string{"SPDXID", "name", "downloadLocation"} {
+			c.Assert(pkg[key], NotNil, Commentf("package %v %s", pkg["name"], key))
+		}
+		for _, ref := range asList(pkg["externalRefs"]) {
+			ref := ref.(map[string]any)
+			if ref["referenceType"] == "purl" {
+				c.Assert(ref["referenceLocator"], Matches, `pkg:deb/ubuntu/[^@]+@[^?]+\?arch=.+`)
+				purls++
+			}
+		}
+	}
+	c.Assert(purls, Equals, len(sbomContent.Packages))
+
+	files := doc["files"].([]any)
+	c.Assert(files, HasLen, len(sbomFiles))
+	for _, file := range files {
+		file := file.(map[string]any)
+		c.Assert(file["SPDXID"], NotNil)
+		c.Assert(file["fileName"], NotNil)
+		algorithms := make(map[any]bool)
+		for _, checksum := range asList(file["checksums"]) {
+			algorithms[checksum.(map[string]any)["algorithm"]] = true
+		}
+		c.Assert(algorithms["SHA1"], Equals, true, Commentf("file %v", file["fileName"]))
+	}
+}
+
+func asList(value any) []any {
+	list, _ := value.([]any)
+	return list
+}
+
+func (s *S) TestWriteSPDXIDs(c *C) {
+	// Names that only differ in characters not allowed in identifiers
+	// still result in distinct identifiers.
+	var buf bytes.Buffer
+	err := sbom.Write(&buf, &sbom.Options{
+		Format: sbom.SPDX,
+		Content: &manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "foo"}, {Name: "foo-bar"}, {Name: "lib+x"}, {Name: "lib-x"}},
+			Slices: []*setup.Slice{
+				{Package: "foo", Name: "bar-baz"},
+				{Package: "foo-bar", Name: "baz"},
+			},
+		},
+		RootDir: c.MkDir(),
+	})
+	c.Assert(err, IsNil)
+	var doc struct {
+		Packages []struct {
+			SPDXID       string `json:"SPDXID"`
+			ExternalRefs []any  `json:"externalRefs"`
+		} `json:"packages"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &doc)
+	c.Assert(err, IsNil)
+	var ids []string
+	for _, pkg := range doc.Packages {
+		c.Assert(pkg.SPDXID, Matches, `SPDXRef-[A-Za-z0-9.-]+`)
+		ids = append(ids, pkg.SPDXID)
+		// Package URLs are left out without a distribution.
+		c.Assert(pkg.ExternalRefs, HasLen, 0)
+	}
+	c.Assert(ids, DeepEquals, []string{
+		"SPDXRef-Package-foo",
+		"SPDXRef-Slice-foo.5fbar-baz",
+		"SPDXRef-Package-foo-bar",
+		"SPDXRef-Slice-foo-bar.5fbaz",
+		"SPDXRef-Package-lib.2bx",
+		"SPDXRef-Package-lib-x",
+	})
+}
+
+func (s *S) TestWritePackageURLDistro(c *C) {
+	var buf bytes.Buffer
+	err := sbom.Write(&buf, &sbom.Options{
+		Format: sbom.CycloneDX,
+		Content: &manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "mypkg", Version: "1.0", Arch: "amd64"}},
+		},
+		Distro: "debian",
+	})
+	c.Assert(err, IsNil)
+	var doc struct {
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &doc)
+	c.Assert(err, IsNil)
+	c.Assert(doc.Components, HasLen, 1)
+	c.Assert(doc.Components[0].PURL, Equals, "pkg:deb/debian/mypkg@1.0?arch=amd64")
+}
@@ -0,0 +1,160 @@
+package sbom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The SPDX 2.3 JSON format, as documented in https://spdx.github.io/spdx-spec/v2.3/.
+
+type spdxDoc struct {
+	SPDXVersion       string              `json:"spdxVersion"`
+	DataLicense       string              `json:"dataLicense"`
+	SPDXID            string              `json:"SPDXID"`
+	Name              string              `json:"name"`
+	DocumentNamespace string              `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo    `json:"creationInfo"`
+	Packages          []*spdxPackage      `json:"packages"`
+	Files             []*spdxFile         `json:"files,omitempty"`
+	Relationships     []*spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string         `json:"SPDXID"`
+	Name             string         `json:"name"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	ExternalRefs     []spdxRef      `json:"externalRefs,omitempty"`
+	Comment          string         `json:"comment,omitempty"`
+}
+
+type spdxRef struct {
+	Category string `json:"referenceCategory"`
+	Type     string `json:"referenceType"`
+	Locator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	SPDXID    string         `json:"SPDXID"`
+	FileName  string         `json:"fileName"`
+	Checksums []spdxChecksum `json:"checksums"`
+}
+
+type spdxChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+const spdxDocumentID = "SPDXRef-DOCUMENT"
+
+// spdxDocument describes every package as an SPDX package containing one
+// SPDX package per slice, which in turn contain the files the slice
+// installed. Files installed by multiple slices are listed once.
+func spdxDocument(options *Options, pkgs []*sbomPackage) *spdxDoc {
+	doc := &spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            spdxDocumentID,
+		Name:              options.Name,
+		DocumentNamespace: "urn:uuid:" + documentUUID(options, pkgs),
+		CreationInfo: spdxCreationInfo{
+			Created:  options.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: chisel-" + options.ToolVersion},
+		},
+	}
+	fileIDs := make(map[string]string)
+	for _, pkg := range pkgs {
+		pkgID := spdxID("Package", pkg.Name)
+		spdxPkg := &spdxPackage{
+			SPDXID:           pkgID,
+			Name:             pkg.Name,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+		}
+		if purl := packageURL(pkg, options.Distro); purl != "" {
+			spdxPkg.ExternalRefs = []spdxRef{{
+				Category: "PACKAGE-MANAGER",
+				Type:     "purl",
+				Locator:  purl,
+			}}
+		}
+		if pkg.Digest != "" {
+			spdxPkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", Value: pkg.Digest}}
+		}
+		doc.Packages = append(doc.Packages, spdxPkg)
+		doc.Relationships = append(doc.Relationships, &spdxRelationship{
+			Element: spdxDocumentID,
+			Type:    "DESCRIBES",
+			Related: pkgID,
+		})
+		for _, slice := range pkg.slices {
+			sliceID := spdxID("Slice", slice.name)
+			doc.Packages = append(doc.Packages, &spdxPackage{
+				SPDXID:           sliceID,
+				Name:             slice.name,
+				VersionInfo:      pkg.Version,
+				DownloadLocation: "NOASSERTION",
+				Comment:          fmt.Sprintf("Slice %s of package %s.", slice.name, pkg.Name),
+			})
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{
+				Element: pkgID,
+				Type:    "CONTAINS",
+				Related: sliceID,
+			})
+			for _, file := range slice.files {
+				fileID, ok := fileIDs[file.path]
+				if !ok {
+					fileID = fmt.Sprintf("SPDXRef-File-%d", len(fileIDs)+1)
+					fileIDs[file.path] = fileID
+					doc.Files = append(doc.Files, &spdxFile{
+						SPDXID:   fileID,
+						FileName: file.path,
+						Checksums: []spdxChecksum{
+							{Algorithm: "SHA1", Value: file.sha1},
+							{Algorithm: "SHA256", Value: file.hash},
+						},
+					})
+				}
+				doc.Relationships = append(doc.Relationships, &spdxRelationship{
+					Element: sliceID,
+					Type:    "CONTAINS",
+					Related: fileID,
+				})
+			}
+		}
+	}
+	return doc
+}
+
+// spdxID returns an SPDX identifier for the named element. Identifiers
+// only allow letters, digits, "." and "-", so every other byte of name,
+// and "." itself, is escaped as "." followed by its hex value. Distinct
+// names thus always result in distinct identifiers.
+func spdxID(kind, name string) string {
+	var buf strings.Builder
+	buf.WriteString("SPDXRef-" + kind + "-")
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-':
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, ".%02x", b)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,25 @@
+package sbom_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/sbom"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (s *S) SetUpTest(c *C) {
+	sbom.SetDebug(true)
+	sbom.SetLogger(c)
+}
+
+func (s *S) TearDownTest(c *C) {
+	sbom.SetDebug(false)
+	sbom.SetLogger(nil)
+}
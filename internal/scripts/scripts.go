@@ -33,7 +33,10 @@ func Run(opts *RunOptions) error {
 }
 
 type ContentValue struct {
-	RootDir    string
+	RootDir string
+	// FS holds the content under RootDir. When nil, the content is read
+	// from and written to disk.
+	FS         fsutil.FS
 	CheckRead  func(path string) error
 	CheckWrite func(path string) error
 	// OnWrite has to be called after a successful write with the entry resulting
@@ -119,13 +122,13 @@ func (c *ContentValue) RealPath(path string, what Check) (string, error) {
 		}
 	}
 	rpath := filepath.Join(c.RootDir, path)
-	if !filepath.IsAbs(rpath) || rpath != c.RootDir && !strings.HasPrefix(rpath, c.RootDir+string(filepath.Separator)) {
+	if !filepath.IsAbs(rpath) || !c.inRoot(rpath) {
 		return "", fmt.Errorf("invalid content path: %s", path)
 	}
-	if lname, err := os.Readlink(rpath); err == nil {
+	if lname, err := c.fs().Readlink(rpath); err == nil {
 		lpath := filepath.Join(filepath.Dir(rpath), lname)
 		lrel, err := filepath.Rel(c.RootDir, lpath)
-		if err != nil || !filepath.IsAbs(lpath) || lpath != c.RootDir && !strings.HasPrefix(lpath, c.RootDir+string(filepath.Separator)) {
+		if err != nil || !filepath.IsAbs(lpath) || !c.inRoot(lpath) {
 			return "", fmt.Errorf("invalid content symlink: %s", path)
 		}
 		_, err = c.RealPath("/"+lrel, what)
@@ -136,6 +139,22 @@ func (c *ContentValue) RealPath(path string, what Check) (string, error) {
 	return rpath, nil
 }
 
+// inRoot returns whether the absolute path is RootDir or within it.
+func (c *ContentValue) inRoot(path string) bool {
+	root := filepath.Clean(c.RootDir)
+	if root == string(filepath.Separator) {
+		return true
+	}
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+func (c *ContentValue) fs() fsutil.FS {
+	if c.FS == nil {
+		return fsutil.DiskFS
+	}
+	return c.FS
+}
+
 func (c *ContentValue) polishError(path starlark.String, err error) error {
 	if e, ok := err.(*os.PathError); ok {
 		e.Path = path.GoString()
@@ -154,7 +173,7 @@ func (c *ContentValue) Read(thread *starlark.Thread, fn *starlark.Builtin, args
 	if err != nil {
 		return nil, err
 	}
-	data, err := os.ReadFile(fpath)
+	data, err := c.fs().ReadFile(fpath)
 	if err != nil {
 		return nil, c.polishError(path, err)
 	}
@@ -177,7 +196,7 @@ func (c *ContentValue) Write(thread *starlark.Thread, fn *starlark.Builtin, args
 
 	// No mode parameter for now as slices are supposed to list files
 	// explicitly instead.
-	entry, err := fsutil.Create(&fsutil.CreateOptions{
+	entry, err := c.fs().Create(&fsutil.CreateOptions{
 		Path: fpath,
 		Data: bytes.NewReader(fdata),
 		Mode: 0644,
@@ -207,7 +226,7 @@ func (c *ContentValue) List(thread *starlark.Thread, fn *starlark.Builtin, args
 	if err != nil {
 		return nil, err
 	}
-	entries, err := os.ReadDir(fpath)
+	entries, err := c.fs().ReadDir(fpath)
 	if err != nil {
 		return nil, c.polishError(path, err)
 	}
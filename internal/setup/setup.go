@@ -2,7 +2,9 @@ package setup
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -14,6 +16,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/fsutil"
 	"github.com/canonical/chisel/internal/pgputil"
 	"github.com/canonical/chisel/internal/strdist"
 )
@@ -34,13 +37,38 @@ type Archive struct {
 	Suites     []string
 	Components []string
 	PubKeys    []*packet.PublicKey
+	// URL is the base location of the archive. When empty, the
+	// default archive for the kind and architecture is used.
+	URL string
+	// Mirrors are alternative base locations tried in order when
+	// fetching from URL fails.
+	Mirrors []string
+	// Kind selects the layout of the archive. When empty, UbuntuArchive
+	// is assumed.
+	Kind ArchiveKind
+	// Trusted archives are not verified against public keys.
+	Trusted bool
+	// Priority orders the archives in which packages that do not select
+	// an archive are looked up, from the highest value to the lowest.
+	Priority int
 }
 
+type ArchiveKind string
+
+const (
+	UbuntuArchive ArchiveKind = "ubuntu"
+	DebianArchive ArchiveKind = "debian"
+	FlatArchive   ArchiveKind = "flat"
+)
+
 // Package holds a collection of slices that represent parts of themselves.
 type Package struct {
 	Name    string
 	Path    string
 	Archive string
+	// Version optionally constrains the versions of the package that
+	// may be selected, as in "<< 2.36".
+	Version string
 	Slices  map[string]*Slice
 }
 
@@ -57,6 +85,21 @@ type Slice struct {
 	Essential []SliceKey
 	Contents  map[string]PathInfo
 	Scripts   SliceScripts
+	// Alternatives holds the alternatives provided by the slice, indexed by
+	// their name.
+	Alternatives map[string]Alternative
+}
+
+// AlternativesDir holds the links to the selected alternatives.
+const AlternativesDir = "/etc/alternatives/"
+
+// Alternative is a path provided through the alternatives system. The
+// generic Link points to /etc/alternatives/<name>, which in turn points to
+// Path, as update-alternatives would set it up.
+type Alternative struct {
+	Link     string
+	Path     string
+	Priority int
 }
 
 type SliceScripts struct {
@@ -72,9 +115,8 @@ const (
 	TextPath     PathKind = "text"
 	SymlinkPath  PathKind = "symlink"
 	GeneratePath PathKind = "generate"
-
-	// TODO Maybe in the future, for binary support.
-	//Base64Path PathKind = "base64"
+	DevicePath   PathKind = "device"
+	Base64Path   PathKind = "base64"
 )
 
 type PathUntil string
@@ -87,14 +129,26 @@ const (
 type GenerateKind string
 
 const (
-	GenerateNone     GenerateKind = ""
-	GenerateManifest GenerateKind = "manifest"
+	GenerateNone       GenerateKind = ""
+	GenerateManifest   GenerateKind = "manifest"
+	GenerateLdconfig   GenerateKind = "ldconfig"
+	GenerateDpkgStatus GenerateKind = "dpkg-status"
 )
 
 type PathInfo struct {
 	Kind PathKind
 	Info string
 	Mode uint
+	// UID and GID are the owner of make, text and device paths.
+	UID int
+	GID int
+	// Capabilities are the file capabilities of copy and text paths, in the
+	// textual form accepted by fsutil.ParseCapabilities.
+	Capabilities string
+	// Major and Minor are the device numbers of device paths, for which
+	// Info holds the device type: "char", "block" or "fifo".
+	Major uint32
+	Minor uint32
 
 	Mutable  bool
 	Until    PathUntil
@@ -110,6 +164,11 @@ func (pi *PathInfo) SameContent(other *PathInfo) bool {
 	return (pi.Kind == other.Kind &&
 		pi.Info == other.Info &&
 		pi.Mode == other.Mode &&
+		pi.UID == other.UID &&
+		pi.GID == other.GID &&
+		pi.Capabilities == other.Capabilities &&
+		pi.Major == other.Major &&
+		pi.Minor == other.Minor &&
 		pi.Mutable == other.Mutable &&
 		pi.Generate == other.Generate)
 }
@@ -377,6 +436,11 @@ type yamlArchive struct {
 	Suites     []string `yaml:"suites"`
 	Components []string `yaml:"components"`
 	Default    bool     `yaml:"default"`
+	URL        string   `yaml:"url"`
+	Mirrors    []string `yaml:"mirrors"`
+	Kind       string   `yaml:"kind"`
+	Trusted    bool     `yaml:"trusted"`
+	Priority   *int     `yaml:"priority"`
 	PubKeys    []string `yaml:"public-keys"`
 	// V1PubKeys is used for compatibility with format "chisel-v1".
 	V1PubKeys []string `yaml:"v1-public-keys"`
@@ -385,20 +449,28 @@ type yamlArchive struct {
 type yamlPackage struct {
 	Name      string               `yaml:"package"`
 	Archive   string               `yaml:"archive,omitempty"`
+	Version   string               `yaml:"version,omitempty"`
 	Essential []string             `yaml:"essential,omitempty"`
 	Slices    map[string]yamlSlice `yaml:"slices,omitempty"`
 }
 
 type yamlPath struct {
-	Dir      bool         `yaml:"make,omitempty"`
-	Mode     yamlMode     `yaml:"mode,omitempty"`
-	Copy     string       `yaml:"copy,omitempty"`
-	Text     *string      `yaml:"text,omitempty"`
-	Symlink  string       `yaml:"symlink,omitempty"`
-	Mutable  bool         `yaml:"mutable,omitempty"`
-	Until    PathUntil    `yaml:"until,omitempty"`
-	Arch     yamlArch     `yaml:"arch,omitempty"`
-	Generate GenerateKind `yaml:"generate,omitempty"`
+	Dir          bool         `yaml:"make,omitempty"`
+	Mode         yamlMode     `yaml:"mode,omitempty"`
+	User         int          `yaml:"user,omitempty"`
+	Group        int          `yaml:"group,omitempty"`
+	Capabilities string       `yaml:"capabilities,omitempty"`
+	Copy         string       `yaml:"copy,omitempty"`
+	Text         *string      `yaml:"text,omitempty"`
+	Base64       *string      `yaml:"base64,omitempty"`
+	Symlink      string       `yaml:"symlink,omitempty"`
+	Device       string       `yaml:"device,omitempty"`
+	Major        uint32       `yaml:"major,omitempty"`
+	Minor        uint32       `yaml:"minor,omitempty"`
+	Mutable      bool         `yaml:"mutable,omitempty"`
+	Until        PathUntil    `yaml:"until,omitempty"`
+	Arch         yamlArch     `yaml:"arch,omitempty"`
+	Generate     GenerateKind `yaml:"generate,omitempty"`
 }
 
 func (yp *yamlPath) MarshalYAML() (interface{}, error) {
@@ -421,9 +493,16 @@ var _ yaml.Marshaler = (*yamlPath)(nil)
 func (yp *yamlPath) SameContent(other *yamlPath) bool {
 	return (yp.Dir == other.Dir &&
 		yp.Mode == other.Mode &&
+		yp.User == other.User &&
+		yp.Group == other.Group &&
+		yp.Capabilities == other.Capabilities &&
 		yp.Copy == other.Copy &&
 		yp.Text == other.Text &&
+		yp.Base64 == other.Base64 &&
 		yp.Symlink == other.Symlink &&
+		yp.Device == other.Device &&
+		yp.Major == other.Major &&
+		yp.Minor == other.Minor &&
 		yp.Mutable == other.Mutable)
 }
 
@@ -471,9 +550,16 @@ func (ym yamlMode) MarshalYAML() (interface{}, error) {
 var _ yaml.Marshaler = yamlMode(0)
 
 type yamlSlice struct {
-	Essential []string             `yaml:"essential,omitempty"`
-	Contents  map[string]*yamlPath `yaml:"contents,omitempty"`
-	Mutate    string               `yaml:"mutate,omitempty"`
+	Essential    []string                   `yaml:"essential,omitempty"`
+	Contents     map[string]*yamlPath       `yaml:"contents,omitempty"`
+	Alternatives map[string]yamlAlternative `yaml:"alternatives,omitempty"`
+	Mutate       string                     `yaml:"mutate,omitempty"`
+}
+
+type yamlAlternative struct {
+	Link     string `yaml:"link"`
+	Path     string `yaml:"path"`
+	Priority int    `yaml:"priority,omitempty"`
 }
 
 type yamlPubKey struct {
@@ -533,21 +619,50 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 		pubKeys[keyName] = key
 	}
 
+	// When archives have priorities, packages that do not select an archive
+	// are looked up in all of them instead of in a default one.
+	hasPriority := false
+	for _, details := range yamlVar.Archives {
+		if details.Priority != nil {
+			hasPriority = true
+		}
+	}
+
 	for archiveName, details := range yamlVar.Archives {
-		if details.Version == "" {
-			return nil, fmt.Errorf("%s: archive %q missing version field", fileName, archiveName)
+		kind := ArchiveKind(details.Kind)
+		switch kind {
+		case "", UbuntuArchive, DebianArchive, FlatArchive:
+		default:
+			return nil, fmt.Errorf("%s: archive %q has invalid kind: %q", fileName, archiveName, details.Kind)
 		}
-		if len(details.Suites) == 0 {
-			adjective := ubuntuAdjectives[details.Version]
-			if adjective == "" {
-				return nil, fmt.Errorf("%s: archive %q missing suites field", fileName, archiveName)
+		if kind == FlatArchive {
+			// Flat repositories have no dists/ tree to select from.
+			if len(details.Suites) > 0 || len(details.Components) > 0 {
+				return nil, fmt.Errorf("%s: flat archive %q cannot have suites or components", fileName, archiveName)
+			}
+			if details.URL == "" {
+				return nil, fmt.Errorf("%s: flat archive %q missing url field", fileName, archiveName)
+			}
+		} else {
+			if details.Version == "" {
+				return nil, fmt.Errorf("%s: archive %q missing version field", fileName, archiveName)
+			}
+			if len(details.Suites) == 0 {
+				adjective := ubuntuAdjectives[details.Version]
+				if adjective == "" || kind == DebianArchive {
+					return nil, fmt.Errorf("%s: archive %q missing suites field", fileName, archiveName)
+				}
+				details.Suites = []string{adjective}
+			}
+			if len(details.Components) == 0 {
+				return nil, fmt.Errorf("%s: archive %q missing components field", fileName, archiveName)
 			}
-			details.Suites = []string{adjective}
-		}
-		if len(details.Components) == 0 {
-			return nil, fmt.Errorf("%s: archive %q missing components field", fileName, archiveName)
 		}
-		if len(yamlVar.Archives) == 1 {
+		if hasPriority {
+			if details.Default {
+				return nil, fmt.Errorf("%s: archive %q cannot be default when archives have priorities", fileName, archiveName)
+			}
+		} else if len(yamlVar.Archives) == 1 {
 			details.Default = true
 		} else if details.Default && release.DefaultArchive != "" {
 			return nil, fmt.Errorf("%s: more than one default archive: %s, %s", fileName, release.DefaultArchive, archiveName)
@@ -555,13 +670,35 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 		if details.Default {
 			release.DefaultArchive = archiveName
 		}
-		if len(details.PubKeys) == 0 {
+		// Local archives are plain directories with nothing to verify.
+		local := strings.HasPrefix(details.URL, "file:")
+		if local {
+			if kind != FlatArchive {
+				return nil, fmt.Errorf("%s: archive %q with a file url must be of kind flat", fileName, archiveName)
+			}
+			if len(details.Mirrors) > 0 {
+				return nil, fmt.Errorf("%s: local archive %q cannot have mirrors", fileName, archiveName)
+			}
+			if err := validateLocalURL(details.URL); err != nil {
+				return nil, fmt.Errorf("%s: archive %q has invalid url: %v", fileName, archiveName, err)
+			}
+		} else if details.URL != "" {
+			if err := validateArchiveURL(details.URL); err != nil {
+				return nil, fmt.Errorf("%s: archive %q has invalid url: %v", fileName, archiveName, err)
+			}
+		}
+		if len(details.PubKeys) == 0 && !details.Trusted && !local {
 			if yamlVar.Format == "chisel-v1" {
 				return nil, fmt.Errorf("%s: archive %q missing v1-public-keys field", fileName, archiveName)
 			} else {
 				return nil, fmt.Errorf("%s: archive %q missing public-keys field", fileName, archiveName)
 			}
 		}
+		for _, mirror := range details.Mirrors {
+			if err := validateArchiveURL(mirror); err != nil {
+				return nil, fmt.Errorf("%s: archive %q has invalid mirror: %v", fileName, archiveName, err)
+			}
+		}
 		var archiveKeys []*packet.PublicKey
 		for _, keyName := range details.PubKeys {
 			key, ok := pubKeys[keyName]
@@ -576,12 +713,59 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 			Suites:     details.Suites,
 			Components: details.Components,
 			PubKeys:    archiveKeys,
+			URL:        details.URL,
+			Mirrors:    details.Mirrors,
+			Kind:       kind,
+			Trusted:    details.Trusted,
+		}
+		if details.Priority != nil {
+			release.Archives[archiveName].Priority = *details.Priority
+		}
+	}
+
+	if hasPriority {
+		archiveNames := make([]string, 0, len(release.Archives))
+		for archiveName := range release.Archives {
+			archiveNames = append(archiveNames, archiveName)
+		}
+		slices.Sort(archiveNames)
+		priorities := make(map[int]string)
+		for _, archiveName := range archiveNames {
+			priority := release.Archives[archiveName].Priority
+			if other, ok := priorities[priority]; ok {
+				return nil, fmt.Errorf("%s: archives %q and %q have the same priority: %d", fileName, other, archiveName, priority)
+			}
+			priorities[priority] = archiveName
 		}
 	}
 
 	return release, err
 }
 
+// validateArchiveURL checks that archiveURL is an absolute http or https URL.
+func validateArchiveURL(archiveURL string) error {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q", archiveURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", archiveURL)
+	}
+	return nil
+}
+
+// validateLocalURL checks that archiveURL is a file URL with an absolute path.
+func validateLocalURL(archiveURL string) error {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q", archiveURL)
+	}
+	if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return fmt.Errorf("%q is not a file URL with an absolute path", archiveURL)
+	}
+	return nil
+}
+
 func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, error) {
 	pkg := Package{
 		Name:   pkgName,
@@ -600,6 +784,12 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 		return nil, fmt.Errorf("%s: filename and 'package' field (%q) disagree", pkgPath, yamlPkg.Name)
 	}
 	pkg.Archive = yamlPkg.Archive
+	if yamlPkg.Version != "" {
+		if _, err := deb.ParseVersionConstraint(yamlPkg.Version); err != nil {
+			return nil, fmt.Errorf("%s: %v", pkgPath, err)
+		}
+		pkg.Version = yamlPkg.Version
+	}
 
 	zeroPath := yamlPath{}
 	for sliceName, yamlSlice := range yamlPkg.Slices {
@@ -658,6 +848,9 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 			var kinds = make([]PathKind, 0, 3)
 			var info string
 			var mode uint
+			var uid, gid int
+			var capabilities string
+			var major, minor uint32
 			var mutable bool
 			var until PathUntil
 			var arch []string
@@ -669,7 +862,7 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 					return nil, fmt.Errorf("slice %s_%s path %s has invalid generate options",
 						pkgName, sliceName, contPath)
 				}
-				if _, err := validateGeneratePath(contPath); err != nil {
+				if err := validateGeneratePath(contPath, yamlPath.Generate); err != nil {
 					return nil, fmt.Errorf("slice %s_%s has invalid generate path: %s", pkgName, sliceName, err)
 				}
 				kinds = append(kinds, GeneratePath)
@@ -684,6 +877,20 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 			}
 			if yamlPath != nil {
 				mode = uint(yamlPath.Mode)
+				uid = yamlPath.User
+				gid = yamlPath.Group
+				if uid < 0 {
+					return nil, fmt.Errorf("slice %s_%s has invalid 'user' for path %s: %d", pkgName, sliceName, contPath, uid)
+				}
+				if gid < 0 {
+					return nil, fmt.Errorf("slice %s_%s has invalid 'group' for path %s: %d", pkgName, sliceName, contPath, gid)
+				}
+				capabilities = yamlPath.Capabilities
+				if capabilities != "" {
+					if _, err := fsutil.ParseCapabilities(capabilities); err != nil {
+						return nil, fmt.Errorf("slice %s_%s has invalid 'capabilities' for path %s: %v", pkgName, sliceName, contPath, err)
+					}
+				}
 				mutable = yamlPath.Mutable
 				generate = yamlPath.Generate
 				if yamlPath.Dir {
@@ -697,10 +904,35 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 					kinds = append(kinds, TextPath)
 					info = *yamlPath.Text
 				}
+				if yamlPath.Base64 != nil {
+					kinds = append(kinds, Base64Path)
+					info = *yamlPath.Base64
+					if _, err := base64.StdEncoding.DecodeString(info); err != nil {
+						return nil, fmt.Errorf("slice %s_%s has invalid 'base64' for path %s: %v", pkgName, sliceName, contPath, err)
+					}
+				}
 				if len(yamlPath.Symlink) > 0 {
 					kinds = append(kinds, SymlinkPath)
 					info = yamlPath.Symlink
 				}
+				if len(yamlPath.Device) > 0 {
+					kinds = append(kinds, DevicePath)
+					info = yamlPath.Device
+					switch info {
+					case "char", "block":
+					case "fifo":
+						if yamlPath.Major != 0 || yamlPath.Minor != 0 {
+							return nil, fmt.Errorf("slice %s_%s path %s cannot have major or minor: fifo device", pkgName, sliceName, contPath)
+						}
+					default:
+						return nil, fmt.Errorf("slice %s_%s has invalid 'device' for path %s: %q", pkgName, sliceName, contPath, info)
+					}
+					if isDir {
+						return nil, fmt.Errorf("slice %s_%s device path %s must not end in /", pkgName, sliceName, contPath)
+					}
+				}
+				major = yamlPath.Major
+				minor = yamlPath.Minor
 				if len(yamlPath.Copy) > 0 {
 					kinds = append(kinds, CopyPath)
 					info = yamlPath.Copy
@@ -731,17 +963,54 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 				}
 				return nil, fmt.Errorf("conflict in slice %s_%s definition for path %s: %s", pkgName, sliceName, contPath, strings.Join(list, ", "))
 			}
-			if mutable && kinds[0] != TextPath && (kinds[0] != CopyPath || isDir) {
+			if mutable && kinds[0] != TextPath && kinds[0] != Base64Path && (kinds[0] != CopyPath || isDir) {
 				return nil, fmt.Errorf("slice %s_%s mutable is not a regular file: %s", pkgName, sliceName, contPath)
 			}
+			if (uid != 0 || gid != 0) && kinds[0] != DirPath && kinds[0] != TextPath && kinds[0] != Base64Path && kinds[0] != DevicePath {
+				return nil, fmt.Errorf("slice %s_%s path %s cannot have user or group: not a make, text, base64 or device path", pkgName, sliceName, contPath)
+			}
+			if (major != 0 || minor != 0) && kinds[0] != DevicePath {
+				return nil, fmt.Errorf("slice %s_%s path %s cannot have major or minor: not a device path", pkgName, sliceName, contPath)
+			}
+			if capabilities != "" && kinds[0] != TextPath && kinds[0] != Base64Path && (kinds[0] != CopyPath || isDir) {
+				return nil, fmt.Errorf("slice %s_%s path %s cannot have capabilities: not a regular file", pkgName, sliceName, contPath)
+			}
 			slice.Contents[contPath] = PathInfo{
-				Kind:     kinds[0],
-				Info:     info,
-				Mode:     mode,
-				Mutable:  mutable,
-				Until:    until,
-				Arch:     arch,
-				Generate: generate,
+				Kind:         kinds[0],
+				Info:         info,
+				Mode:         mode,
+				UID:          uid,
+				GID:          gid,
+				Capabilities: capabilities,
+				Major:        major,
+				Minor:        minor,
+				Mutable:      mutable,
+				Until:        until,
+				Arch:         arch,
+				Generate:     generate,
+			}
+		}
+
+		if len(yamlSlice.Alternatives) > 0 {
+			slice.Alternatives = make(map[string]Alternative, len(yamlSlice.Alternatives))
+		}
+		for name, yamlAlt := range yamlSlice.Alternatives {
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/ \t") {
+				return nil, fmt.Errorf("slice %s_%s has invalid alternative name: %q", pkgName, sliceName, name)
+			}
+			if !path.IsAbs(yamlAlt.Link) || path.Clean(yamlAlt.Link) != yamlAlt.Link {
+				return nil, fmt.Errorf("slice %s_%s alternative %s has invalid link: %q", pkgName, sliceName, name, yamlAlt.Link)
+			}
+			if !path.IsAbs(yamlAlt.Path) || path.Clean(yamlAlt.Path) != yamlAlt.Path {
+				return nil, fmt.Errorf("slice %s_%s alternative %s has invalid path: %q", pkgName, sliceName, name, yamlAlt.Path)
+			}
+			if yamlAlt.Link == yamlAlt.Path {
+				return nil, fmt.Errorf("slice %s_%s alternative %s has the same link and path: %s", pkgName, sliceName, name, yamlAlt.Link)
+			}
+			slice.Alternatives[name] = Alternative{
+				Link:     yamlAlt.Link,
+				Path:     yamlAlt.Path,
+				Priority: yamlAlt.Priority,
 			}
 		}
 
@@ -751,20 +1020,30 @@ func parsePackage(baseDir, pkgName, pkgPath string, data []byte) (*Package, erro
 	return &pkg, err
 }
 
-// validateGeneratePath validates that the path follows the following format:
-//   - /slashed/path/to/dir/**
+// validateGeneratePath validates that the path follows the format expected
+// by the generate kind:
+//   - /slashed/path/to/file for ldconfig.
+//   - /slashed/path/to/file or /slashed/path/to/dir/** for dpkg-status.
+//   - /slashed/path/to/dir/** otherwise.
 //
 // Wildcard characters can only appear at the end as **, and the path before
 // those wildcards must be a directory.
-func validateGeneratePath(path string) (string, error) {
+func validateGeneratePath(path string, kind GenerateKind) error {
+	isFile := !strings.HasSuffix(path, "/") && !strings.ContainsAny(path, "*?")
+	switch {
+	case kind == GenerateLdconfig && !isFile:
+		return fmt.Errorf("%s is not a file path", path)
+	case kind == GenerateLdconfig, kind == GenerateDpkgStatus && isFile:
+		return nil
+	}
 	if !strings.HasSuffix(path, "/**") {
-		return "", fmt.Errorf("%s does not end with /**", path)
+		return fmt.Errorf("%s does not end with /**", path)
 	}
 	dirPath := strings.TrimSuffix(path, "**")
 	if strings.ContainsAny(dirPath, "*?") {
-		return "", fmt.Errorf("%s contains wildcard characters in addition to trailing **", path)
+		return fmt.Errorf("%s contains wildcard characters in addition to trailing **", path)
 	}
-	return dirPath, nil
+	return nil
 }
 
 func stripBase(baseDir, path string) string {
@@ -805,7 +1084,7 @@ func Select(release *Release, slices []SliceKey) (*Selection, error) {
 			// An invalid "generate" value should only throw an error if that
 			// particular slice is selected. Hence, the check is here.
 			switch newInfo.Generate {
-			case GenerateNone, GenerateManifest:
+			case GenerateNone, GenerateManifest, GenerateLdconfig, GenerateDpkgStatus:
 			default:
 				return nil, fmt.Errorf("slice %s has invalid 'generate' for path %s: %q, consider an update if available",
 					new, newPath, newInfo.Generate)
@@ -813,6 +1092,26 @@ func Select(release *Release, slices []SliceKey) (*Selection, error) {
 		}
 	}
 
+	// Slices providing the same alternative must agree on its link, which
+	// cannot be part of the contents of any slice.
+	alternatives := make(map[string]*Slice)
+	for _, new := range selection.Slices {
+		for name, newAlt := range new.Alternatives {
+			if old, ok := alternatives[name]; ok {
+				if old.Alternatives[name].Link != newAlt.Link {
+					return nil, fmt.Errorf("slices %s and %s conflict on alternative %s", old, new, name)
+				}
+			} else {
+				alternatives[name] = new
+			}
+			for _, altPath := range []string{newAlt.Link, AlternativesDir + name} {
+				if old, ok := paths[altPath]; ok {
+					return nil, fmt.Errorf("slice %s alternative %s conflicts with slice %s on %s", new, name, old, altPath)
+				}
+			}
+		}
+	}
+
 	return selection, nil
 }
 
@@ -820,10 +1119,13 @@ func Select(release *Release, slices []SliceKey) (*Selection, error) {
 // The returned object takes pointers to the given PathInfo object.
 func pathInfoToYAML(pi *PathInfo) (*yamlPath, error) {
 	path := &yamlPath{
-		Mode:    yamlMode(pi.Mode),
-		Mutable: pi.Mutable,
-		Until:   pi.Until,
-		Arch:    yamlArch{List: pi.Arch},
+		Mode:         yamlMode(pi.Mode),
+		User:         pi.UID,
+		Group:        pi.GID,
+		Capabilities: pi.Capabilities,
+		Mutable:      pi.Mutable,
+		Until:        pi.Until,
+		Arch:         yamlArch{List: pi.Arch},
 	}
 	switch pi.Kind {
 	case DirPath:
@@ -832,8 +1134,14 @@ func pathInfoToYAML(pi *PathInfo) (*yamlPath, error) {
 		path.Copy = pi.Info
 	case TextPath:
 		path.Text = &pi.Info
+	case Base64Path:
+		path.Base64 = &pi.Info
 	case SymlinkPath:
 		path.Symlink = pi.Info
+	case DevicePath:
+		path.Device = pi.Info
+		path.Major = pi.Major
+		path.Minor = pi.Minor
 	case GlobPath:
 		// Nothing more needs to be done for this type.
 	default:
@@ -861,6 +1169,16 @@ func sliceToYAML(s *Slice) (*yamlSlice, error) {
 		}
 		slice.Contents[path] = yamlPath
 	}
+	if len(s.Alternatives) > 0 {
+		slice.Alternatives = make(map[string]yamlAlternative, len(s.Alternatives))
+		for name, alt := range s.Alternatives {
+			slice.Alternatives[name] = yamlAlternative{
+				Link:     alt.Link,
+				Path:     alt.Path,
+				Priority: alt.Priority,
+			}
+		}
+	}
 	return slice, nil
 }
 
@@ -869,6 +1187,7 @@ func packageToYAML(p *Package) (*yamlPackage, error) {
 	pkg := &yamlPackage{
 		Name:    p.Name,
 		Archive: p.Archive,
+		Version: p.Version,
 		Slices:  make(map[string]yamlSlice, len(p.Slices)),
 	}
 	for name, slice := range p.Slices {
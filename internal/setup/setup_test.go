@@ -93,6 +93,255 @@ var setupTests = []setupTest{{
 			},
 		},
 	},
+}, {
+	summary: "Archive with url and mirrors",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					url: https://mirror.example.com/ubuntu/
+					mirrors:
+						- http://mirror1.example.com/ubuntu/
+						- http://mirror2.example.com/ubuntu/
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "other"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				URL:        "https://mirror.example.com/ubuntu/",
+				Mirrors: []string{
+					"http://mirror1.example.com/ubuntu/",
+					"http://mirror2.example.com/ubuntu/",
+				},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices:  map[string]*setup.Slice{},
+			},
+		},
+	},
+}, {
+	summary: "Debian and flat archives",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				debian:
+					kind: debian
+					version: 12
+					components: [main]
+					suites: [bookworm]
+					default: true
+					v1-public-keys: [test-key]
+				local:
+					kind: flat
+					url: https://repo.example.com/debs/
+					trusted: true
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			archive: local
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "debian",
+
+		Archives: map[string]*setup.Archive{
+			"debian": {
+				Name:       "debian",
+				Version:    "12",
+				Suites:     []string{"bookworm"},
+				Components: []string{"main"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				Kind:       setup.DebianArchive,
+			},
+			"local": {
+				Name:    "local",
+				URL:     "https://repo.example.com/debs/",
+				Kind:    setup.FlatArchive,
+				Trusted: true,
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "local",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices:  map[string]*setup.Slice{},
+			},
+		},
+	},
+}, {
+	summary: "Local archive",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					kind: flat
+					url: file:///srv/debs
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "local",
+
+		Archives: map[string]*setup.Archive{
+			"local": {
+				Name: "local",
+				URL:  "file:///srv/debs",
+				Kind: setup.FlatArchive,
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "local",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices:  map[string]*setup.Slice{},
+			},
+		},
+	},
+}, {
+	summary: "Local archive must be flat",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					url: file:///srv/debs
+		`,
+	},
+	relerror: `chisel.yaml: archive "local" with a file url must be of kind flat`,
+}, {
+	summary: "Local archive with relative path",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					kind: flat
+					url: file:srv/debs
+		`,
+	},
+	relerror: `chisel.yaml: archive "local" has invalid url: "file:srv/debs" is not a file URL with an absolute path`,
+}, {
+	summary: "Archive with invalid kind",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				ubuntu:
+					kind: foo
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid kind: "foo"`,
+}, {
+	summary: "Debian archive requires suites",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				debian:
+					kind: debian
+					version: 22.04
+					components: [main]
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: archive "debian" missing suites field`,
+}, {
+	summary: "Flat archive cannot have suites",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					kind: flat
+					url: https://repo.example.com/debs/
+					suites: [jammy]
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: flat archive "local" cannot have suites or components`,
+}, {
+	summary: "Flat archive requires url",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				local:
+					kind: flat
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: flat archive "local" missing url field`,
+}, {
+	summary: "Archive with invalid url",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					url: ftp://mirror.example.com/ubuntu/
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid url: "ftp://mirror.example.com/ubuntu/" is not an http or https URL`,
+}, {
+	summary: "Archive with invalid mirror",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					mirrors: [mirror.example.com/ubuntu/]
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid mirror: "mirror.example.com/ubuntu/" is not an http or https URL`,
 }, {
 	summary: "Coverage of multiple path kinds",
 	input: map[string]string{
@@ -572,86 +821,108 @@ var setupTests = []setupTest{{
 		`,
 	},
 }, {
-	summary: "Mutable does not work for directories extractions",
+	summary: "Ownership of make and text paths",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path/: {mutable: true}
+						/dir/: {make: true, user: 102, group: 104}
+						/file: {text: data, group: 104}
 		`,
 	},
-	relerror: `slice mypkg_myslice mutable is not a regular file: /path/`,
-}, {
-	summary: "Mutable does not work for directory making",
-	input: map[string]string{
-		"slices/mydir/mypkg.yaml": `
-			package: mypkg
-			slices:
-				myslice:
-					contents:
-						/path/: {make: true, mutable: true}
-		`,
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/dir/": {Kind: "dir", UID: 102, GID: 104},
+							"/file": {Kind: "text", Info: "data", GID: 104},
+						},
+					},
+				},
+			},
+		},
 	},
-	relerror: `slice mypkg_myslice mutable is not a regular file: /path/`,
 }, {
-	summary: "Mutable does not work for symlinks",
+	summary: "Ownership only works for make and text paths",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path: {symlink: /other, mutable: true}
+						/path: {copy: /other, user: 102}
 		`,
 	},
-	relerror: `slice mypkg_myslice mutable is not a regular file: /path`,
+	relerror: `slice mypkg_myslice path /path cannot have user or group: not a make, text, base64 or device path`,
 }, {
-	summary: "Until checks its value for validity",
+	summary: "Ownership does not work for wildcards",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path: {until: foo}
+						/path/*: {group: 104}
 		`,
 	},
-	relerror: `slice mypkg_myslice has invalid 'until' for path /path: "foo"`,
+	relerror: `slice mypkg_myslice path /path/\* has invalid wildcard options`,
 }, {
-	summary: "Arch checks its value for validity",
+	summary: "Ownership must not be negative",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path: {arch: foo}
+						/path/: {make: true, user: -1}
 		`,
 	},
-	relerror: `slice mypkg_myslice has invalid 'arch' for path /path: "foo"`,
+	relerror: `slice mypkg_myslice has invalid 'user' for path /path/: -1`,
 }, {
-	summary: "Arch checks its value for validity",
+	summary: "Slices of same package cannot have conflicting ownership",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
-				myslice:
+				myslice1:
 					contents:
-						/path: {arch: [i386, foo]}
+						/path/: {make: true, user: 102}
+				myslice2:
+					contents:
+						/path/: {make: true, user: 103}
 		`,
 	},
-	relerror: `slice mypkg_myslice has invalid 'arch' for path /path: "foo"`,
+	relerror: `slices mypkg_myslice1 and mypkg_myslice2 conflict on /path/`,
 }, {
-	summary: "Single architecture selection",
+	summary: "Capabilities for copy and text paths",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path: {arch: i386}
+						/usr/bin/ping: {capabilities: cap_net_raw+ep}
+						/file: {text: data, capabilities: "cap_chown,cap_fowner=p"}
 		`,
 	},
 	release: &setup.Release{
@@ -676,7 +947,8 @@ var setupTests = []setupTest{{
 						Package: "mypkg",
 						Name:    "myslice",
 						Contents: map[string]setup.PathInfo{
-							"/path": {Kind: "copy", Arch: []string{"i386"}},
+							"/usr/bin/ping": {Kind: "copy", Capabilities: "cap_net_raw+ep"},
+							"/file":         {Kind: "text", Info: "data", Capabilities: "cap_chown,cap_fowner=p"},
 						},
 					},
 				},
@@ -684,14 +956,16 @@ var setupTests = []setupTest{{
 		},
 	},
 }, {
-	summary: "Multiple architecture selection",
+	summary: "Device paths",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
 				myslice:
 					contents:
-						/path: {arch: [i386, amd64]}
+						/dev/null: {device: char, major: 1, minor: 3, mode: 0666}
+						/dev/sda: {device: block, major: 8, group: 6}
+						/run/initctl: {device: fifo, mode: 0600}
 		`,
 	},
 	release: &setup.Release{
@@ -716,7 +990,9 @@ var setupTests = []setupTest{{
 						Package: "mypkg",
 						Name:    "myslice",
 						Contents: map[string]setup.PathInfo{
-							"/path": {Kind: "copy", Arch: []string{"i386", "amd64"}},
+							"/dev/null":    {Kind: "device", Info: "char", Major: 1, Minor: 3, Mode: 0666},
+							"/dev/sda":     {Kind: "device", Info: "block", Major: 8, GID: 6},
+							"/run/initctl": {Kind: "device", Info: "fifo", Mode: 0600},
 						},
 					},
 				},
@@ -724,15 +1000,18 @@ var setupTests = []setupTest{{
 		},
 	},
 }, {
-	summary: "Text can be empty",
+	summary: "Base64 paths",
 	input: map[string]string{
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
 			slices:
-				myslice:
+				myslice1:
 					contents:
-						/nonempty: {text: "foo"}
-						/empty: {text: ""}
+						/etc/blob: {base64: "AAECAw==", mode: 0600}
+						/etc/empty: {base64: ""}
+				myslice2:
+					contents:
+						/etc/blob: {base64: "AAECAw==", mode: 0600}
 		`,
 	},
 	release: &setup.Release{
@@ -753,12 +1032,19 @@ var setupTests = []setupTest{{
 				Name:    "mypkg",
 				Path:    "slices/mydir/mypkg.yaml",
 				Slices: map[string]*setup.Slice{
-					"myslice": {
+					"myslice1": {
 						Package: "mypkg",
-						Name:    "myslice",
+						Name:    "myslice1",
 						Contents: map[string]setup.PathInfo{
-							"/nonempty": {Kind: "text", Info: "foo"},
-							"/empty":    {Kind: "text", Info: ""},
+							"/etc/blob":  {Kind: "base64", Info: "AAECAw==", Mode: 0600},
+							"/etc/empty": {Kind: "base64", Info: ""},
+						},
+					},
+					"myslice2": {
+						Package: "mypkg",
+						Name:    "myslice2",
+						Contents: map[string]setup.PathInfo{
+							"/etc/blob": {Kind: "base64", Info: "AAECAw==", Mode: 0600},
 						},
 					},
 				},
@@ -766,7 +1052,390 @@ var setupTests = []setupTest{{
 		},
 	},
 }, {
-	summary: "Multiple archives",
+	summary: "Base64 content must be valid",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/etc/blob: {base64: "not base64!"}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'base64' for path /etc/blob: illegal base64 data at input byte 3`,
+}, {
+	summary: "Base64 paths conflict with text paths",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/etc/blob: {base64: "AAECAw==", text: data}
+		`,
+	},
+	relerror: `conflict in slice mypkg_myslice definition for path /etc/blob: text, base64`,
+}, {
+	summary: "Slices of same package cannot have conflicting base64 content",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice1:
+					contents:
+						/etc/blob: {base64: "AAECAw=="}
+				myslice2:
+					contents:
+						/etc/blob: {base64: "AAECBA=="}
+		`,
+	},
+	relerror: `slices mypkg_myslice1 and mypkg_myslice2 conflict on /etc/blob`,
+}, {
+	summary: "Device type must be valid",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/dev/null: {device: socket}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'device' for path /dev/null: "socket"`,
+}, {
+	summary: "FIFO devices cannot have device numbers",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/run/initctl: {device: fifo, minor: 1}
+		`,
+	},
+	relerror: `slice mypkg_myslice path /run/initctl cannot have major or minor: fifo device`,
+}, {
+	summary: "Device numbers only work for device paths",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/file: {text: data, major: 1}
+		`,
+	},
+	relerror: `slice mypkg_myslice path /file cannot have major or minor: not a device path`,
+}, {
+	summary: "Device paths cannot be directories",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/dev/null/: {device: char, major: 1, minor: 3}
+		`,
+	},
+	relerror: `slice mypkg_myslice device path /dev/null/ must not end in /`,
+}, {
+	summary: "Device paths conflict with other kinds",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/dev/null: {device: char, text: data}
+		`,
+	},
+	relerror: `conflict in slice mypkg_myslice definition for path /dev/null: text, device`,
+}, {
+	summary: "Capabilities only work for regular files",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path/: {make: true, capabilities: cap_net_raw+ep}
+		`,
+	},
+	relerror: `slice mypkg_myslice path /path/ cannot have capabilities: not a regular file`,
+}, {
+	summary: "Capabilities do not work for wildcards",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path/*: {capabilities: cap_net_raw+ep}
+		`,
+	},
+	relerror: `slice mypkg_myslice path /path/\* has invalid wildcard options`,
+}, {
+	summary: "Capabilities must be valid",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {capabilities: cap_foo+ep}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'capabilities' for path /path: invalid capabilities "cap_foo\+ep": unknown capability "cap_foo"`,
+}, {
+	summary: "Mutable does not work for directories extractions",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path/: {mutable: true}
+		`,
+	},
+	relerror: `slice mypkg_myslice mutable is not a regular file: /path/`,
+}, {
+	summary: "Mutable does not work for directory making",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path/: {make: true, mutable: true}
+		`,
+	},
+	relerror: `slice mypkg_myslice mutable is not a regular file: /path/`,
+}, {
+	summary: "Mutable does not work for symlinks",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {symlink: /other, mutable: true}
+		`,
+	},
+	relerror: `slice mypkg_myslice mutable is not a regular file: /path`,
+}, {
+	summary: "Until checks its value for validity",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {until: foo}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'until' for path /path: "foo"`,
+}, {
+	summary: "Arch checks its value for validity",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {arch: foo}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'arch' for path /path: "foo"`,
+}, {
+	summary: "Arch checks its value for validity",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {arch: [i386, foo]}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid 'arch' for path /path: "foo"`,
+}, {
+	summary: "Single architecture selection",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {arch: i386}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/path": {Kind: "copy", Arch: []string{"i386"}},
+						},
+					},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Multiple architecture selection",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/path: {arch: [i386, amd64]}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/path": {Kind: "copy", Arch: []string{"i386", "amd64"}},
+						},
+					},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Text can be empty",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/nonempty: {text: "foo"}
+						/empty: {text: ""}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/nonempty": {Kind: "text", Info: "foo"},
+							"/empty":    {Kind: "text", Info: ""},
+						},
+					},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Multiple archives",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main, universe]
+					suites: [jammy]
+					default: true
+					v1-public-keys: [test-key]
+				bar:
+					version: 22.04
+					components: [universe]
+					suites: [jammy-updates]
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "foo",
+
+		Archives: map[string]*setup.Archive{
+			"foo": {
+				Name:       "foo",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+			"bar": {
+				Name:       "bar",
+				Version:    "22.04",
+				Suites:     []string{"jammy-updates"},
+				Components: []string{"universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "foo",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices:  map[string]*setup.Slice{},
+			},
+		},
+	},
+}, {
+	summary: "Archives with priorities",
 	input: map[string]string{
 		"chisel.yaml": `
 			format: chisel-v1
@@ -775,12 +1444,13 @@ var setupTests = []setupTest{{
 					version: 22.04
 					components: [main, universe]
 					suites: [jammy]
-					default: true
+					priority: 10
 					v1-public-keys: [test-key]
 				bar:
 					version: 22.04
 					components: [universe]
 					suites: [jammy-updates]
+					priority: 20
 					v1-public-keys: [test-key]
 			v1-public-keys:
 				test-key:
@@ -789,11 +1459,14 @@ var setupTests = []setupTest{{
 		`,
 		"slices/mydir/mypkg.yaml": `
 			package: mypkg
+			version: "< 2.36"
+		`,
+		"slices/mydir/otherpkg.yaml": `
+			package: otherpkg
+			archive: foo
 		`,
 	},
 	release: &setup.Release{
-		DefaultArchive: "foo",
-
 		Archives: map[string]*setup.Archive{
 			"foo": {
 				Name:       "foo",
@@ -801,6 +1474,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
 				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				Priority:   10,
 			},
 			"bar": {
 				Name:       "bar",
@@ -808,17 +1482,79 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"universe"},
 				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				Priority:   20,
 			},
 		},
 		Packages: map[string]*setup.Package{
 			"mypkg": {
-				Archive: "foo",
 				Name:    "mypkg",
 				Path:    "slices/mydir/mypkg.yaml",
+				Version: "< 2.36",
+				Slices:  map[string]*setup.Slice{},
+			},
+			"otherpkg": {
+				Archive: "foo",
+				Name:    "otherpkg",
+				Path:    "slices/mydir/otherpkg.yaml",
 				Slices:  map[string]*setup.Slice{},
 			},
 		},
 	},
+}, {
+	summary: "Archives with the same priority",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					priority: 10
+					v1-public-keys: [test-key]
+				bar:
+					version: 22.04
+					components: [main]
+					suites: [jammy-updates]
+					v1-public-keys: [test-key]
+				baz:
+					version: 22.04
+					components: [main]
+					suites: [jammy-security]
+					priority: 10
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archives "baz" and "foo" have the same priority: 10`,
+}, {
+	summary: "Default archive with priorities",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					priority: 10
+					default: true
+					v1-public-keys: [test-key]
+		`,
+	},
+	relerror: `chisel.yaml: archive "foo" cannot be default when archives have priorities`,
+}, {
+	summary: "Invalid package version constraint",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			version: 2.36
+		`,
+	},
+	relerror: `slices/mydir/mypkg.yaml: invalid version constraint: "2.36"`,
 }, {
 	summary: "Extra fields in YAML are ignored (necessary for forward compatibility)",
 	input: map[string]string{
@@ -1562,6 +2298,270 @@ var setupTests = []setupTest{{
 		`,
 	},
 	relerror: `slice mypkg_myslice path /path/\*\* has invalid generate options`,
+}, {
+	summary: "Specify generate: ldconfig",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/etc/ld.so.cache: {generate: ldconfig}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/etc/ld.so.cache": {Kind: "generate", Generate: "ldconfig"},
+						},
+					},
+				},
+			},
+		},
+	},
+	selslices: []setup.SliceKey{{"mypkg", "myslice"}},
+	selection: &setup.Selection{
+		Slices: []*setup.Slice{{
+			Package: "mypkg",
+			Name:    "myslice",
+			Contents: map[string]setup.PathInfo{
+				"/etc/ld.so.cache": {Kind: "generate", Generate: "ldconfig"},
+			},
+		}},
+	},
+}, {
+	summary: "Paths with generate: ldconfig must be file paths",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/etc/ld.so.cache/: {generate: ldconfig}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid generate path: /etc/ld.so.cache/ is not a file path`,
+}, {
+	summary: "Paths with generate: ldconfig cannot have wildcards",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/etc/ld.so.*: {generate: ldconfig}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid generate path: /etc/ld.so.\* is not a file path`,
+}, {
+	summary: "Specify generate: dpkg-status",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/var/lib/dpkg/status: {generate: dpkg-status}
+						/var/lib/dpkg/status.d/**: {generate: dpkg-status}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/var/lib/dpkg/status":      {Kind: "generate", Generate: "dpkg-status"},
+							"/var/lib/dpkg/status.d/**": {Kind: "generate", Generate: "dpkg-status"},
+						},
+					},
+				},
+			},
+		},
+	},
+	selslices: []setup.SliceKey{{"mypkg", "myslice"}},
+	selection: &setup.Selection{
+		Slices: []*setup.Slice{{
+			Package: "mypkg",
+			Name:    "myslice",
+			Contents: map[string]setup.PathInfo{
+				"/var/lib/dpkg/status":      {Kind: "generate", Generate: "dpkg-status"},
+				"/var/lib/dpkg/status.d/**": {Kind: "generate", Generate: "dpkg-status"},
+			},
+		}},
+	},
+}, {
+	summary: "Paths with generate: dpkg-status must be file paths or end with /**",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/var/lib/dpkg/status.d/: {generate: dpkg-status}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid generate path: /var/lib/dpkg/status.d/ does not end with /\*\*`,
+}, {
+	summary: "Specify alternatives",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/usr/bin/vim.basic:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/vim.basic, priority: 30}
+		`,
+	},
+	release: &setup.Release{
+		DefaultArchive: "ubuntu",
+
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Archive: "ubuntu",
+				Name:    "mypkg",
+				Path:    "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/usr/bin/vim.basic": {Kind: "copy"},
+						},
+						Alternatives: map[string]setup.Alternative{
+							"editor": {Link: "/usr/bin/editor", Path: "/usr/bin/vim.basic", Priority: 30},
+						},
+					},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Alternatives must have a valid name",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					alternatives:
+						bin/editor: {link: /usr/bin/editor, path: /usr/bin/vim.basic}
+		`,
+	},
+	relerror: `slice mypkg_myslice has invalid alternative name: "bin/editor"`,
+}, {
+	summary: "Alternatives must have a valid link",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					alternatives:
+						editor: {link: usr/bin/editor, path: /usr/bin/vim.basic}
+		`,
+	},
+	relerror: `slice mypkg_myslice alternative editor has invalid link: "usr/bin/editor"`,
+}, {
+	summary: "Alternatives must have a valid path",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					alternatives:
+						editor: {link: /usr/bin/editor}
+		`,
+	},
+	relerror: `slice mypkg_myslice alternative editor has invalid path: ""`,
+}, {
+	summary: "Alternatives cannot link to themselves",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/editor}
+		`,
+	},
+	relerror: `slice mypkg_myslice alternative editor has the same link and path: /usr/bin/editor`,
+}, {
+	summary: "Slices providing the same alternative must agree on its link",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice1:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/vim.basic}
+				myslice2:
+					alternatives:
+						editor: {link: /bin/editor, path: /usr/bin/vim.tiny}
+		`,
+	},
+	selslices: []setup.SliceKey{{"mypkg", "myslice1"}, {"mypkg", "myslice2"}},
+	selerror:  `slices mypkg_myslice1 and mypkg_myslice2 conflict on alternative editor`,
+}, {
+	summary: "Alternative links cannot be slice contents",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice1:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/vim.basic}
+				myslice2:
+					contents:
+						/etc/alternatives/editor: {symlink: /usr/bin/vim.tiny}
+		`,
+	},
+	selslices: []setup.SliceKey{{"mypkg", "myslice1"}, {"mypkg", "myslice2"}},
+	selerror:  `slice mypkg_myslice1 alternative editor conflicts with slice mypkg_myslice2 on /etc/alternatives/editor`,
 }}
 
 var defaultChiselYaml = `
@@ -0,0 +1,314 @@
+package slicer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/control"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/strdist"
+)
+
+// installedContent holds the content already present in the target
+// directory, as described by its manifest.
+type installedContent struct {
+	slices   map[string]bool
+	packages map[string]*manifest.Package
+	// sources holds the source packages of the installed packages, which
+	// are not listed in manifests.
+	sources map[string]string
+	// paths holds the installed paths that are kept as they are. Paths
+	// generated on every cut, such as manifests and alternatives, are not
+	// listed as they are created again.
+	paths map[string]*manifest.Path
+}
+
+// readInstalled reads the content in targetDir described by mfest. All the
+// installed slices must be part of the selection.
+func readInstalled(mfest *manifest.Manifest, selection *setup.Selection, targetDir string) (*installedContent, error) {
+	installed := &installedContent{
+		slices:   make(map[string]bool),
+		packages: make(map[string]*manifest.Package),
+		paths:    make(map[string]*manifest.Path),
+	}
+	selected := make(map[string]*setup.Slice)
+	for _, slice := range selection.Slices {
+		selected[slice.String()] = slice
+	}
+	err := mfest.IterateSlices("", func(slice *manifest.Slice) error {
+		if selected[slice.Name] == nil {
+			return fmt.Errorf("installed slice %s is not selected", slice.Name)
+		}
+		installed.slices[slice.Name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+		installed.packages[pkg.Name] = pkg
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IteratePaths("", func(path *manifest.Path) error {
+		for _, sliceName := range path.Slices {
+			if isRegenerated(selected[sliceName], path.Path) {
+				return nil
+			}
+		}
+		installed.paths[path.Path] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	installed.sources, err = readDpkgSources(targetDir, selection)
+	if err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+// isRegenerated returns whether relPath is created anew by slice on every
+// cut, either by a "generate" path or as an alternative.
+func isRegenerated(slice *setup.Slice, relPath string) bool {
+	if slice == nil {
+		return false
+	}
+	for contentPath, pathInfo := range slice.Contents {
+		if pathInfo.Kind != setup.GeneratePath {
+			continue
+		}
+		if dirPath, ok := strings.CutSuffix(contentPath, "**"); ok {
+			if strings.HasPrefix(relPath, dirPath) {
+				return true
+			}
+		} else if contentPath == relPath {
+			return true
+		}
+	}
+	for name, alt := range slice.Alternatives {
+		if alt.Link == relPath || setup.AlternativesDir+name == relPath {
+			return true
+		}
+	}
+	return false
+}
+
+func (ic *installedContent) hasSlice(slice *setup.Slice) bool {
+	return ic != nil && ic.slices[slice.String()]
+}
+
+func (ic *installedContent) hasPath(relPath string) bool {
+	return ic != nil && ic.paths[relPath] != nil
+}
+
+// packageInfo returns the information about the installed package, or nil
+// when it is not installed.
+func (ic *installedContent) packageInfo(pkgName string) *archive.PackageInfo {
+	if ic == nil || ic.packages[pkgName] == nil {
+		return nil
+	}
+	return installedPackageInfo(ic.packages[pkgName], ic.sources[pkgName])
+}
+
+// installedPackageInfo returns the information about the installed pkg,
+// which was built from the source package.
+func installedPackageInfo(pkg *manifest.Package, source string) *archive.PackageInfo {
+	return &archive.PackageInfo{
+		Name:    pkg.Name,
+		Version: pkg.Version,
+		Arch:    pkg.Arch,
+		SHA256:  pkg.Digest,
+		Size:    -1,
+		Source:  source,
+	}
+}
+
+// readDpkgSources returns the source packages listed in the dpkg status
+// files generated by the selection in targetDir, by package name. They are
+// not listed in manifests, so they are kept from there when the status
+// files are written again.
+func readDpkgSources(targetDir string, selection *setup.Selection) (map[string]string, error) {
+	var pkgNames []string
+	for _, slice := range selection.Slices {
+		if !slices.Contains(pkgNames, slice.Package) {
+			pkgNames = append(pkgNames, slice.Package)
+		}
+	}
+	var relPaths []string
+	for _, slice := range selection.Slices {
+		for relPath, pathInfo := range slice.Contents {
+			if pathInfo.Generate != setup.GenerateDpkgStatus {
+				continue
+			}
+			if dirPath, ok := strings.CutSuffix(relPath, "**"); ok {
+				for _, pkgName := range pkgNames {
+					relPaths = append(relPaths, dirPath+pkgName)
+				}
+			} else {
+				relPaths = append(relPaths, relPath)
+			}
+		}
+	}
+
+	sources := make(map[string]string)
+	for _, relPath := range relPaths {
+		data, err := os.ReadFile(filepath.Join(targetDir, relPath))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read dpkg status: %w", err)
+		}
+		file, err := control.ParseString("Package", string(data))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse dpkg status at %s: %w", relPath, err)
+		}
+		for _, pkgName := range pkgNames {
+			section := file.Section(pkgName)
+			if section != nil && section.Get("Source") != "" {
+				sources[pkgName] = section.Get("Source")
+			}
+		}
+	}
+	return sources, nil
+}
+
+// checkScripts returns an error when the content of the new slices in
+// selection may be created at the paths listed by installed slices with
+// mutation scripts. Those scripts are not run again, so they would not
+// see the new content.
+func (ic *installedContent) checkScripts(selection *setup.Selection, archs map[string]string) error {
+	for _, newSlice := range selection.Slices {
+		if ic.hasSlice(newSlice) {
+			continue
+		}
+		newArch := archs[newSlice.Package]
+		for newPath, newInfo := range newSlice.Contents {
+			if !ic.mayCreate(newPath, newInfo, newArch) {
+				continue
+			}
+			for _, oldSlice := range selection.Slices {
+				if !ic.hasSlice(oldSlice) || oldSlice.Scripts.Mutate == "" {
+					continue
+				}
+				oldArch := archs[oldSlice.Package]
+				for oldPath, oldInfo := range oldSlice.Contents {
+					if ic.mayCreate(oldPath, oldInfo, oldArch) && strdist.GlobPath(newPath, oldPath) {
+						return fmt.Errorf("cannot add slice %s: path %s may change content of installed slice %s, which has a mutation script",
+							newSlice, newPath, oldSlice)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mayCreate returns whether a cut may create content at relPath, listed
+// with pathInfo, that was not already installed. Generated paths are
+// created anew on every cut and so they are not considered.
+func (ic *installedContent) mayCreate(relPath string, pathInfo setup.PathInfo, arch string) bool {
+	if pathInfo.Kind == setup.GeneratePath {
+		return false
+	}
+	if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
+		return false
+	}
+	return pathInfo.Kind == setup.GlobPath || !ic.hasPath(relPath)
+}
+
+// addTo adds the installed paths to the report and to knownPaths. The paths
+// are mutable when any selected slice lists them as such.
+func (ic *installedContent) addTo(report *Report, knownPaths map[string]pathData, selection *setup.Selection) error {
+	selected := make(map[string]*setup.Slice)
+	for _, slice := range selection.Slices {
+		selected[slice.String()] = slice
+	}
+	for relPath, path := range ic.paths {
+		err := addInstalledPath(report, path, selected)
+		if err != nil {
+			return err
+		}
+
+		mutable := false
+		for _, slice := range selection.Slices {
+			mutable = mutable || slice.Contents[relPath].Mutable
+		}
+		addKnownPath(knownPaths, relPath, pathData{})
+		knownPaths[relPath] = pathData{mutable: mutable}
+	}
+	return nil
+}
+
+// addInstalledPath adds the installed path to the report, as owned by the
+// selected slices listed in it.
+func addInstalledPath(report *Report, path *manifest.Path, selected map[string]*setup.Slice) error {
+	mode, err := installedMode(path)
+	if err != nil {
+		return err
+	}
+	entry := ReportEntry{
+		Path:      path.Path,
+		Mode:      mode,
+		Hash:      path.Hash,
+		Size:      int(path.Size),
+		Slices:    make(map[*setup.Slice]bool),
+		Link:      path.Link,
+		FinalHash: path.FinalHash,
+		Inode:     path.Inode,
+		Major:     path.Major,
+		Minor:     path.Minor,
+	}
+	for _, sliceName := range path.Slices {
+		entry.Slices[selected[sliceName]] = true
+	}
+	report.Entries[path.Path] = entry
+	if path.Inode > report.lastInode {
+		report.lastInode = path.Inode
+	}
+	return nil
+}
+
+// installedMode returns the mode of the installed path, as it would be
+// reported when created.
+func installedMode(path *manifest.Path) (fs.FileMode, error) {
+	perm, err := strconv.ParseUint(path.Mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("installed path %s has invalid mode: %q", path.Path, path.Mode)
+	}
+	mode := fs.FileMode(perm & 0777)
+	if perm&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perm&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perm&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch {
+	case strings.HasSuffix(path.Path, "/"):
+		mode |= fs.ModeDir
+	case path.Link != "":
+		mode |= fs.ModeSymlink
+	case path.Device == "char":
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case path.Device == "block":
+		mode |= fs.ModeDevice
+	case path.Device == "fifo":
+		mode |= fs.ModeNamedPipe
+	}
+	return mode, nil
+}
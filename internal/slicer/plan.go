@@ -0,0 +1,150 @@
+package slicer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+// Plan describes what Run would do with the same options.
+type Plan struct {
+	// Packages lists the packages to be fetched, in selection order.
+	Packages []*PlanPackage
+	// Slices lists the slices to be cut, in selection order.
+	Slices []*PlanSlice
+}
+
+type PlanPackage struct {
+	// Archive is the label of the archive the package comes from.
+	Archive string
+	Info    *archive.PackageInfo
+}
+
+type PlanSlice struct {
+	Slice *setup.Slice
+	// Paths lists the slice contents that apply to the architecture of
+	// the package, sorted by path.
+	Paths []*PlanPath
+}
+
+type PlanPath struct {
+	Path string
+	// Info describes the content of the path. Paths of kind glob are the
+	// patterns listed in the slice, as the paths matching them are only
+	// known once the package is fetched. Generated paths and alternative
+	// links are listed with the paths they create.
+	Info *setup.PathInfo
+}
+
+// DryRun resolves the packages and paths that Run would fetch and create
+// for the given options, without fetching packages or writing anything
+// to the target directory. Installed slices are left out, and so are the
+// packages that have no other slices selected.
+func DryRun(options *RunOptions) (*Plan, error) {
+	var installed *installedContent
+	if options.Installed != nil {
+		var err error
+		installed, err = readInstalled(options.Installed, options.Selection, options.TargetDir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read installed content: %w", err)
+		}
+	}
+
+	var pkgNames []string
+	archives := make(map[string]archive.Archive)
+	for _, slice := range options.Selection.Slices {
+		if _, ok := archives[slice.Package]; ok {
+			continue
+		}
+		pkgNames = append(pkgNames, slice.Package)
+		pkgArchive, err := selectPackageArchive(options, slice.Package)
+		if err != nil {
+			return nil, err
+		}
+		archives[slice.Package] = pkgArchive
+	}
+	sort.Strings(pkgNames)
+
+	plan := &Plan{}
+	planSlices := make(map[*setup.Slice]*PlanSlice)
+	listed := make(map[string]bool)
+	for _, slice := range options.Selection.Slices {
+		if installed.hasSlice(slice) {
+			continue
+		}
+		pkgArchive := archives[slice.Package]
+		if !listed[slice.Package] {
+			info, err := pkgArchive.Info(slice.Package)
+			if err != nil {
+				return nil, err
+			}
+			listed[slice.Package] = true
+			plan.Packages = append(plan.Packages, &PlanPackage{
+				Archive: pkgArchive.Options().Label,
+				Info:    info,
+			})
+		}
+
+		arch := pkgArchive.Options().Arch
+		planSlice := &PlanSlice{Slice: slice}
+		for path, info := range slice.Contents {
+			if len(info.Arch) > 0 && !slices.Contains(info.Arch, arch) {
+				continue
+			}
+			info := info
+			for _, path := range planPaths(path, &info, pkgNames) {
+				planSlice.Paths = append(planSlice.Paths, &PlanPath{
+					Path: path,
+					Info: &info,
+				})
+			}
+		}
+		planSlices[slice] = planSlice
+		plan.Slices = append(plan.Slices, planSlice)
+	}
+
+	for _, choice := range chooseAlternatives(options.Selection) {
+		planSlice := planSlices[choice.slice]
+		if planSlice == nil {
+			continue
+		}
+		for _, link := range choice.links() {
+			planSlice.Paths = append(planSlice.Paths, &PlanPath{
+				Path: link.path,
+				Info: &setup.PathInfo{Kind: setup.SymlinkPath, Info: link.target},
+			})
+		}
+	}
+
+	for _, planSlice := range plan.Slices {
+		sort.Slice(planSlice.Paths, func(i, j int) bool {
+			return planSlice.Paths[i].Path < planSlice.Paths[j].Path
+		})
+	}
+	return plan, nil
+}
+
+// planPaths returns the paths created for the slice contents entry at path,
+// which are the paths generated for it when it is a "generate" entry.
+func planPaths(path string, info *setup.PathInfo, pkgNames []string) []string {
+	if info.Kind != setup.GeneratePath {
+		return []string{path}
+	}
+	dirPath, isDir := strings.CutSuffix(path, "**")
+	switch {
+	case info.Generate == setup.GenerateManifest:
+		return []string{dirPath + manifest.Filename}
+	case info.Generate == setup.GenerateDpkgStatus && isDir:
+		paths := make([]string, len(pkgNames))
+		for i, pkgName := range pkgNames {
+			paths[i] = dirPath + pkgName
+		}
+		return paths
+	}
+	return []string{path}
+}
@@ -0,0 +1,156 @@
+package slicer_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var dryRunRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				essential:
+					- other-package_otherslice
+				contents:
+					/dir/file:
+					/dir/text-file: {text: data1}
+					/dir/other-arch: {text: data1, arch: i386}
+					/dir/link: {symlink: /dir/file}
+					/db/**: {generate: manifest}
+					/status.d/**: {generate: dpkg-status}
+				alternatives:
+					editor: {link: /usr/bin/editor, path: /dir/file, priority: 10}
+	`,
+	"slices/mydir/other-package.yaml": `
+		package: other-package
+		slices:
+			otherslice:
+				contents:
+					/dir/*/file:
+	`,
+}
+
+func (s *S) TestDryRun(c *C) {
+	releaseDir := c.MkDir()
+	for path, data := range dryRunRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "myslice"}})
+	c.Assert(err, IsNil)
+
+	pkgs := map[string][]byte{
+		"test-package":  testutil.PackageData["test-package"],
+		"other-package": testutil.PackageData["other-package"],
+	}
+	targetDir := c.MkDir()
+	plan, err := slicer.DryRun(&slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{
+				options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+				pkgs:    pkgs,
+			},
+		},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+
+	var packages []string
+	for _, pkg := range plan.Packages {
+		c.Assert(pkg.Archive, Equals, "ubuntu")
+		c.Assert(pkg.Info.Version, Equals, "1.0")
+		c.Assert(pkg.Info.Size, Equals, int64(len(pkgs[pkg.Info.Name])))
+		packages = append(packages, pkg.Info.Name)
+	}
+	c.Assert(packages, DeepEquals, []string{"other-package", "test-package"})
+
+	paths := make(map[string][]string)
+	for _, planSlice := range plan.Slices {
+		for _, path := range planSlice.Paths {
+			paths[planSlice.Slice.String()] = append(paths[planSlice.Slice.String()], path.Path+" "+string(path.Info.Kind))
+		}
+	}
+	c.Assert(paths, DeepEquals, map[string][]string{
+		"other-package_otherslice": {"/dir/*/file glob"},
+		"test-package_myslice": {
+			"/db/manifest.wall generate",
+			"/dir/file copy",
+			"/dir/link symlink",
+			"/dir/text-file text",
+			"/etc/alternatives/editor symlink",
+			"/status.d/other-package generate",
+			"/status.d/test-package generate",
+			"/usr/bin/editor symlink",
+		},
+	})
+
+	// Nothing is written to the target directory.
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, map[string]string{})
+}
+
+func (s *S) TestDryRunMissingPackage(c *C) {
+	release := &setup.Release{
+		Packages: map[string]*setup.Package{
+			"test-package": {Name: "test-package"},
+		},
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {Name: "ubuntu"},
+		},
+	}
+	selection := &setup.Selection{
+		Release: release,
+		Slices:  []*setup.Slice{{Package: "test-package", Name: "myslice"}},
+	}
+	_, err := slicer.DryRun(&slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{options: archive.Options{Label: "ubuntu"}},
+		},
+	})
+	c.Assert(err, ErrorMatches, `slice package "test-package" missing from archives`)
+}
+
+func (s *S) TestDryRunInstalled(c *C) {
+	release := readInstalledRelease(c)
+	targetDir, mfest := cutInstalled(c, release, []setup.SliceKey{
+		{Package: "test-package", Slice: "base"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+	selection, err := setup.Select(release, installedKeys)
+	c.Assert(err, IsNil)
+
+	plan, err := slicer.DryRun(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: targetDir,
+		Installed: mfest,
+	})
+	c.Assert(err, IsNil)
+
+	// Only the slices to be added and their packages are listed.
+	c.Assert(plan.Packages, HasLen, 1)
+	c.Assert(plan.Packages[0].Info.Name, Equals, "test-package")
+	c.Assert(plan.Slices, HasLen, 1)
+	c.Assert(plan.Slices[0].Slice.String(), Equals, "test-package_extra")
+	var paths []string
+	for _, path := range plan.Slices[0].Paths {
+		paths = append(paths, path.Path)
+	}
+	c.Assert(paths, DeepEquals, []string{"/dir/file", "/dir/other-file"})
+}
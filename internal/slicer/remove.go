@@ -0,0 +1,241 @@
+package slicer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+type RemoveOptions struct {
+	// Release holds the definitions of the installed slices.
+	Release *setup.Release
+	// Installed is the manifest of the content in TargetDir.
+	Installed *manifest.Manifest
+	// Slices lists the installed slices to remove.
+	Slices    []setup.SliceKey
+	TargetDir string
+}
+
+// Remove removes slices from the content installed in the target directory,
+// deleting the paths that no remaining slice lists. The content generated by
+// the remaining slices, such as manifests, dpkg status files, ld.so caches
+// and alternatives, is written again to describe what remains. Slices
+// required by remaining slices cannot be removed.
+func Remove(options *RemoveOptions) error {
+	targetDir := filepath.Clean(options.TargetDir)
+	if !filepath.IsAbs(targetDir) {
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("cannot obtain current directory: %w", err)
+		}
+		targetDir = filepath.Join(dir, targetDir)
+	}
+
+	installed := make(map[string]bool)
+	err := options.Installed.IterateSlices("", func(slice *manifest.Slice) error {
+		installed[slice.Name] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	removed := make(map[string]bool)
+	for _, key := range options.Slices {
+		if !installed[key.String()] {
+			return fmt.Errorf("slice %s is not installed", key)
+		}
+		removed[key.String()] = true
+	}
+
+	// The definitions of the remaining slices are needed to check their
+	// requirements and to generate their content again.
+	var remaining []setup.SliceKey
+	for sliceName := range installed {
+		if removed[sliceName] {
+			continue
+		}
+		key, err := setup.ParseSliceKey(sliceName)
+		if err != nil {
+			return err
+		}
+		pkg := options.Release.Packages[key.Package]
+		if pkg == nil || pkg.Slices[key.Slice] == nil {
+			return fmt.Errorf("installed slice %s not found in release", sliceName)
+		}
+		remaining = append(remaining, key)
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].String() < remaining[j].String() })
+	for _, key := range remaining {
+		slice := options.Release.Packages[key.Package].Slices[key.Slice]
+		for _, req := range slice.Essential {
+			if removed[req.String()] {
+				return fmt.Errorf("cannot remove slice %s: slice %s requires it", req, slice)
+			}
+		}
+	}
+	selection := &setup.Selection{Release: options.Release}
+	if len(remaining) > 0 {
+		selection, err = setup.Select(options.Release, remaining)
+		if err != nil {
+			return err
+		}
+		// The selection must hold exactly the remaining slices, as the
+		// release may now require slices that are not installed.
+		for _, slice := range selection.Slices {
+			if removed[slice.String()] {
+				return fmt.Errorf("cannot remove slice %s: remaining slices require it", slice)
+			}
+			if !installed[slice.String()] {
+				return fmt.Errorf("cannot remove slices: slice %s is required by the remaining slices but not installed", slice)
+			}
+		}
+	}
+	selected := make(map[string]*setup.Slice)
+	for _, slice := range selection.Slices {
+		selected[slice.String()] = slice
+	}
+
+	report, err := NewReport(targetDir)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot create report: %w", err)
+	}
+	sources, err := readDpkgSources(targetDir, selection)
+	if err != nil {
+		return err
+	}
+	archs := make(map[string]string)
+	err = options.Installed.IteratePackages(func(pkg *manifest.Package) error {
+		if slices.ContainsFunc(selection.Slices, func(slice *setup.Slice) bool { return slice.Package == pkg.Name }) {
+			archs[pkg.Name] = pkg.Arch
+			report.Packages[pkg.Name] = installedPackageInfo(pkg, sources[pkg.Name])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Paths are owned by the slices of their content entries. The paths
+	// generated by the remaining slices are removed as well, and created
+	// again once the other paths are removed.
+	pathSlices := make(map[string][]string)
+	err = options.Installed.IterateContents("", func(content *manifest.Content) error {
+		if !removed[content.Slice] {
+			pathSlices[content.Path] = append(pathSlices[content.Path], content.Slice)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	knownPaths := map[string]pathData{}
+	addKnownPath(knownPaths, "/", pathData{})
+	var removedPaths, generatedPaths []string
+	err = options.Installed.IteratePaths("", func(path *manifest.Path) error {
+		sliceNames, ok := pathSlices[path.Path]
+		if !ok {
+			removedPaths = append(removedPaths, path.Path)
+			return nil
+		}
+		for _, sliceName := range sliceNames {
+			if isRegenerated(selected[sliceName], path.Path) {
+				generatedPaths = append(generatedPaths, path.Path)
+				return nil
+			}
+		}
+		path.Slices = sliceNames
+		addKnownPath(knownPaths, path.Path, pathData{})
+		return addInstalledPath(report, path, selected)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = removePaths(targetDir, removedPaths, pathSlices)
+	if err != nil {
+		return err
+	}
+	err = removeGenerated(targetDir, generatedPaths)
+	if err != nil {
+		return err
+	}
+
+	fsys := fsutil.DiskFS
+	err = createAlternatives(fsys, targetDir, selection, report, knownPaths)
+	if err != nil {
+		return err
+	}
+	err = generateLdCaches(fsys, targetDir, selection, archs, report)
+	if err != nil {
+		return err
+	}
+	err = generateDpkgStatus(fsys, targetDir, selection, archs, report)
+	if err != nil {
+		return err
+	}
+	return generateManifests(fsys, targetDir, selection, archs, report)
+}
+
+// removePaths removes the paths from targetDir, along with the parent
+// directories left empty that are not kept. Directories that are not empty
+// are kept, as they hold content from elsewhere.
+func removePaths(targetDir string, relPaths []string, kept map[string][]string) error {
+	// Content is removed before its directory.
+	sort.Sort(sort.Reverse(sort.StringSlice(relPaths)))
+	for _, relPath := range relPaths {
+		logf("Removing %s...", relPath)
+		err := os.Remove(filepath.Join(targetDir, relPath))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && !isNotEmpty(err) {
+			return fmt.Errorf("cannot remove path: %w", err)
+		}
+	}
+	for _, relPath := range relPaths {
+		for dir := parentDir(relPath); dir != "/"; dir = parentDir(dir) {
+			if _, ok := kept[dir]; ok {
+				break
+			}
+			err := os.Remove(filepath.Join(targetDir, dir))
+			if err != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// removeGenerated removes the generated paths from targetDir, keeping their
+// parent directories, so that only the content still generated is created
+// again.
+func removeGenerated(targetDir string, relPaths []string) error {
+	sort.Sort(sort.Reverse(sort.StringSlice(relPaths)))
+	for _, relPath := range relPaths {
+		err := os.Remove(filepath.Join(targetDir, relPath))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && !isNotEmpty(err) {
+			return fmt.Errorf("cannot remove path: %w", err)
+		}
+	}
+	return nil
+}
+
+func isNotEmpty(err error) bool {
+	return errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST)
+}
+
+// parentDir returns the parent directory of relPath, with a trailing slash.
+func parentDir(relPath string) string {
+	dir := filepath.Dir(strings.TrimSuffix(relPath, "/"))
+	if dir == "/" {
+		return dir
+	}
+	return dir + "/"
+}
@@ -0,0 +1,259 @@
+package slicer_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifest"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+// cutInstalled cuts the slices of installedRelease into a new directory and
+// returns it along with its manifest.
+func cutInstalled(c *C, release *setup.Release, keys []setup.SliceKey) (string, *manifest.Manifest) {
+	selection, err := setup.Select(release, keys)
+	c.Assert(err, IsNil)
+	targetDir := c.MkDir()
+	_, err = slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+	return targetDir, readManifest(c, targetDir, "/db/manifest.wall")
+}
+
+var installedKeys = []setup.SliceKey{
+	{Package: "test-package", Slice: "base"},
+	{Package: "test-package", Slice: "extra"},
+	{Package: "other-package", Slice: "myslice"},
+}
+
+func (s *S) TestRemove(c *C) {
+	release := readInstalledRelease(c)
+	targetDir, mfest := cutInstalled(c, release, installedKeys)
+
+	err := slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices: []setup.SliceKey{
+			{Package: "test-package", Slice: "extra"},
+			{Package: "other-package", Slice: "myslice"},
+		},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+
+	// Paths shared with the remaining slices are kept as they are.
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, map[string]string{
+		"/db/":              "dir 0755",
+		"/db/manifest.wall": "file 0644 c727d8bc",
+		"/dir/":             "dir 0755",
+		"/dir/file":         "file 0644 7e030e2d",
+		"/dir/text":         "file 0644 691e6f52",
+	})
+
+	mfest = readManifest(c, targetDir, "/db/manifest.wall")
+	c.Assert(treeDumpManifestPaths(mfest), DeepEquals, map[string]string{
+		"/db/manifest.wall": "file 0644 empty {test-package_base}",
+		"/dir/file":         "file 0644 cc55e2ec 7e030e2d {test-package_base}",
+		"/dir/text":         "file 0644 cae66217 691e6f52 {test-package_base}",
+	})
+	var sliceNames, pkgNames []string
+	err = mfest.IterateSlices("", func(slice *manifest.Slice) error {
+		sliceNames = append(sliceNames, slice.Name)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(sliceNames, DeepEquals, []string{"test-package_base"})
+	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+		pkgNames = append(pkgNames, pkg.Name)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(pkgNames, DeepEquals, []string{"test-package"})
+	problems, err := manifest.Verify(mfest, targetDir)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+}
+
+func (s *S) TestRemoveWithManifest(c *C) {
+	release := readInstalledRelease(c)
+	targetDir, mfest := cutInstalled(c, release, installedKeys)
+
+	// Removing the slice generating the manifest removes it as well, along
+	// with the parent directories left empty.
+	err := slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices: []setup.SliceKey{
+			{Package: "test-package", Slice: "base"},
+			{Package: "test-package", Slice: "extra"},
+		},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, map[string]string{
+		"/file": "file 0644 fc02ca0e",
+	})
+}
+
+var removeGeneratedRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			base:
+				contents:
+					/usr/bin/editor.base: {text: base}
+					/db/**:               {generate: manifest}
+					/status.d/**:         {generate: dpkg-status}
+				alternatives:
+					editor: {link: /usr/bin/editor, path: /usr/bin/editor.base, priority: 10}
+	`,
+	"slices/mydir/other-package.yaml": `
+		package: other-package
+		slices:
+			myslice:
+				contents:
+					/usr/bin/editor.other: {text: other}
+				alternatives:
+					editor: {link: /usr/bin/editor, path: /usr/bin/editor.other, priority: 20}
+	`,
+}
+
+func (s *S) TestRemoveGenerated(c *C) {
+	release := readTestRelease(c, removeGeneratedRelease)
+	targetDir, mfest := cutInstalled(c, release, []setup.SliceKey{
+		{Package: "test-package", Slice: "base"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+	c.Assert(testutil.TreeDump(targetDir)["/etc/alternatives/editor"], Equals, "symlink /usr/bin/editor.other")
+
+	err := slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices:    []setup.SliceKey{{Package: "other-package", Slice: "myslice"}},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+
+	// The alternative falls back to the remaining slice, and the dpkg
+	// status no longer lists the removed package.
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, map[string]string{
+		"/db/":                     "dir 0755",
+		"/db/manifest.wall":        "file 0644 15aa105c",
+		"/etc/":                    "dir 0755",
+		"/etc/alternatives/":       "dir 0755",
+		"/etc/alternatives/editor": "symlink /usr/bin/editor.base",
+		"/status.d/":               "dir 0755",
+		"/status.d/test-package":   "file 0644 6970b8a4",
+		"/usr/":                    "dir 0755",
+		"/usr/bin/":                "dir 0755",
+		"/usr/bin/editor":          "symlink /etc/alternatives/editor",
+		"/usr/bin/editor.base":     "file 0644 cae66217",
+	})
+	mfest = readManifest(c, targetDir, "/db/manifest.wall")
+	problems, err := manifest.Verify(mfest, targetDir)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+
+	// The tree is the same as when cutting the remaining slices alone.
+	expectedDir, _ := cutInstalled(c, release, []setup.SliceKey{{Package: "test-package", Slice: "base"}})
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, testutil.TreeDump(expectedDir))
+}
+
+func (s *S) TestRemoveKeepsSources(c *C) {
+	release := readTestRelease(c, removeGeneratedRelease)
+	targetDir, mfest := cutInstalled(c, release, []setup.SliceKey{
+		{Package: "test-package", Slice: "base"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+
+	// Source packages are not listed in manifests, so they are kept from
+	// the dpkg status files written again.
+	statusPath := filepath.Join(targetDir, "/status.d/test-package")
+	data, err := os.ReadFile(statusPath)
+	c.Assert(err, IsNil)
+	data = bytes.Replace(data, []byte("Version:"), []byte("Source: test-source\nVersion:"), 1)
+	err = os.WriteFile(statusPath, data, 0644)
+	c.Assert(err, IsNil)
+
+	err = slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices:    []setup.SliceKey{{Package: "other-package", Slice: "myslice"}},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+	data, err = os.ReadFile(statusPath)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*\nSource: test-source\nVersion: .*`)
+}
+
+var removeErrorTests = []struct {
+	summary string
+	slices  []setup.SliceKey
+	error   string
+}{{
+	summary: "Slice not installed",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "foo"}},
+	error:   `slice test-package_foo is not installed`,
+}, {
+	summary: "Slice required by a remaining slice",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "base"}},
+	error:   `cannot remove slice test-package_base: slice test-package_extra requires it`,
+}}
+
+func (s *S) TestRemoveErrors(c *C) {
+	release := readInstalledRelease(c)
+	targetDir, mfest := cutInstalled(c, release, installedKeys)
+	before := testutil.TreeDump(targetDir)
+
+	for _, test := range removeErrorTests {
+		c.Logf("Summary: %s", test.summary)
+		err := slicer.Remove(&slicer.RemoveOptions{
+			Release:   release,
+			Installed: mfest,
+			Slices:    test.slices,
+			TargetDir: targetDir,
+		})
+		c.Assert(err, ErrorMatches, test.error)
+		c.Assert(testutil.TreeDump(targetDir), DeepEquals, before)
+	}
+
+	delete(release.Packages, "other-package")
+	err := slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices:    []setup.SliceKey{{Package: "test-package", Slice: "extra"}},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, ErrorMatches, `installed slice other-package_myslice not found in release`)
+}
+
+func (s *S) TestRemoveRequiresUninstalled(c *C) {
+	release := readInstalledRelease(c)
+	targetDir, mfest := cutInstalled(c, release, installedKeys)
+	before := testutil.TreeDump(targetDir)
+
+	// The release was updated so that a remaining slice requires a slice
+	// that was never installed.
+	pkg := release.Packages["other-package"]
+	pkg.Slices["new"] = &setup.Slice{Package: "other-package", Name: "new"}
+	pkg.Slices["myslice"].Essential = []setup.SliceKey{{Package: "other-package", Slice: "new"}}
+
+	err := slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		Installed: mfest,
+		Slices:    []setup.SliceKey{{Package: "test-package", Slice: "extra"}},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, ErrorMatches, `cannot remove slices: slice other-package_new is required by the remaining slices but not installed`)
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, before)
+}
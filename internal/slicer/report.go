@@ -3,9 +3,11 @@ package slicer
 import (
 	"fmt"
 	"io/fs"
+	"maps"
 	"path/filepath"
 	"strings"
 
+	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/fsutil"
 	"github.com/canonical/chisel/internal/setup"
 )
@@ -18,6 +20,15 @@ type ReportEntry struct {
 	Slices    map[*setup.Slice]bool
 	Link      string
 	FinalHash string
+	// Inode is shared by entries that are hard links to each other, and is
+	// zero for all other entries.
+	Inode uint64
+	// Xattrs holds the extended attributes of the entry, such as its file
+	// capabilities.
+	Xattrs map[string]string
+	// Major and Minor are the device numbers of devices.
+	Major uint32
+	Minor uint32
 }
 
 // Report holds the information about files and directories created when slicing
@@ -27,6 +38,11 @@ type Report struct {
 	Root string
 	// Entries holds all reported content, indexed by their path.
 	Entries map[string]ReportEntry
+	// Packages holds the information about the packages the content was
+	// extracted from, indexed by their name.
+	Packages map[string]*archive.PackageInfo
+	// lastInode is the last inode number assigned to hard-linked entries.
+	lastInode uint64
 }
 
 // NewReport returns an empty report for content that will be based at the
@@ -35,9 +51,14 @@ func NewReport(root string) (*Report, error) {
 	if !filepath.IsAbs(root) {
 		return nil, fmt.Errorf("cannot use relative path for report root: %q", root)
 	}
+	root = filepath.Clean(root)
+	if root != "/" {
+		root += "/"
+	}
 	report := &Report{
-		Root:    filepath.Clean(root) + "/",
-		Entries: make(map[string]ReportEntry),
+		Root:     root,
+		Entries:  make(map[string]ReportEntry),
+		Packages: make(map[string]*archive.PackageInfo),
 	}
 	return report, nil
 }
@@ -48,15 +69,36 @@ func (r *Report) Add(slice *setup.Slice, fsEntry *fsutil.Entry) error {
 		return fmt.Errorf("cannot add path to report: %s", err)
 	}
 
+	link := fsEntry.Link
+	var inode uint64
+	if fsEntry.Mode.IsRegular() && link != "" {
+		// Hard links share the inode of their target, when it is reported.
+		link = ""
+		targetPath, err := r.sanitizeAbsPath(fsEntry.Link, false)
+		if err != nil {
+			return fmt.Errorf("cannot add path to report: %s", err)
+		}
+		if target, ok := r.Entries[targetPath]; ok {
+			if target.Inode == 0 {
+				r.lastInode++
+				target.Inode = r.lastInode
+				r.Entries[targetPath] = target
+			}
+			inode = target.Inode
+		}
+	}
+
 	if entry, ok := r.Entries[relPath]; ok {
 		if fsEntry.Mode != entry.Mode {
 			return fmt.Errorf("path %s reported twice with diverging mode: 0%03o != 0%03o", relPath, fsEntry.Mode, entry.Mode)
-		} else if fsEntry.Link != entry.Link {
-			return fmt.Errorf("path %s reported twice with diverging link: %q != %q", relPath, fsEntry.Link, entry.Link)
+		} else if link != entry.Link {
+			return fmt.Errorf("path %s reported twice with diverging link: %q != %q", relPath, link, entry.Link)
 		} else if fsEntry.Size != entry.Size {
 			return fmt.Errorf("path %s reported twice with diverging size: %d != %d", relPath, fsEntry.Size, entry.Size)
 		} else if fsEntry.Hash != entry.Hash {
 			return fmt.Errorf("path %s reported twice with diverging hash: %q != %q", relPath, fsEntry.Hash, entry.Hash)
+		} else if !maps.Equal(fsEntry.Xattrs, entry.Xattrs) {
+			return fmt.Errorf("path %s reported twice with diverging extended attributes", relPath)
 		}
 		entry.Slices[slice] = true
 		r.Entries[relPath] = entry
@@ -67,13 +109,18 @@ func (r *Report) Add(slice *setup.Slice, fsEntry *fsutil.Entry) error {
 			Hash:   fsEntry.Hash,
 			Size:   fsEntry.Size,
 			Slices: map[*setup.Slice]bool{slice: true},
-			Link:   fsEntry.Link,
+			Link:   link,
+			Inode:  inode,
+			Xattrs: fsEntry.Xattrs,
+			Major:  fsEntry.Major,
+			Minor:  fsEntry.Minor,
 		}
 	}
 	return nil
 }
 
-// Mutate updates the FinalHash and Size of an existing path entry.
+// Mutate updates the FinalHash and Size of an existing path entry, and of
+// the entries hard-linked to it.
 func (r *Report) Mutate(fsEntry *fsutil.Entry) error {
 	relPath, err := r.sanitizeAbsPath(fsEntry.Path, fsEntry.Mode.IsDir())
 	if err != nil {
@@ -94,6 +141,16 @@ func (r *Report) Mutate(fsEntry *fsutil.Entry) error {
 	entry.FinalHash = fsEntry.Hash
 	entry.Size = fsEntry.Size
 	r.Entries[relPath] = entry
+	if entry.Inode == 0 {
+		return nil
+	}
+	for path, linked := range r.Entries {
+		if linked.Inode == entry.Inode {
+			linked.FinalHash = fsEntry.Hash
+			linked.Size = fsEntry.Size
+			r.Entries[path] = linked
+		}
+	}
 	return nil
 }
 
@@ -103,7 +103,7 @@ var reportTests = []struct {
 			Link:   "",
 		}},
 }, {
-	summary: "Regular file link",
+	summary: "Hard link without reported target",
 	add:     []sliceAndEntry{{entry: sampleLink, slice: oneSlice}},
 	expected: map[string]slicer.ReportEntry{
 		"/example-link": {
@@ -112,7 +112,30 @@ var reportTests = []struct {
 			Hash:   "example-file_hash",
 			Size:   5678,
 			Slices: map[*setup.Slice]bool{oneSlice: true},
-			Link:   "/base/example-file",
+			Link:   "",
+		}},
+}, {
+	summary: "Hard link shares the inode of its target",
+	add: []sliceAndEntry{
+		{entry: sampleFile, slice: oneSlice},
+		{entry: sampleLink, slice: otherSlice},
+	},
+	expected: map[string]slicer.ReportEntry{
+		"/example-file": {
+			Path:   "/example-file",
+			Mode:   0777,
+			Hash:   "example-file_hash",
+			Size:   5678,
+			Slices: map[*setup.Slice]bool{oneSlice: true},
+			Inode:  1,
+		},
+		"/example-link": {
+			Path:   "/example-link",
+			Mode:   0777,
+			Hash:   "example-file_hash",
+			Size:   5678,
+			Slices: map[*setup.Slice]bool{otherSlice: true},
+			Inode:  1,
 		}},
 }, {
 	summary: "Several entries",
@@ -192,16 +215,18 @@ var reportTests = []struct {
 }, {
 	summary: "Error for same path distinct link",
 	add: []sliceAndEntry{
-		{entry: sampleFile, slice: oneSlice},
 		{entry: fsutil.Entry{
-			Path: sampleFile.Path,
-			Mode: sampleFile.Mode,
-			Hash: sampleFile.Hash,
-			Size: sampleFile.Size,
+			Path: "/base/example-symlink",
+			Mode: fs.ModeSymlink | 0777,
+			Link: "example-file",
+		}, slice: oneSlice},
+		{entry: fsutil.Entry{
+			Path: "/base/example-symlink",
+			Mode: fs.ModeSymlink | 0777,
 			Link: "distinct link",
 		}, slice: oneSlice},
 	},
-	err: `path /example-file reported twice with diverging link: "distinct link" != ""`,
+	err: `path /example-symlink reported twice with diverging link: "distinct link" != "example-file"`,
 }, {
 	summary: "Error for path outside root",
 	add: []sliceAndEntry{
@@ -241,6 +266,32 @@ var reportTests = []struct {
 			Link:      "",
 			FinalHash: "example-file_hash_changed",
 		}},
+}, {
+	summary: "Mutating a hard link updates all of its paths",
+	add: []sliceAndEntry{
+		{entry: sampleFile, slice: oneSlice},
+		{entry: sampleLink, slice: oneSlice},
+	},
+	mutate: []*fsutil.Entry{&sampleFileMutated},
+	expected: map[string]slicer.ReportEntry{
+		"/example-file": {
+			Path:      "/example-file",
+			Mode:      0777,
+			Hash:      "example-file_hash",
+			Size:      5688,
+			Slices:    map[*setup.Slice]bool{oneSlice: true},
+			FinalHash: "example-file_hash_changed",
+			Inode:     1,
+		},
+		"/example-link": {
+			Path:      "/example-link",
+			Mode:      0777,
+			Hash:      "example-file_hash",
+			Size:      5688,
+			Slices:    map[*setup.Slice]bool{oneSlice: true},
+			FinalHash: "example-file_hash_changed",
+			Inode:     1,
+		}},
 }, {
 	summary: "Calling mutated with identical content to initial file",
 	add: []sliceAndEntry{
@@ -3,18 +3,27 @@ package slicer
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/deb"
 	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/ldcache"
+	"github.com/canonical/chisel/internal/manifest"
 	"github.com/canonical/chisel/internal/scripts"
 	"github.com/canonical/chisel/internal/setup"
 )
@@ -23,6 +32,20 @@ type RunOptions struct {
 	Selection *setup.Selection
 	Archives  map[string]archive.Archive
 	TargetDir string
+	// FS holds the content under TargetDir. When nil, the content is
+	// written to disk.
+	FS fsutil.FS
+	// SourceDate makes the output reproducible when not zero. Entries
+	// extracted from packages keep their modification time from the
+	// package, clamped to SourceDate, and all other entries, including
+	// parent directories and mutated files, have it set to SourceDate.
+	SourceDate time.Time
+	// Installed is the manifest of the content already in TargetDir, when
+	// adding slices to an existing tree. The installed slices must be part
+	// of the selection. Their paths are kept as they are and their mutation
+	// scripts are not run again, so only the content of the other slices is
+	// created.
+	Installed *manifest.Manifest
 }
 
 type pathData struct {
@@ -71,6 +94,12 @@ func Run(options *RunOptions) (*Report, error) {
 		syscall.Umask(oldUmask)
 	}()
 
+	fsys := options.FS
+	if fsys == nil {
+		fsys = fsutil.DiskFS
+	}
+	var mtimes *mtimeFS
+
 	targetDir := filepath.Clean(options.TargetDir)
 	if !filepath.IsAbs(targetDir) {
 		dir, err := os.Getwd()
@@ -79,26 +108,48 @@ func Run(options *RunOptions) (*Report, error) {
 		}
 		targetDir = filepath.Join(dir, targetDir)
 	}
+	if !options.SourceDate.IsZero() {
+		mtimes = &mtimeFS{
+			FS:         fsys,
+			rootDir:    targetDir,
+			sourceDate: options.SourceDate,
+			mtimes:     make(map[string]time.Time),
+		}
+		fsys = mtimes
+	}
+
+	var installed *installedContent
+	if options.Installed != nil {
+		var err error
+		installed, err = readInstalled(options.Installed, options.Selection, targetDir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read installed content: %w", err)
+		}
+	}
 
 	// Build information to process the selection.
 	extract := make(map[string]map[string][]deb.ExtractInfo)
 	archives := make(map[string]archive.Archive)
+	archs := make(map[string]string)
+	pkgInfos := make(map[string]*archive.PackageInfo)
 	for _, slice := range options.Selection.Slices {
-		extractPackage := extract[slice.Package]
-		if extractPackage == nil {
-			archiveName := options.Selection.Release.Packages[slice.Package].Archive
-			archive := options.Archives[archiveName]
-			if archive == nil {
-				return nil, fmt.Errorf("archive %q not defined", archiveName)
-			}
-			if !archive.Exists(slice.Package) {
-				return nil, fmt.Errorf("slice package %q missing from archive", slice.Package)
+		if archives[slice.Package] == nil {
+			archive, err := selectPackageArchive(options, slice.Package)
+			if err != nil {
+				return nil, err
 			}
 			archives[slice.Package] = archive
+			archs[slice.Package] = archive.Options().Arch
+		}
+		if installed.hasSlice(slice) {
+			continue
+		}
+		extractPackage := extract[slice.Package]
+		if extractPackage == nil {
 			extractPackage = make(map[string][]deb.ExtractInfo)
 			extract[slice.Package] = extractPackage
 		}
-		arch := archives[slice.Package].Options().Arch
+		arch := archs[slice.Package]
 		copyrightPath := "/usr/share/doc/" + slice.Package + "/copyright"
 		hasCopyright := false
 		for targetPath, pathInfo := range slice.Contents {
@@ -135,6 +186,18 @@ func Run(options *RunOptions) (*Report, error) {
 				})
 			}
 		}
+		for _, alt := range slice.Alternatives {
+			// Preserve the permissions of the parent directory of the
+			// alternative link from the tarball where possible.
+			targetDir := filepath.Dir(alt.Link) + "/"
+			if targetDir == "/" {
+				continue
+			}
+			extractPackage[targetDir] = append(extractPackage[targetDir], deb.ExtractInfo{
+				Path:     targetDir,
+				Optional: true,
+			})
+		}
 		if !hasCopyright {
 			extractPackage[copyrightPath] = append(extractPackage[copyrightPath], deb.ExtractInfo{
 				Path:     copyrightPath,
@@ -143,18 +206,49 @@ func Run(options *RunOptions) (*Report, error) {
 		}
 	}
 
-	// Fetch all packages, using the selection order.
-	packages := make(map[string]io.ReadCloser)
+	// Only packages with slices to install are looked up in the archives,
+	// and they must not change version when adding slices to installed
+	// packages. Other packages are described as they were installed.
 	for _, slice := range options.Selection.Slices {
-		if packages[slice.Package] != nil {
+		if pkgInfos[slice.Package] != nil {
+			continue
+		}
+		installedInfo := installed.packageInfo(slice.Package)
+		if extract[slice.Package] == nil && installedInfo != nil {
+			pkgInfos[slice.Package] = installedInfo
 			continue
 		}
-		reader, err := archives[slice.Package].Fetch(slice.Package)
+		info, err := archives[slice.Package].Info(slice.Package)
+		if err != nil {
+			return nil, err
+		}
+		if installedInfo != nil && installedInfo.Version != info.Version {
+			return nil, fmt.Errorf("cannot add slices of package %s: installed version %s differs from archive version %s",
+				slice.Package, installedInfo.Version, info.Version)
+		}
+		pkgInfos[slice.Package] = info
+	}
+
+	if installed != nil {
+		err := installed.checkScripts(options.Selection, archs)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	// Fetch all packages with slices to install, using the selection order.
+	var pkgNames []string
+	for _, slice := range options.Selection.Slices {
+		if extract[slice.Package] != nil && !slices.Contains(pkgNames, slice.Package) {
+			pkgNames = append(pkgNames, slice.Package)
+		}
+	}
+	packages, err := fetchPackages(pkgNames, archives)
+	if err != nil {
+		return nil, err
+	}
+	for _, reader := range packages {
 		defer reader.Close()
-		packages[slice.Package] = reader
 	}
 
 	// When creating content, record if a path is known and whether they are
@@ -166,13 +260,32 @@ func Run(options *RunOptions) (*Report, error) {
 	if err != nil {
 		return nil, fmt.Errorf("internal error: cannot create report: %w", err)
 	}
+	report.Packages = pkgInfos
+	if installed != nil {
+		err = installed.addTo(report, knownPaths, options.Selection)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Creates the filesystem entry and adds it to the report. It also updates
 	// knownPaths with the files created.
 	create := func(extractInfos []deb.ExtractInfo, o *fsutil.CreateOptions) error {
-		entry, err := fsutil.Create(o)
-		if err != nil {
-			return err
+		relPath := filepath.Clean("/" + strings.TrimPrefix(o.Path, targetDir))
+		if o.Mode.IsDir() {
+			relPath = relPath + "/"
+		}
+		// Installed content is kept as it is, as it may have been mutated.
+		var entry *fsutil.Entry
+		if !installed.hasPath(relPath) {
+			err := setCapabilities(o, extractCapabilities(extractInfos))
+			if err != nil {
+				return err
+			}
+			entry, err = fsys.Create(o)
+			if err != nil {
+				return err
+			}
 		}
 		// Content created was not listed in a slice contents because extractInfo
 		// is empty.
@@ -180,10 +293,6 @@ func Run(options *RunOptions) (*Report, error) {
 			return nil
 		}
 
-		relPath := filepath.Clean("/" + strings.TrimPrefix(o.Path, targetDir))
-		if o.Mode.IsDir() {
-			relPath = relPath + "/"
-		}
 		inSliceContents := false
 		until := setup.UntilMutate
 		mutable := false
@@ -206,6 +315,10 @@ func Run(options *RunOptions) (*Report, error) {
 			}
 			// Do not add paths with "until: mutate".
 			if pathInfo.Until != setup.UntilMutate {
+				if entry == nil {
+					report.Entries[relPath].Slices[slice] = true
+					continue
+				}
 				err := report.Add(slice, entry)
 				if err != nil {
 					return err
@@ -239,49 +352,78 @@ func Run(options *RunOptions) (*Report, error) {
 		}
 	}
 
-	// Create new content not coming from packages.
-	done := make(map[string]bool)
+	// Create new content not coming from packages. Paths are sorted so that
+	// directories are created with their own options before their content.
+	var newPaths []string
+	newPathSlice := make(map[string]*setup.Slice)
 	for _, slice := range options.Selection.Slices {
-		arch := archives[slice.Package].Options().Arch
+		if installed.hasSlice(slice) {
+			continue
+		}
+		arch := archs[slice.Package]
 		for relPath, pathInfo := range slice.Contents {
 			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
 				continue
 			}
-			if done[relPath] || pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath {
+			if newPathSlice[relPath] != nil || pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath ||
+				pathInfo.Kind == setup.GeneratePath {
 				continue
 			}
-			done[relPath] = true
-			data := pathData{
-				until:   pathInfo.Until,
-				mutable: pathInfo.Mutable,
+			newPathSlice[relPath] = slice
+			newPaths = append(newPaths, relPath)
+		}
+	}
+	sort.Strings(newPaths)
+	for _, relPath := range newPaths {
+		slice := newPathSlice[relPath]
+		pathInfo := slice.Contents[relPath]
+		if installed.hasPath(relPath) {
+			if pathInfo.Until != setup.UntilMutate {
+				report.Entries[relPath].Slices[slice] = true
 			}
-			addKnownPath(knownPaths, relPath, data)
-			targetPath := filepath.Join(targetDir, relPath)
-			entry, err := createFile(targetPath, pathInfo)
+			continue
+		}
+		data := pathData{
+			until:   pathInfo.Until,
+			mutable: pathInfo.Mutable,
+		}
+		addKnownPath(knownPaths, relPath, data)
+		targetPath := filepath.Join(targetDir, relPath)
+		entry, err := createFile(fsys, targetPath, pathInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		// Do not add paths with "until: mutate".
+		if pathInfo.Until != setup.UntilMutate {
+			err = report.Add(slice, entry)
 			if err != nil {
 				return nil, err
 			}
-
-			// Do not add paths with "until: mutate".
-			if pathInfo.Until != setup.UntilMutate {
-				err = report.Add(slice, entry)
-				if err != nil {
-					return nil, err
-				}
-			}
 		}
 	}
 
+	err = createAlternatives(fsys, targetDir, options.Selection, report, knownPaths)
+	if err != nil {
+		return nil, err
+	}
+
 	// Run mutation scripts. Order is fundamental here as
 	// dependencies must run before dependents.
 	checker := contentChecker{knownPaths}
 	content := &scripts.ContentValue{
 		RootDir:    targetDir,
+		FS:         fsys,
 		CheckWrite: checker.checkMutable,
 		CheckRead:  checker.checkKnown,
 		OnWrite:    report.Mutate,
 	}
 	for _, slice := range options.Selection.Slices {
+		// Installed content already went through the scripts of the
+		// installed slices.
+		if installed.hasSlice(slice) {
+			continue
+		}
 		opts := scripts.RunOptions{
 			Label:  "mutate",
 			Script: slice.Scripts.Mutate,
@@ -295,17 +437,557 @@ func Run(options *RunOptions) (*Report, error) {
 		}
 	}
 
-	err = removeAfterMutate(targetDir, knownPaths)
+	err = removeAfterMutate(fsys, targetDir, knownPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	err = generateLdCaches(fsys, targetDir, options.Selection, archs, report)
+	if err != nil {
+		return nil, err
+	}
+
+	err = generateDpkgStatus(fsys, targetDir, options.Selection, archs, report)
 	if err != nil {
 		return nil, err
 	}
 
+	err = generateManifests(fsys, targetDir, options.Selection, archs, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if mtimes != nil {
+		err = mtimes.apply()
+		if err != nil {
+			return nil, fmt.Errorf("cannot set modification times: %w", err)
+		}
+	}
+
 	return report, nil
 }
 
+// mtimeFS records the modification time of every entry created through it,
+// clamped to sourceDate, along with its parent directories up to rootDir.
+// Creating entries changes the modification time of their parent
+// directories, so the times are only set by apply once all content exists.
+type mtimeFS struct {
+	fsutil.FS
+	rootDir    string
+	sourceDate time.Time
+	mtimes     map[string]time.Time
+}
+
+func (m *mtimeFS) Create(options *fsutil.CreateOptions) (*fsutil.Entry, error) {
+	entry, err := m.FS.Create(options)
+	if err != nil {
+		return nil, err
+	}
+	mtime := options.MTime
+	if mtime.IsZero() || mtime.After(m.sourceDate) {
+		mtime = m.sourceDate
+	}
+	path := filepath.Clean(options.Path)
+	m.mtimes[path] = mtime
+	for path != m.rootDir && path != "/" {
+		path = filepath.Dir(path)
+		if _, ok := m.mtimes[path]; ok {
+			// Parents were recorded along with path.
+			break
+		}
+		m.mtimes[path] = m.sourceDate
+	}
+	return entry, nil
+}
+
+// apply sets the recorded modification times on the entries that still
+// exist.
+func (m *mtimeFS) apply() error {
+	for path, mtime := range m.mtimes {
+		err := m.FS.SetMTime(path, mtime)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchWorkers bounds the number of packages fetched concurrently.
+var fetchWorkers = 8
+
+// fetchPackages fetches the packages concurrently from their archives. If
+// any of them fails, the error for the first failing package in pkgNames
+// is returned so that the outcome does not depend on timing.
+func fetchPackages(pkgNames []string, archives map[string]archive.Archive) (map[string]io.ReadCloser, error) {
+	readers := make([]io.ReadCloser, len(pkgNames))
+	errs := make([]error, len(pkgNames))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(fetchWorkers, len(pkgNames)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				readers[i], errs[i] = archives[pkgNames[i]].Fetch(pkgNames[i])
+			}
+		}()
+	}
+	for i := range pkgNames {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var err error
+	packages := make(map[string]io.ReadCloser, len(pkgNames))
+	for i, pkgName := range pkgNames {
+		if errs[i] != nil {
+			if err == nil {
+				err = errs[i]
+			}
+			continue
+		}
+		packages[pkgName] = readers[i]
+	}
+	if err != nil {
+		for _, reader := range packages {
+			reader.Close()
+		}
+		return nil, err
+	}
+	return packages, nil
+}
+
+// selectPackageArchive returns the archive the package is fetched from. That
+// is the archive selected by the package, if any, or otherwise the archive
+// with the highest priority that has the package.
+func selectPackageArchive(options *RunOptions, pkgName string) (archive.Archive, error) {
+	release := options.Selection.Release
+	archiveName := release.Packages[pkgName].Archive
+	if archiveName != "" {
+		archive := options.Archives[archiveName]
+		if archive == nil {
+			return nil, fmt.Errorf("archive %q not defined", archiveName)
+		}
+		if !archive.Exists(pkgName) {
+			return nil, fmt.Errorf("slice package %q missing from archive", pkgName)
+		}
+		return archive, nil
+	}
+
+	archiveInfos := make([]*setup.Archive, 0, len(release.Archives))
+	for _, archiveInfo := range release.Archives {
+		archiveInfos = append(archiveInfos, archiveInfo)
+	}
+	// Archives are ordered by name when priorities do not tell them
+	// apart, so that the same archive is selected on every run.
+	sort.SliceStable(archiveInfos, func(i, j int) bool {
+		if archiveInfos[i].Priority != archiveInfos[j].Priority {
+			return archiveInfos[i].Priority > archiveInfos[j].Priority
+		}
+		return archiveInfos[i].Name < archiveInfos[j].Name
+	})
+	for _, archiveInfo := range archiveInfos {
+		archive := options.Archives[archiveInfo.Name]
+		if archive != nil && archive.Exists(pkgName) {
+			return archive, nil
+		}
+	}
+	return nil, fmt.Errorf("slice package %q missing from archives", pkgName)
+}
+
+const manifestMode fs.FileMode = 0644
+
+// generateManifests writes the manifest describing the selection and the
+// report into every directory marked with "generate: manifest". Each manifest
+// file is also added to the report, and thus listed in the manifest itself.
+func generateManifests(fsys fsutil.FS, targetDir string, selection *setup.Selection, archs map[string]string, report *Report) error {
+	manifestSlices := make(map[string][]*setup.Slice)
+	for _, slice := range selection.Slices {
+		arch := archs[slice.Package]
+		for relPath, pathInfo := range slice.Contents {
+			if pathInfo.Generate != setup.GenerateManifest {
+				continue
+			}
+			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
+				continue
+			}
+			manifestPath := strings.TrimSuffix(relPath, "**") + manifest.Filename
+			manifestSlices[manifestPath] = append(manifestSlices[manifestPath], slice)
+		}
+	}
+	if len(manifestSlices) == 0 {
+		return nil
+	}
+
+	// The manifest cannot describe its own digest and size, so its entries
+	// are added with the mode alone.
+	for relPath, pathSlices := range manifestSlices {
+		entry := &fsutil.Entry{
+			Path: filepath.Join(targetDir, relPath),
+			Mode: manifestMode,
+		}
+		for _, slice := range pathSlices {
+			err := report.Add(slice, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	relPaths := make([]string, 0, len(manifestSlices))
+	for relPath := range manifestSlices {
+		relPaths = append(relPaths, relPath)
+	}
+	return writeManifests(fsys, targetDir, relPaths, manifestWriteOptions(selection, archs, report))
+}
+
+// writeManifests writes the manifest described by options into each of the
+// relPaths under targetDir.
+func writeManifests(fsys fsutil.FS, targetDir string, relPaths []string, options *manifest.WriteOptions) error {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return err
+	}
+	err = manifest.Write(zw, options)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(relPaths)
+	for _, relPath := range relPaths {
+		logf("Writing manifest at %s...", relPath)
+		_, err := fsys.Create(&fsutil.CreateOptions{
+			Path:        filepath.Join(targetDir, relPath),
+			Mode:        manifestMode,
+			Data:        bytes.NewReader(buf.Bytes()),
+			MakeParents: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const ldCacheMode fs.FileMode = 0644
+
+// generateLdCaches writes the cache of the shared libraries in the tree, as
+// ldconfig would do when installing the packages, into every path marked
+// with "generate: ldconfig". Each cache file is also added to the report.
+func generateLdCaches(fsys fsutil.FS, targetDir string, selection *setup.Selection, archs map[string]string, report *Report) error {
+	var arch string
+	cacheSlices := make(map[string][]*setup.Slice)
+	for _, slice := range selection.Slices {
+		sliceArch := archs[slice.Package]
+		for relPath, pathInfo := range slice.Contents {
+			if pathInfo.Generate != setup.GenerateLdconfig {
+				continue
+			}
+			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, sliceArch) {
+				continue
+			}
+			cacheSlices[relPath] = append(cacheSlices[relPath], slice)
+			arch = sliceArch
+		}
+	}
+	if len(cacheSlices) == 0 {
+		return nil
+	}
+
+	cache, err := ldcache.Scan(&ldcache.ScanOptions{
+		FS:      fsys,
+		RootDir: targetDir,
+		Arch:    arch,
+	})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = cache.Write(&buf)
+	if err != nil {
+		return err
+	}
+
+	relPaths := make([]string, 0, len(cacheSlices))
+	for relPath := range cacheSlices {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	for _, relPath := range relPaths {
+		logf("Writing ld.so.cache at %s...", relPath)
+		entry, err := fsys.Create(&fsutil.CreateOptions{
+			Path:        filepath.Join(targetDir, relPath),
+			Mode:        ldCacheMode,
+			Data:        bytes.NewReader(buf.Bytes()),
+			MakeParents: true,
+		})
+		if err != nil {
+			return err
+		}
+		for _, slice := range cacheSlices[relPath] {
+			err := report.Add(slice, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const dpkgStatusMode fs.FileMode = 0644
+
+// generateDpkgStatus writes a dpkg status database describing the packages
+// with selected slices into every path marked with "generate: dpkg-status".
+// A file path receives the entries of all packages, while a path of the
+// form /dir/** receives one file per package, named after it, as in the
+// status.d directories read by security scanners. Each file is also added
+// to the report.
+func generateDpkgStatus(fsys fsutil.FS, targetDir string, selection *setup.Selection, archs map[string]string, report *Report) error {
+	statusSlices := make(map[string][]*setup.Slice)
+	for _, slice := range selection.Slices {
+		arch := archs[slice.Package]
+		for relPath, pathInfo := range slice.Contents {
+			if pathInfo.Generate != setup.GenerateDpkgStatus {
+				continue
+			}
+			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
+				continue
+			}
+			statusSlices[relPath] = append(statusSlices[relPath], slice)
+		}
+	}
+	if len(statusSlices) == 0 {
+		return nil
+	}
+
+	var pkgNames []string
+	pkgSlices := make(map[string][]*setup.Slice)
+	for _, slice := range selection.Slices {
+		if _, ok := pkgSlices[slice.Package]; !ok {
+			pkgNames = append(pkgNames, slice.Package)
+		}
+		pkgSlices[slice.Package] = append(pkgSlices[slice.Package], slice)
+	}
+	sort.Strings(pkgNames)
+	stanzas := make(map[string]string, len(pkgNames))
+	for _, pkgName := range pkgNames {
+		stanzas[pkgName] = dpkgStatusStanza(report.Packages[pkgName], pkgSlices[pkgName])
+	}
+
+	// Content of every file to write, and the slices that generate it.
+	contents := make(map[string]string)
+	fileSlices := make(map[string][]*setup.Slice)
+	for relPath, pathSlices := range statusSlices {
+		if dirPath, ok := strings.CutSuffix(relPath, "**"); ok {
+			for _, pkgName := range pkgNames {
+				contents[dirPath+pkgName] = stanzas[pkgName]
+				fileSlices[dirPath+pkgName] = pathSlices
+			}
+			continue
+		}
+		var content strings.Builder
+		for i, pkgName := range pkgNames {
+			if i > 0 {
+				content.WriteString("\n")
+			}
+			content.WriteString(stanzas[pkgName])
+		}
+		contents[relPath] = content.String()
+		fileSlices[relPath] = pathSlices
+	}
+
+	relPaths := make([]string, 0, len(contents))
+	for relPath := range contents {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	for _, relPath := range relPaths {
+		logf("Writing dpkg status at %s...", relPath)
+		entry, err := fsys.Create(&fsutil.CreateOptions{
+			Path:        filepath.Join(targetDir, relPath),
+			Mode:        dpkgStatusMode,
+			Data:        strings.NewReader(contents[relPath]),
+			MakeParents: true,
+		})
+		if err != nil {
+			return err
+		}
+		for _, slice := range fileSlices[relPath] {
+			err := report.Add(slice, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dpkgStatusStanza returns the dpkg status entry of a package. The package
+// is listed as installed, but the entry states that only the content of the
+// selected slices is present.
+func dpkgStatusStanza(info *archive.PackageInfo, pkgSlices []*setup.Slice) string {
+	sliceNames := make([]string, len(pkgSlices))
+	for i, slice := range pkgSlices {
+		sliceNames[i] = slice.String()
+	}
+	sort.Strings(sliceNames)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "Package: %s\n", info.Name)
+	fmt.Fprintf(&buf, "Status: install ok installed\n")
+	fmt.Fprintf(&buf, "Architecture: %s\n", info.Arch)
+	if info.Source != "" {
+		fmt.Fprintf(&buf, "Source: %s\n", info.Source)
+	}
+	fmt.Fprintf(&buf, "Version: %s\n", info.Version)
+	fmt.Fprintf(&buf, "Chisel-Slices: %s\n", strings.Join(sliceNames, " "))
+	fmt.Fprintf(&buf, "Description: slices of %s installed by Chisel\n", info.Name)
+	fmt.Fprintf(&buf, " Only the content of the slices listed in Chisel-Slices is present,\n")
+	fmt.Fprintf(&buf, " not the whole package.\n")
+	return buf.String()
+}
+
+// createAlternatives creates the links of the alternatives provided by the
+// selected slices, as update-alternatives would do when installing the
+// packages. When several slices provide the same alternative, the one with
+// the highest priority is used, and the first one in the selection order
+// among those with the same priority.
+func createAlternatives(fsys fsutil.FS, targetDir string, selection *setup.Selection, report *Report, knownPaths map[string]pathData) error {
+	for _, choice := range chooseAlternatives(selection) {
+		logf("Selecting alternative %s: %s", choice.name, choice.alt.Path)
+		for _, link := range choice.links() {
+			entry, err := fsys.Create(&fsutil.CreateOptions{
+				Path:        filepath.Join(targetDir, link.path),
+				Mode:        fs.ModeSymlink | 0777,
+				Link:        link.target,
+				MakeParents: true,
+			})
+			if err != nil {
+				return err
+			}
+			err = report.Add(choice.slice, entry)
+			if err != nil {
+				return err
+			}
+			addKnownPath(knownPaths, link.path, pathData{})
+		}
+	}
+	return nil
+}
+
+// alternativeChoice is the alternative selected among those provided by
+// the slices under the same name.
+type alternativeChoice struct {
+	name  string
+	slice *setup.Slice
+	alt   setup.Alternative
+}
+
+type alternativeLink struct {
+	path, target string
+}
+
+// links returns the symlinks that make the alternative: the generic name
+// pointing into the alternatives directory, and the entry there pointing
+// to the selected path.
+func (c *alternativeChoice) links() []alternativeLink {
+	adminPath := setup.AlternativesDir + c.name
+	return []alternativeLink{
+		{c.alt.Link, adminPath},
+		{adminPath, c.alt.Path},
+	}
+}
+
+// chooseAlternatives returns the alternatives selected among those provided
+// by the slices in the selection, sorted by name.
+func chooseAlternatives(selection *setup.Selection) []*alternativeChoice {
+	var names []string
+	chosen := make(map[string]*alternativeChoice)
+	for _, slice := range selection.Slices {
+		for name, alt := range slice.Alternatives {
+			old, ok := chosen[name]
+			if !ok {
+				names = append(names, name)
+			} else if old.alt.Priority >= alt.Priority {
+				continue
+			}
+			chosen[name] = &alternativeChoice{name, slice, alt}
+		}
+	}
+	sort.Strings(names)
+	choices := make([]*alternativeChoice, len(names))
+	for i, name := range names {
+		choices[i] = chosen[name]
+	}
+	return choices
+}
+
+// manifestWriteOptions returns the manifest content describing the
+// selection and the report.
+func manifestWriteOptions(selection *setup.Selection, archs map[string]string, report *Report) *manifest.WriteOptions {
+	options := &manifest.WriteOptions{
+		Slices: selection.Slices,
+	}
+	done := make(map[string]bool)
+	for _, slice := range selection.Slices {
+		if done[slice.Package] {
+			continue
+		}
+		done[slice.Package] = true
+		pkg := &manifest.Package{
+			Name: slice.Package,
+			Arch: archs[slice.Package],
+		}
+		if info := report.Packages[slice.Package]; info != nil {
+			pkg.Version = info.Version
+			pkg.Digest = info.SHA256
+		}
+		options.Packages = append(options.Packages, pkg)
+	}
+	for _, entry := range report.Entries {
+		sliceNames := make([]string, 0, len(entry.Slices))
+		for slice := range entry.Slices {
+			sliceNames = append(sliceNames, slice.String())
+		}
+		options.Paths = append(options.Paths, &manifest.Path{
+			Path:      entry.Path,
+			Mode:      fmt.Sprintf("0%o", fsutil.UnixPerm(entry.Mode)),
+			Slices:    sliceNames,
+			Hash:      entry.Hash,
+			FinalHash: entry.FinalHash,
+			Size:      uint64(entry.Size),
+			Link:      entry.Link,
+			Inode:     entry.Inode,
+			Device:    deviceType(entry.Mode),
+			Major:     entry.Major,
+			Minor:     entry.Minor,
+		})
+	}
+	return options
+}
+
+// deviceType returns the type of device described by mode, as recorded in
+// the manifest, or an empty string when mode is not for a device.
+func deviceType(mode fs.FileMode) string {
+	switch mode.Type() {
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return "char"
+	case fs.ModeDevice:
+		return "block"
+	case fs.ModeNamedPipe:
+		return "fifo"
+	}
+	return ""
+}
+
 // removeAfterMutate removes entries marked with until: mutate. A path is marked
 // only when all slices that refer to the path mark it with until: mutate.
-func removeAfterMutate(rootDir string, knownPaths map[string]pathData) error {
+func removeAfterMutate(fsys fsutil.FS, rootDir string, knownPaths map[string]pathData) error {
 	var untilDirs []string
 	for path, data := range knownPaths {
 		if data.until != setup.UntilMutate {
@@ -315,7 +997,7 @@ func removeAfterMutate(rootDir string, knownPaths map[string]pathData) error {
 		if strings.HasSuffix(path, "/") {
 			untilDirs = append(untilDirs, realPath)
 		} else {
-			err := os.Remove(realPath)
+			err := fsys.Remove(realPath)
 			if err != nil {
 				return fmt.Errorf("cannot perform 'until' removal: %w", err)
 			}
@@ -327,7 +1009,7 @@ func removeAfterMutate(rootDir string, knownPaths map[string]pathData) error {
 		return untilDirs[i] > untilDirs[j]
 	})
 	for _, realPath := range untilDirs {
-		err := os.Remove(realPath)
+		err := fsys.Remove(realPath)
 		// The non-empty directory error is caught by IsExist as well.
 		if err != nil && !os.IsExist(err) {
 			return fmt.Errorf("cannot perform 'until' removal: %#v", err)
@@ -362,7 +1044,7 @@ func addKnownPath(knownPaths map[string]pathData, path string, data pathData) {
 	}
 }
 
-func createFile(targetPath string, pathInfo setup.PathInfo) (*fsutil.Entry, error) {
+func createFile(fsys fsutil.FS, targetPath string, pathInfo setup.PathInfo) (*fsutil.Entry, error) {
 	targetMode := pathInfo.Mode
 	if targetMode == 0 {
 		if pathInfo.Kind == setup.DirPath {
@@ -380,20 +1062,79 @@ func createFile(targetPath string, pathInfo setup.PathInfo) (*fsutil.Entry, erro
 	case setup.TextPath:
 		tarHeader.Typeflag = tar.TypeReg
 		fileContent = bytes.NewBufferString(pathInfo.Info)
+	case setup.Base64Path:
+		data, err := base64.StdEncoding.DecodeString(pathInfo.Info)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base64 content of %s: %w", targetPath, err)
+		}
+		tarHeader.Typeflag = tar.TypeReg
+		fileContent = bytes.NewReader(data)
 	case setup.DirPath:
 		tarHeader.Typeflag = tar.TypeDir
 	case setup.SymlinkPath:
 		tarHeader.Typeflag = tar.TypeSymlink
 		linkTarget = pathInfo.Info
+	case setup.DevicePath:
+		switch pathInfo.Info {
+		case "char":
+			tarHeader.Typeflag = tar.TypeChar
+		case "block":
+			tarHeader.Typeflag = tar.TypeBlock
+		default:
+			tarHeader.Typeflag = tar.TypeFifo
+		}
 	default:
 		return nil, fmt.Errorf("internal error: cannot extract path of kind %q", pathInfo.Kind)
 	}
 
-	return fsutil.Create(&fsutil.CreateOptions{
+	createOptions := &fsutil.CreateOptions{
 		Path:        targetPath,
 		Mode:        tarHeader.FileInfo().Mode(),
 		Data:        fileContent,
 		Link:        linkTarget,
 		MakeParents: true,
-	})
+		UID:         pathInfo.UID,
+		GID:         pathInfo.GID,
+		Major:       pathInfo.Major,
+		Minor:       pathInfo.Minor,
+	}
+	err := setCapabilities(createOptions, pathInfo.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Create(createOptions)
+}
+
+// extractCapabilities returns the capabilities declared in the slice
+// contents for the extracted entry, if any.
+func extractCapabilities(extractInfos []deb.ExtractInfo) string {
+	for _, extractInfo := range extractInfos {
+		slice, ok := extractInfo.Context.(*setup.Slice)
+		if !ok {
+			continue
+		}
+		if capabilities := slice.Contents[extractInfo.Path].Capabilities; capabilities != "" {
+			return capabilities
+		}
+	}
+	return ""
+}
+
+// setCapabilities sets the capabilities of the entry to be created, replacing
+// the ones it would otherwise have.
+func setCapabilities(o *fsutil.CreateOptions, capabilities string) error {
+	if capabilities == "" {
+		return nil
+	}
+	value, err := fsutil.ParseCapabilities(capabilities)
+	if err != nil {
+		return err
+	}
+	xattrs := make(map[string]string, len(o.Xattrs)+1)
+	for name, value := range o.Xattrs {
+		xattrs[name] = value
+	}
+	xattrs[fsutil.CapabilityXattr] = value
+	o.Xattrs = xattrs
+	return nil
 }
@@ -3,19 +3,30 @@ package slicer_test
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sys/unix"
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/manifest"
 	"github.com/canonical/chisel/internal/setup"
 	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/tarutil"
 	"github.com/canonical/chisel/internal/testutil"
 )
 
@@ -24,15 +35,19 @@ var (
 )
 
 type slicerTest struct {
-	summary    string
-	arch       string
-	release    map[string]string
-	pkgs       map[string][]byte
-	slices     []setup.SliceKey
-	hackopt    func(c *C, opts *slicer.RunOptions)
-	filesystem map[string]string
-	report     map[string]string
-	error      string
+	summary string
+	arch    string
+	release map[string]string
+	pkgs    map[string][]byte
+	// archivePkgs overrides pkgs for the archives it holds.
+	archivePkgs   map[string]map[string][]byte
+	slices        []setup.SliceKey
+	hackopt       func(c *C, opts *slicer.RunOptions)
+	filesystem    map[string]string
+	report        map[string]string
+	manifestPaths map[string]string
+	manifestPkgs  map[string]string
+	error         string
 }
 
 var packageEntries = map[string][]testutil.TarEntry{
@@ -73,7 +88,7 @@ var testPackageCopyrightEntries = []testutil.TarEntry{
 
 var slicerTests = []slicerTest{{
 	summary: "Basic slicing",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -106,7 +121,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Glob extraction",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -128,7 +143,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Create new file under extracted directory and preserve parent directory permissions",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -148,7 +163,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Create new nested file under extracted directory and preserve parent directory permissions",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -169,7 +184,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Create new directory under extracted directory and preserve parent directory permissions",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -189,7 +204,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Create new file using glob and preserve parent directory permissions",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		"test-package": testutil.PackageData["test-package"],
 	},
@@ -216,7 +231,7 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Conditional architecture",
 	arch:    "amd64",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -247,7 +262,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Copyright is installed",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		// Add the copyright entries to the package.
 		"test-package": testutil.MustMakeDeb(append(testutil.TestPackageEntries, testPackageCopyrightEntries...)),
@@ -277,8 +292,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Install two packages",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice"},
-		{"other-package", "myslice"}},
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "other-package", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		"test-package":  testutil.PackageData["test-package"],
 		"other-package": testutil.PackageData["other-package"],
@@ -317,8 +332,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Install two packages, explicit path has preference over implicit parent",
 	slices: []setup.SliceKey{
-		{"implicit-parent", "myslice"},
-		{"explicit-dir", "myslice"}},
+		{Package: "implicit-parent", Slice: "myslice"},
+		{Package: "explicit-dir", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		"implicit-parent": testutil.MustMakeDeb([]testutil.TarEntry{
 			testutil.Dir(0755, "./dir/"),
@@ -355,8 +370,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Valid same file in two slices in different packages",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice"},
-		{"other-package", "myslice"}},
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "other-package", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		"test-package":  testutil.PackageData["test-package"],
 		"other-package": testutil.PackageData["other-package"],
@@ -388,7 +403,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: write a file",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -409,7 +424,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: read a file",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -435,7 +450,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: use 'until' to remove file after mutate",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -459,7 +474,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: use 'until' to remove wildcard after mutate",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -477,7 +492,7 @@ var slicerTests = []slicerTest{{
 	report: map[string]string{},
 }, {
 	summary: "Script: 'until' does not remove non-empty directories",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -498,7 +513,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: writing same contents to existing file does not set the final hash in report",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -519,7 +534,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Script: cannot write non-mutable files",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -534,7 +549,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: cannot write file which is not mutable: /dir/text-file`,
 }, {
 	summary: "Script: cannot write to unlisted file",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -548,7 +563,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: cannot write file which is not mutable: /dir/text-file`,
 }, {
 	summary: "Script: cannot write to directory",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -563,7 +578,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: cannot write file which is not mutable: /dir/`,
 }, {
 	summary: "Script: cannot read unlisted content",
-	slices:  []setup.SliceKey{{"test-package", "myslice2"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice2"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -579,7 +594,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice2: cannot read file which is not selected: /dir/text-file`,
 }, {
 	summary: "Script: can read globbed content",
-	slices:  []setup.SliceKey{{"test-package", "myslice1"}, {"test-package", "myslice2"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice1"}, {Package: "test-package", Slice: "myslice2"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -594,7 +609,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Relative content root directory must not error",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -615,7 +630,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Can list parent directories of normal paths",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -634,7 +649,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Cannot list unselected directory",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -649,7 +664,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: cannot list directory which is not selected: /a/d/`,
 }, {
 	summary: "Cannot list file path as a directory",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -664,7 +679,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: content is not a directory: /a/b/c`,
 }, {
 	summary: "Can list parent directories of globs",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -678,7 +693,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Cannot list directories not matched by glob",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -693,7 +708,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: cannot list directory which is not selected: /other-dir/`,
 }, {
 	summary: "Duplicate copyright symlink is ignored",
-	slices:  []setup.SliceKey{{"copyright-symlink-openssl", "bins"}},
+	slices:  []setup.SliceKey{{Package: "copyright-symlink-openssl", Slice: "bins"}},
 	pkgs: map[string][]byte{
 		"copyright-symlink-openssl": testutil.MustMakeDeb(packageEntries["copyright-symlink-openssl"]),
 		"copyright-symlink-libssl3": testutil.MustMakeDeb(packageEntries["copyright-symlink-libssl3"]),
@@ -722,7 +737,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Can list unclean directory paths",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -741,7 +756,7 @@ var slicerTests = []slicerTest{{
 	},
 }, {
 	summary: "Cannot read directories",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
 			package: test-package
@@ -756,7 +771,7 @@ var slicerTests = []slicerTest{{
 	error: `slice test-package_myslice: content is not a file: /x/y`,
 }, {
 	summary: "Non-default archive",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	release: map[string]string{
 		"chisel.yaml": `
 			format: chisel-v1
@@ -792,11 +807,187 @@ var slicerTests = []slicerTest{{
 	report: map[string]string{
 		"/dir/nested/file": "file 0644 84237a05 {test-package_myslice}",
 	},
+}, {
+	summary: "Packages fall through archives by priority",
+	slices: []setup.SliceKey{
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "other-package", Slice: "myslice"},
+	},
+	archivePkgs: map[string]map[string][]byte{
+		"foo": {
+			"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+				testutil.Dir(0755, "./"),
+				testutil.Dir(0755, "./dir/"),
+				testutil.Reg(0644, "./dir/file", "hotfix"),
+			}),
+		},
+		"bar": {
+			"test-package":  testutil.PackageData["test-package"],
+			"other-package": testutil.PackageData["other-package"],
+		},
+	},
+	release: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main]
+					priority: 20
+					v1-public-keys: [test-key]
+				bar:
+					version: 22.04
+					components: [main, universe]
+					priority: 10
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file:
+		`,
+	},
+	filesystem: map[string]string{
+		"/dir/":     "dir 0755",
+		"/dir/file": "file 0644 eda660b8",
+		"/file":     "file 0644 fc02ca0e",
+	},
+	report: map[string]string{
+		"/dir/file": "file 0644 eda660b8 {test-package_myslice}",
+		"/file":     "file 0644 fc02ca0e {other-package_myslice}",
+	},
+}, {
+	summary: "Packages fall through archives by name without priorities or default",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
+	archivePkgs: map[string]map[string][]byte{
+		"foo": {
+			"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+				testutil.Dir(0755, "./"),
+				testutil.Dir(0755, "./dir/"),
+				testutil.Reg(0644, "./dir/file", "hotfix"),
+			}),
+		},
+		"bar": {
+			"test-package": testutil.PackageData["test-package"],
+		},
+	},
+	release: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main]
+					v1-public-keys: [test-key]
+				bar:
+					version: 22.04
+					components: [main, universe]
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+	},
+	filesystem: map[string]string{
+		"/dir/":     "dir 0755",
+		"/dir/file": "file 0644 cc55e2ec",
+	},
+	report: map[string]string{
+		"/dir/file": "file 0644 cc55e2ec {test-package_myslice}",
+	},
+}, {
+	summary: "Package missing from all archives",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
+	archivePkgs: map[string]map[string][]byte{
+		"foo": {},
+		"bar": {},
+	},
+	release: map[string]string{
+		"chisel.yaml": `
+			format: chisel-v1
+			archives:
+				foo:
+					version: 22.04
+					components: [main]
+					priority: 20
+					v1-public-keys: [test-key]
+				bar:
+					version: 22.04
+					components: [main, universe]
+					priority: 10
+					v1-public-keys: [test-key]
+			v1-public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+	},
+	error: `slice package "test-package" missing from archives`,
+}, {
+	summary: "Fetch errors are reported",
+	slices: []setup.SliceKey{
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "other-package", Slice: "myslice"},
+	},
+	pkgs: map[string][]byte{
+		"test-package":  testutil.PackageData["test-package"],
+		"other-package": testutil.PackageData["other-package"],
+	},
+	hackopt: func(c *C, opts *slicer.RunOptions) {
+		for name, a := range opts.Archives {
+			opts.Archives[name] = &fetchErrorArchive{a, "other-package"}
+		}
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file:
+		`,
+	},
+	error: `cannot fetch "other-package": BAM`,
 }, {
 	summary: "Multiple slices of same package",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice1"},
-		{"test-package", "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -833,8 +1024,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Same glob in several entries with until:mutate and reading from script",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice1"},
-		{"test-package", "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -879,8 +1070,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Overlapping globs, until:mutate and reading from script",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice2"},
-		{"test-package", "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -925,8 +1116,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Overlapping glob and single entry, until:mutate on entry and reading from script",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice1"},
-		{"test-package", "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -971,8 +1162,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Overlapping glob and single entry, until:mutate on glob and reading from script",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice1"},
-		{"test-package", "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -1000,8 +1191,8 @@ var slicerTests = []slicerTest{{
 }, {
 	summary: "Overlapping glob and single entry, until:mutate on both and reading from script",
 	slices: []setup.SliceKey{
-		{"test-package", "myslice1"},
-		{"test-package", "myslice2"},
+		{Package: "test-package", Slice: "myslice1"},
+		{Package: "test-package", Slice: "myslice2"},
 	},
 	release: map[string]string{
 		"slices/mydir/test-package.yaml": `
@@ -1021,9 +1212,215 @@ var slicerTests = []slicerTest{{
 	},
 	filesystem: map[string]string{},
 	report:     map[string]string{},
+}, {
+	summary: "Generate manifest",
+	arch:    "amd64",
+	slices: []setup.SliceKey{
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "test-package", Slice: "manifest"},
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+						/dir/text-file: {text: data1}
+						/dir/link: {symlink: file}
+				manifest:
+					contents:
+						/db/**: {generate: manifest}
+		`,
+	},
+	filesystem: map[string]string{
+		"/db/":              "dir 0755",
+		"/db/manifest.wall": "file 0644 b3e3f735",
+		"/dir/":             "dir 0755",
+		"/dir/file":         "file 0644 cc55e2ec",
+		"/dir/link":         "symlink file",
+		"/dir/text-file":    "file 0644 5b41362b",
+	},
+	report: map[string]string{
+		"/db/manifest.wall": "file 0644 empty {test-package_manifest}",
+		"/dir/file":         "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/link":         "symlink file {test-package_myslice}",
+		"/dir/text-file":    "file 0644 5b41362b {test-package_myslice}",
+	},
+	manifestPaths: map[string]string{
+		"/db/manifest.wall": "file 0644 empty {test-package_manifest}",
+		"/dir/file":         "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/link":         "symlink file {test-package_myslice}",
+		"/dir/text-file":    "file 0644 5b41362b {test-package_myslice}",
+	},
+	manifestPkgs: map[string]string{
+		"test-package": "test-package 1.0 434fa0dfdb0ccd8c8fe46bd1f7505cb773ddbaf6718ba319193cb407c8b53428 amd64",
+	},
+}, {
+	summary: "Generate manifest in several directories and slices",
+	arch:    "amd64",
+	slices: []setup.SliceKey{
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "other-package", Slice: "manifest"},
+	},
+	pkgs: map[string][]byte{
+		"test-package":  testutil.PackageData["test-package"],
+		"other-package": testutil.PackageData["other-package"],
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+						/db/**: {generate: manifest}
+						/other-db/**: {generate: manifest, arch: i386}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				manifest:
+					contents:
+						/file:
+						/db/**: {generate: manifest}
+						/dir/db/**: {generate: manifest}
+		`,
+	},
+	manifestPaths: map[string]string{
+		"/db/manifest.wall":     "file 0644 empty {other-package_manifest,test-package_myslice}",
+		"/dir/db/manifest.wall": "file 0644 empty {other-package_manifest}",
+		"/dir/file":             "file 0644 cc55e2ec {test-package_myslice}",
+		"/file":                 "file 0644 fc02ca0e {other-package_manifest}",
+	},
+	manifestPkgs: map[string]string{
+		"other-package": "other-package 1.0 af90e922c58f524c8ba5d979720797e0d1269d17ed963883940279435535686e amd64",
+		"test-package":  "test-package 1.0 434fa0dfdb0ccd8c8fe46bd1f7505cb773ddbaf6718ba319193cb407c8b53428 amd64",
+	},
+}, {
+	summary: "Create base64 content",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/etc/blob: {base64: "AAECAw==", mode: 0600}
+						/etc/empty: {base64: ""}
+					mutate: |
+						data = content.read("/etc/blob")
+						if len(data) != 4:
+							fail("unexpected content length: %d" % len(data))
+		`,
+	},
+	filesystem: map[string]string{
+		"/etc/":      "dir 0755",
+		"/etc/blob":  "file 0600 054edec1",
+		"/etc/empty": "file 0644 empty",
+	},
+	report: map[string]string{
+		"/etc/blob":  "file 0600 054edec1 {test-package_myslice}",
+		"/etc/empty": "file 0644 empty {test-package_myslice}",
+	},
+}, {
+	summary: "Generate ld.so.cache",
+	arch:    "amd64",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}, {Package: "test-package", Slice: "manifest"}},
+	pkgs: map[string][]byte{
+		"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Dir(0755, "./etc/"),
+			testutil.Dir(0755, "./usr/"),
+			testutil.Dir(0755, "./usr/lib/"),
+			testutil.Dir(0755, "./usr/lib/x86_64-linux-gnu/"),
+			testutil.Reg(0644, "./usr/lib/x86_64-linux-gnu/libfoo.so.1.2", string(testutil.MakeSharedObject(elf.EM_X86_64, "libfoo.so.1"))),
+			testutil.Lnk(0777, "./usr/lib/x86_64-linux-gnu/libfoo.so.1", "libfoo.so.1.2"),
+		}),
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/usr/lib/x86_64-linux-gnu/libfoo.so.1*:
+						/etc/ld.so.cache: {generate: ldconfig}
+				manifest:
+					contents:
+						/db/**: {generate: manifest}
+		`,
+	},
+	filesystem: map[string]string{
+		"/db/":                                  "dir 0755",
+		"/db/manifest.wall":                     "file 0644 68a2c1ca",
+		"/etc/":                                 "dir 0755",
+		"/etc/ld.so.cache":                      "file 0644 3d63388d",
+		"/usr/":                                 "dir 0755",
+		"/usr/lib/":                             "dir 0755",
+		"/usr/lib/x86_64-linux-gnu/":            "dir 0755",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1": "symlink libfoo.so.1.2",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1.2": "file 0644 30c8f0d4",
+	},
+	manifestPaths: map[string]string{
+		"/db/manifest.wall":                       "file 0644 empty {test-package_manifest}",
+		"/etc/ld.so.cache":                        "file 0644 3d63388d {test-package_myslice}",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1":   "symlink libfoo.so.1.2 {test-package_myslice}",
+		"/usr/lib/x86_64-linux-gnu/libfoo.so.1.2": "file 0644 30c8f0d4 {test-package_myslice}",
+	},
+}, {
+	summary: "Alternatives with the highest priority are selected",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "tiny"}, {Package: "test-package", Slice: "basic"}},
+	pkgs: map[string][]byte{
+		"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Dir(0755, "./usr/"),
+			testutil.Dir(0755, "./usr/bin/"),
+			testutil.Reg(0755, "./usr/bin/vim.basic", "basic"),
+			testutil.Reg(0755, "./usr/bin/vim.tiny", "tiny"),
+		}),
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				basic:
+					contents:
+						/usr/bin/vim.basic:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/vim.basic, priority: 30}
+						vi: {link: /usr/bin/vi, path: /usr/bin/vim.basic, priority: 30}
+				tiny:
+					contents:
+						/usr/bin/vim.tiny:
+					alternatives:
+						editor: {link: /usr/bin/editor, path: /usr/bin/vim.tiny, priority: 15}
+						vi: {link: /usr/bin/vi, path: /usr/bin/vim.tiny, priority: 30}
+		`,
+	},
+	filesystem: map[string]string{
+		"/etc/":                    "dir 0755",
+		"/etc/alternatives/":       "dir 0755",
+		"/etc/alternatives/editor": "symlink /usr/bin/vim.basic",
+		"/etc/alternatives/vi":     "symlink /usr/bin/vim.basic",
+		"/usr/":                    "dir 0755",
+		"/usr/bin/":                "dir 0755",
+		"/usr/bin/editor":          "symlink /etc/alternatives/editor",
+		"/usr/bin/vi":              "symlink /etc/alternatives/vi",
+		"/usr/bin/vim.basic":       "file 0755 fbb7b5bf",
+		"/usr/bin/vim.tiny":        "file 0755 8950abfd",
+	},
+	report: map[string]string{
+		"/etc/alternatives/editor": "symlink /usr/bin/vim.basic {test-package_basic}",
+		"/etc/alternatives/vi":     "symlink /usr/bin/vim.basic {test-package_basic}",
+		"/usr/bin/editor":          "symlink /etc/alternatives/editor {test-package_basic}",
+		"/usr/bin/vi":              "symlink /etc/alternatives/vi {test-package_basic}",
+		"/usr/bin/vim.basic":       "file 0755 fbb7b5bf {test-package_basic}",
+		"/usr/bin/vim.tiny":        "file 0755 8950abfd {test-package_tiny}",
+	},
 }, {
 	summary: "Relative paths are properly trimmed during extraction",
-	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
 	pkgs: map[string][]byte{
 		"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
 			// This particular path starting with "/foo" is chosen to test for
@@ -1051,6 +1448,78 @@ var slicerTests = []slicerTest{{
 						content.list("/foo-bar/")
 		`,
 	},
+}, {
+	summary: "Hard links are preserved when both paths are selected",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}, {Package: "test-package", Slice: "manifest"}},
+	pkgs: map[string][]byte{
+		"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Dir(0755, "./usr/"),
+			testutil.Dir(0755, "./usr/bin/"),
+			testutil.Reg(0755, "./usr/bin/perl5.34.0", "perl"),
+			testutil.Hlk(0755, "./usr/bin/perl", "./usr/bin/perl5.34.0"),
+		}),
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/usr/bin/perl5.34.0:
+						/usr/bin/perl:
+				manifest:
+					contents:
+						/db/**: {generate: manifest}
+		`,
+	},
+	filesystem: map[string]string{
+		"/db/":                "dir 0755",
+		"/db/manifest.wall":   "file 0644 8d8f4eb7",
+		"/usr/":               "dir 0755",
+		"/usr/bin/":           "dir 0755",
+		"/usr/bin/perl":       "file 0755 f0c929a9",
+		"/usr/bin/perl5.34.0": "file 0755 f0c929a9",
+	},
+	report: map[string]string{
+		"/db/manifest.wall":   "file 0644 empty {test-package_manifest}",
+		"/usr/bin/perl":       "file 0755 f0c929a9 inode 1 {test-package_myslice}",
+		"/usr/bin/perl5.34.0": "file 0755 f0c929a9 inode 1 {test-package_myslice}",
+	},
+	manifestPaths: map[string]string{
+		"/db/manifest.wall":   "file 0644 empty {test-package_manifest}",
+		"/usr/bin/perl":       "file 0755 f0c929a9 inode 1 {test-package_myslice}",
+		"/usr/bin/perl5.34.0": "file 0755 f0c929a9 inode 1 {test-package_myslice}",
+	},
+}, {
+	summary: "Hard link is copied when its target is not selected",
+	slices:  []setup.SliceKey{{Package: "test-package", Slice: "myslice"}},
+	pkgs: map[string][]byte{
+		"test-package": testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Dir(0755, "./usr/"),
+			testutil.Dir(0755, "./usr/bin/"),
+			testutil.Reg(0755, "./usr/bin/perl5.34.0", "perl"),
+			testutil.Hlk(0755, "./usr/bin/perl", "./usr/bin/perl5.34.0"),
+		}),
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/usr/bin/perl:
+		`,
+	},
+	filesystem: map[string]string{
+		"/usr/":         "dir 0755",
+		"/usr/bin/":     "dir 0755",
+		"/usr/bin/perl": "file 0755 f0c929a9",
+	},
+	report: map[string]string{
+		"/usr/bin/perl": "file 0755 f0c929a9 {test-package_myslice}",
+	},
 }}
 
 var defaultChiselYaml = `
@@ -1077,16 +1546,50 @@ func (a *testArchive) Options() *archive.Options {
 
 func (a *testArchive) Fetch(pkg string) (io.ReadCloser, error) {
 	if data, ok := a.pkgs[pkg]; ok {
-		return io.NopCloser(bytes.NewBuffer(data)), nil
+		// Packages are seekable, as with files fetched from archives.
+		return nopSeekCloser{bytes.NewReader(data)}, nil
 	}
 	return nil, fmt.Errorf("attempted to open %q package", pkg)
 }
 
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
 func (a *testArchive) Exists(pkg string) bool {
 	_, ok := a.pkgs[pkg]
 	return ok
 }
 
+func (a *testArchive) Info(pkg string) (*archive.PackageInfo, error) {
+	data, ok := a.pkgs[pkg]
+	if !ok {
+		return nil, fmt.Errorf("cannot find package %q in archive", pkg)
+	}
+	return &archive.PackageInfo{
+		Name:    pkg,
+		Version: "1.0",
+		Arch:    a.options.Arch,
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256(data)),
+		Size:    int64(len(data)),
+	}, nil
+}
+
+// fetchErrorArchive fails to fetch the given package.
+type fetchErrorArchive struct {
+	archive.Archive
+	pkg string
+}
+
+func (a *fetchErrorArchive) Fetch(pkg string) (io.ReadCloser, error) {
+	if pkg == a.pkg {
+		return nil, fmt.Errorf("cannot fetch %q: BAM", pkg)
+	}
+	return a.Archive.Fetch(pkg)
+}
+
 func (s *S) TestRun(c *C) {
 	// Run tests for format chisel-v1.
 	runSlicerTests(c, slicerTests)
@@ -1108,6 +1611,704 @@ func (s *S) TestRun(c *C) {
 	runSlicerTests(c, v1SlicerTests)
 }
 
+var reproducibleRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				contents:
+					/dir/old-file:
+					/dir/new-file:
+					/dir/mutated-file: {mutable: true}
+					/dir/link:
+					/other-dir/text-file: {text: data}
+					/other-dir/sub-dir/: {make: true}
+					/other-dir/until-file: {text: data, until: mutate}
+				mutate: |
+					content.write("/dir/mutated-file", "changed")
+	`,
+}
+
+func (s *S) TestRunReproducible(c *C) {
+	oldTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	newTime := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	sourceDate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	withTime := func(entry testutil.TarEntry, mtime time.Time) testutil.TarEntry {
+		entry.Header.ModTime = mtime
+		return entry
+	}
+	pkgData := testutil.MustMakeDeb([]testutil.TarEntry{
+		withTime(testutil.Dir(0755, "./"), oldTime),
+		withTime(testutil.Dir(0755, "./dir/"), oldTime),
+		withTime(testutil.Reg(0644, "./dir/old-file", "old"), oldTime),
+		withTime(testutil.Reg(0644, "./dir/new-file", "new"), newTime),
+		withTime(testutil.Reg(0644, "./dir/mutated-file", "data"), oldTime),
+		withTime(testutil.Lnk(0644, "./dir/link", "old-file"), oldTime),
+	})
+
+	releaseDir := c.MkDir()
+	for path, data := range reproducibleRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "myslice"}})
+	c.Assert(err, IsNil)
+	archives := map[string]archive.Archive{
+		"ubuntu": &testArchive{
+			options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+			pkgs:    map[string][]byte{"test-package": pkgData},
+		},
+	}
+
+	cut := func(options *slicer.RunOptions) {
+		options.Selection = selection
+		options.Archives = archives
+		options.SourceDate = sourceDate
+		_, err := slicer.Run(options)
+		c.Assert(err, IsNil)
+	}
+
+	targetDir := c.MkDir()
+	cut(&slicer.RunOptions{TargetDir: targetDir})
+	mtimes := make(map[string]string)
+	err = filepath.WalkDir(targetDir, func(path string, d fs.DirEntry, err error) error {
+		c.Assert(err, IsNil)
+		info, err := d.Info()
+		c.Assert(err, IsNil)
+		relPath := strings.TrimPrefix(path, targetDir)
+		if d.IsDir() {
+			relPath = strings.TrimSuffix(relPath, "/") + "/"
+		}
+		mtimes[relPath] = info.ModTime().UTC().Format(time.DateOnly)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(mtimes, DeepEquals, map[string]string{
+		"/":                    "2020-01-01",
+		"/dir/":                "2000-01-01",
+		"/dir/old-file":        "2000-01-01",
+		"/dir/new-file":        "2020-01-01",
+		"/dir/mutated-file":    "2020-01-01",
+		"/dir/link":            "2000-01-01",
+		"/other-dir/":          "2020-01-01",
+		"/other-dir/text-file": "2020-01-01",
+		"/other-dir/sub-dir/":  "2020-01-01",
+	})
+
+	// Cutting into memory twice results in the same archive.
+	var tarData [2]bytes.Buffer
+	for i := range tarData {
+		memFS := fsutil.NewMemFS()
+		cut(&slicer.RunOptions{TargetDir: "/", FS: memFS})
+		err := memFS.WriteTar(&tarData[i])
+		c.Assert(err, IsNil)
+	}
+	c.Assert(tarData[0].Bytes(), DeepEquals, tarData[1].Bytes())
+	tr := tar.NewReader(&tarData[0])
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		c.Assert(hdr.ModTime.UTC().Format(time.DateOnly), Equals, mtimes["/"+hdr.Name], Commentf("%s", hdr.Name))
+	}
+}
+
+var ownershipRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				contents:
+					/var/lib/pkg/:
+					/var/lib/pkg/file:
+					/etc/pkg/: {make: true, user: 5, group: 6}
+					/etc/pkg/conf: {text: data, group: 6}
+	`,
+}
+
+func (s *S) TestRunOwnership(c *C) {
+	withOwner := func(entry testutil.TarEntry, uid, gid int) testutil.TarEntry {
+		entry.Header.Uid = uid
+		entry.Header.Gid = gid
+		return entry
+	}
+	pkgData := testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Dir(0755, "./var/"),
+		testutil.Dir(0755, "./var/lib/"),
+		withOwner(testutil.Dir(0700, "./var/lib/pkg/"), 102, 104),
+		withOwner(testutil.Reg(0640, "./var/lib/pkg/file", "data"), 102, 104),
+	})
+
+	releaseDir := c.MkDir()
+	for path, data := range ownershipRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "myslice"}})
+	c.Assert(err, IsNil)
+	options := &slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{
+				options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+				pkgs:    map[string][]byte{"test-package": pkgData},
+			},
+		},
+	}
+	expected := map[string]string{
+		"/etc/":             "0:0",
+		"/etc/pkg/":         "5:6",
+		"/etc/pkg/conf":     "0:6",
+		"/var/":             "0:0",
+		"/var/lib/":         "0:0",
+		"/var/lib/pkg/":     "102:104",
+		"/var/lib/pkg/file": "102:104",
+	}
+
+	// The owner is recorded in the tar output.
+	memFS := fsutil.NewMemFS()
+	options.TargetDir = "/"
+	options.FS = memFS
+	_, err = slicer.Run(options)
+	c.Assert(err, IsNil)
+	var tarData bytes.Buffer
+	err = memFS.WriteTar(&tarData)
+	c.Assert(err, IsNil)
+	owners := make(map[string]string)
+	tr := tar.NewReader(&tarData)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		owners["/"+hdr.Name] = fmt.Sprintf("%d:%d", hdr.Uid, hdr.Gid)
+	}
+	c.Assert(owners, DeepEquals, expected)
+
+	if os.Geteuid() != 0 {
+		c.Skip("changing the owner on disk requires root")
+	}
+	targetDir := c.MkDir()
+	options.TargetDir = targetDir
+	options.FS = nil
+	_, err = slicer.Run(options)
+	c.Assert(err, IsNil)
+	owners = make(map[string]string)
+	err = filepath.WalkDir(targetDir, func(path string, d fs.DirEntry, err error) error {
+		c.Assert(err, IsNil)
+		if path == targetDir {
+			return nil
+		}
+		info, err := d.Info()
+		c.Assert(err, IsNil)
+		stat := info.Sys().(*syscall.Stat_t)
+		relPath := strings.TrimPrefix(path, targetDir)
+		if d.IsDir() {
+			relPath += "/"
+		}
+		owners[relPath] = fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(owners, DeepEquals, expected)
+}
+
+var capabilitiesRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				contents:
+					/usr/bin/ping:
+					/usr/bin/arping: {capabilities: cap_net_raw+p}
+					/usr/bin/script: {text: data, capabilities: cap_chown+ep}
+	`,
+}
+
+func (s *S) TestRunCapabilities(c *C) {
+	pingCaps, err := fsutil.ParseCapabilities("cap_net_raw+ep")
+	c.Assert(err, IsNil)
+	ping := testutil.Reg(0755, "./usr/bin/ping", "ping")
+	ping.Header.PAXRecords = map[string]string{
+		"SCHILY.xattr.security.capability": pingCaps,
+	}
+	arping := testutil.Reg(0755, "./usr/bin/arping", "arping")
+	arping.Header.PAXRecords = map[string]string{
+		"SCHILY.xattr.security.capability": pingCaps,
+	}
+	pkgData := testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Dir(0755, "./usr/"),
+		testutil.Dir(0755, "./usr/bin/"),
+		ping,
+		arping,
+	})
+
+	releaseDir := c.MkDir()
+	for path, data := range capabilitiesRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "myslice"}})
+	c.Assert(err, IsNil)
+	options := &slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{
+				options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+				pkgs:    map[string][]byte{"test-package": pkgData},
+			},
+		},
+	}
+	// Capabilities declared in the slice replace the ones in the package.
+	expected := map[string]string{
+		"/usr/bin/arping": "0000000200200000000000000000000000000000",
+		"/usr/bin/ping":   "0100000200200000000000000000000000000000",
+		"/usr/bin/script": "0100000201000000000000000000000000000000",
+	}
+
+	// The capabilities are reported and recorded in the tar output.
+	memFS := fsutil.NewMemFS()
+	options.TargetDir = "/"
+	options.FS = memFS
+	report, err := slicer.Run(options)
+	c.Assert(err, IsNil)
+	reported := make(map[string]string)
+	for path, entry := range report.Entries {
+		if value, ok := entry.Xattrs[fsutil.CapabilityXattr]; ok {
+			reported[path] = hex.EncodeToString([]byte(value))
+		}
+	}
+	c.Assert(reported, DeepEquals, expected)
+	var tarData bytes.Buffer
+	err = memFS.WriteTar(&tarData)
+	c.Assert(err, IsNil)
+	archived := make(map[string]string)
+	tr := tar.NewReader(&tarData)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		if value, ok := tarutil.Xattrs(hdr)[fsutil.CapabilityXattr]; ok {
+			archived["/"+hdr.Name] = hex.EncodeToString([]byte(value))
+		}
+	}
+	c.Assert(archived, DeepEquals, expected)
+
+	if os.Geteuid() != 0 {
+		c.Skip("setting capabilities on disk requires root")
+	}
+	targetDir := c.MkDir()
+	options.TargetDir = targetDir
+	options.FS = nil
+	_, err = slicer.Run(options)
+	c.Assert(err, IsNil)
+	for path, value := range expected {
+		data := make([]byte, 64)
+		n, err := unix.Lgetxattr(filepath.Join(targetDir, path), fsutil.CapabilityXattr, data)
+		c.Assert(err, IsNil)
+		c.Assert(hex.EncodeToString(data[:n]), Equals, value)
+	}
+}
+
+var devicesRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				contents:
+					/dev/null: {device: char, major: 1, minor: 3, mode: 0666}
+					/dev/sda: {device: block, major: 8, mode: 0660, group: 6}
+					/run/initctl: {device: fifo, mode: 0600}
+					/db/**: {generate: manifest}
+	`,
+}
+
+func (s *S) TestRunDevices(c *C) {
+	releaseDir := c.MkDir()
+	for path, data := range devicesRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "myslice"}})
+	c.Assert(err, IsNil)
+	options := &slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{
+				options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+				pkgs:    map[string][]byte{"test-package": testutil.PackageData["test-package"]},
+			},
+		},
+	}
+	devices := map[string]string{
+		"/dev/null":    "char 0666 1:3",
+		"/dev/sda":     "block 0660 8:0",
+		"/run/initctl": "fifo 0600",
+	}
+
+	// Devices are always recorded in the report, the manifest and the tar
+	// output.
+	memFS := fsutil.NewMemFS()
+	options.TargetDir = "/"
+	options.FS = memFS
+	report, err := slicer.Run(options)
+	c.Assert(err, IsNil)
+	reported := treeDumpReport(report)
+	manifestData, err := memFS.ReadFile("/db/manifest.wall")
+	c.Assert(err, IsNil)
+	r, err := zstd.NewReader(bytes.NewReader(manifestData))
+	c.Assert(err, IsNil)
+	defer r.Close()
+	mfest, err := manifest.Read(r)
+	c.Assert(err, IsNil)
+	manifestPaths := treeDumpManifestPaths(mfest)
+	var tarData bytes.Buffer
+	err = memFS.WriteTar(&tarData)
+	c.Assert(err, IsNil)
+	tarDump := testutil.TarDump(&tarData)
+	for path, dump := range devices {
+		c.Assert(reported[path], Equals, dump+" {test-package_myslice}")
+		c.Assert(manifestPaths[path], Equals, dump+" {test-package_myslice}")
+		c.Assert(tarDump[path], Equals, dump)
+	}
+
+	targetDir := c.MkDir()
+	options.TargetDir = targetDir
+	options.FS = nil
+	report, err = slicer.Run(options)
+	c.Assert(err, IsNil)
+	reported = treeDumpReport(report)
+	mfest = readManifest(c, targetDir, "/db/manifest.wall")
+	manifestPaths = treeDumpManifestPaths(mfest)
+	fsDump := testutil.TreeDump(targetDir)
+	for path, dump := range devices {
+		c.Assert(reported[path], Equals, dump+" {test-package_myslice}")
+		c.Assert(manifestPaths[path], Equals, dump+" {test-package_myslice}")
+		if os.Geteuid() != 0 && !strings.HasPrefix(dump, "fifo") {
+			// Devices are only created with privileges.
+			dump = ""
+		}
+		c.Assert(fsDump[path], Equals, dump)
+	}
+
+	// Devices skipped for lack of privileges are not reported as missing.
+	problems, err := manifest.Verify(mfest, targetDir)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+}
+
+var dpkgStatusRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			myslice:
+				contents:
+					/dir/file:
+			status:
+				contents:
+					/var/lib/dpkg/status: {generate: dpkg-status}
+					/var/lib/dpkg/status.d/**: {generate: dpkg-status}
+	`,
+	"slices/mydir/other-package.yaml": `
+		package: other-package
+		slices:
+			myslice:
+				contents:
+					/file:
+	`,
+}
+
+func (s *S) TestRunDpkgStatus(c *C) {
+	releaseDir := c.MkDir()
+	for path, data := range dpkgStatusRelease {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	selection, err := setup.Select(release, []setup.SliceKey{
+		{Package: "test-package", Slice: "myslice"},
+		{Package: "test-package", Slice: "status"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+	c.Assert(err, IsNil)
+	targetDir := c.MkDir()
+	report, err := slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives: map[string]archive.Archive{
+			"ubuntu": &testArchive{
+				options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+				pkgs: map[string][]byte{
+					"test-package":  testutil.PackageData["test-package"],
+					"other-package": testutil.PackageData["other-package"],
+				},
+			},
+		},
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+
+	reindent := func(s string) string { return strings.TrimSpace(string(testutil.Reindent(s))) + "\n" }
+	otherStanza := reindent(`
+		Package: other-package
+		Status: install ok installed
+		Architecture: amd64
+		Version: 1.0
+		Chisel-Slices: other-package_myslice
+		Description: slices of other-package installed by Chisel
+		 Only the content of the slices listed in Chisel-Slices is present,
+		 not the whole package.
+	`)
+	testStanza := reindent(`
+		Package: test-package
+		Status: install ok installed
+		Architecture: amd64
+		Version: 1.0
+		Chisel-Slices: test-package_myslice test-package_status
+		Description: slices of test-package installed by Chisel
+		 Only the content of the slices listed in Chisel-Slices is present,
+		 not the whole package.
+	`)
+	expected := map[string]string{
+		"/var/lib/dpkg/status":                 otherStanza + "\n" + testStanza,
+		"/var/lib/dpkg/status.d/other-package": otherStanza,
+		"/var/lib/dpkg/status.d/test-package":  testStanza,
+	}
+	for relPath, content := range expected {
+		data, err := os.ReadFile(filepath.Join(targetDir, relPath))
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+		entry, ok := report.Entries[relPath]
+		c.Assert(ok, Equals, true)
+		c.Assert(entry.Mode, Equals, fs.FileMode(0644))
+		c.Assert(entry.Slices, HasLen, 1)
+	}
+}
+
+var installedRelease = map[string]string{
+	"chisel.yaml": string(defaultChiselYaml),
+	"slices/mydir/test-package.yaml": `
+		package: test-package
+		slices:
+			base:
+				contents:
+					/dir/file: {mutable: true}
+					/dir/text: {text: base, mutable: true}
+					/db/**:    {generate: manifest}
+				mutate: |
+					content.write("/dir/file", "mutated")
+					content.write("/dir/text", content.read("/dir/text") + "+base")
+			extra:
+				essential:
+					- test-package_base
+				contents:
+					/dir/file:       {mutable: true}
+					/dir/other-file:
+				mutate: |
+					content.write("/dir/text", content.read("/dir/text") + "+extra")
+	`,
+	"slices/mydir/other-package.yaml": `
+		package: other-package
+		slices:
+			myslice:
+				contents:
+					/file:
+	`,
+}
+
+func readInstalledRelease(c *C) *setup.Release {
+	return readTestRelease(c, installedRelease)
+}
+
+func readTestRelease(c *C, files map[string]string) *setup.Release {
+	releaseDir := c.MkDir()
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	return release
+}
+
+func installedArchives() map[string]archive.Archive {
+	return map[string]archive.Archive{
+		"ubuntu": &testArchive{
+			options: archive.Options{Label: "ubuntu", Arch: "amd64"},
+			pkgs: map[string][]byte{
+				"test-package":  testutil.PackageData["test-package"],
+				"other-package": testutil.PackageData["other-package"],
+			},
+		},
+	}
+}
+
+func (s *S) TestRunInstalled(c *C) {
+	release := readInstalledRelease(c)
+	targetDir := c.MkDir()
+
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "base"}})
+	c.Assert(err, IsNil)
+	_, err = slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: targetDir,
+	})
+	c.Assert(err, IsNil)
+	mfest := readManifest(c, targetDir, "/db/manifest.wall")
+
+	selection, err = setup.Select(release, []setup.SliceKey{
+		{Package: "test-package", Slice: "base"},
+		{Package: "test-package", Slice: "extra"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+	c.Assert(err, IsNil)
+	report, err := slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: targetDir,
+		Installed: mfest,
+	})
+	c.Assert(err, IsNil)
+
+	// The installed content is kept and the mutation scripts of the
+	// installed slices are not run again.
+	c.Assert(testutil.TreeDump(targetDir), DeepEquals, map[string]string{
+		"/db/":              "dir 0755",
+		"/db/manifest.wall": "file 0644 799ac241",
+		"/dir/":             "dir 0755",
+		"/dir/file":         "file 0644 7e030e2d",
+		"/dir/other-file":   "file 0644 63d5dd49",
+		"/dir/text":         "file 0644 691e6f52",
+		"/file":             "file 0644 fc02ca0e",
+	})
+	data, err := os.ReadFile(filepath.Join(targetDir, "/dir/text"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "base+base+extra")
+	c.Assert(treeDumpReport(report), DeepEquals, map[string]string{
+		"/db/manifest.wall": "file 0644 empty {test-package_base}",
+		"/dir/file":         "file 0644 cc55e2ec 7e030e2d {test-package_base,test-package_extra}",
+		"/dir/other-file":   "file 0644 63d5dd49 {test-package_extra}",
+		"/dir/text":         "file 0644 cae66217 691e6f52 {test-package_base}",
+		"/file":             "file 0644 fc02ca0e {other-package_myslice}",
+	})
+
+	// The manifest describes the whole tree.
+	mfest = readManifest(c, targetDir, "/db/manifest.wall")
+	c.Assert(treeDumpManifestPaths(mfest), DeepEquals, treeDumpReport(report))
+	problems, err := manifest.Verify(mfest, targetDir)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+}
+
+func (s *S) TestRunInstalledErrors(c *C) {
+	release := readInstalledRelease(c)
+	writeInstalled := func(options *manifest.WriteOptions) *manifest.Manifest {
+		var buf bytes.Buffer
+		err := manifest.Write(&buf, options)
+		c.Assert(err, IsNil)
+		mfest, err := manifest.Read(&buf)
+		c.Assert(err, IsNil)
+		return mfest
+	}
+	baseSlice := release.Packages["test-package"].Slices["base"]
+	otherSlice := release.Packages["other-package"].Slices["myslice"]
+
+	selection, err := setup.Select(release, []setup.SliceKey{{Package: "test-package", Slice: "base"}})
+	c.Assert(err, IsNil)
+	_, err = slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: c.MkDir(),
+		Installed: writeInstalled(&manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "other-package", Version: "1.0"}},
+			Slices:   []*setup.Slice{otherSlice},
+		}),
+	})
+	c.Assert(err, ErrorMatches, `cannot read installed content: installed slice other-package_myslice is not selected`)
+
+	selection, err = setup.Select(release, []setup.SliceKey{
+		{Package: "test-package", Slice: "base"},
+		{Package: "test-package", Slice: "extra"},
+		{Package: "other-package", Slice: "myslice"},
+	})
+	c.Assert(err, IsNil)
+	_, err = slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: c.MkDir(),
+		Installed: writeInstalled(&manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "test-package", Version: "0.9"}},
+			Slices:   []*setup.Slice{baseSlice},
+		}),
+	})
+	c.Assert(err, ErrorMatches, `cannot add slices of package test-package: installed version 0.9 differs from archive version 1.0`)
+
+	// The mutation scripts of installed slices are not run again, so new
+	// content must not be created at the paths they list.
+	_, err = slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: c.MkDir(),
+		Installed: writeInstalled(&manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "test-package", Version: "1.0"}},
+			Slices:   []*setup.Slice{baseSlice},
+		}),
+	})
+	c.Assert(err, ErrorMatches, `cannot add slice test-package_extra: path /dir/file may change content of installed slice test-package_base, which has a mutation script`)
+
+	// Packages without new slices keep their installed version.
+	report, err := slicer.Run(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  installedArchives(),
+		TargetDir: c.MkDir(),
+		Installed: writeInstalled(&manifest.WriteOptions{
+			Packages: []*manifest.Package{{Name: "other-package", Version: "0.9"}},
+			Slices:   []*setup.Slice{otherSlice},
+		}),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(report.Packages["other-package"].Version, Equals, "0.9")
+}
+
 func runSlicerTests(c *C, tests []slicerTest) {
 	for _, test := range tests {
 		for _, slices := range testutil.Permutations(test.slices) {
@@ -1150,6 +2351,9 @@ func runSlicerTests(c *C, tests []slicerTest) {
 					},
 					pkgs: test.pkgs,
 				}
+				if pkgs, ok := test.archivePkgs[name]; ok {
+					archive.pkgs = pkgs
+				}
 				archives[name] = archive
 			}
 
@@ -1177,8 +2381,141 @@ func runSlicerTests(c *C, tests []slicerTest) {
 			if test.report != nil {
 				c.Assert(treeDumpReport(report), DeepEquals, test.report)
 			}
+
+			// The information of every package cut is recorded.
+			for _, slice := range selection.Slices {
+				info := report.Packages[slice.Package]
+				c.Assert(info, NotNil)
+				c.Assert(info.Name, Equals, slice.Package)
+				c.Assert(info.Version, Equals, "1.0")
+			}
+
+			manifestPaths := findManifestPaths(selection, test.arch)
+			for _, relPath := range manifestPaths {
+				mfest := readManifest(c, targetDir, relPath)
+				// Every generated manifest must describe the whole report.
+				c.Assert(treeDumpManifestPaths(mfest), DeepEquals, treeDumpReport(report))
+				if test.manifestPaths != nil {
+					c.Assert(treeDumpManifestPaths(mfest), DeepEquals, test.manifestPaths)
+				}
+				if test.manifestPkgs != nil {
+					c.Assert(treeDumpManifestPkgs(mfest), DeepEquals, test.manifestPkgs)
+				}
+			}
+			if test.manifestPaths != nil {
+				c.Assert(manifestPaths, Not(HasLen), 0)
+			}
+
+			// Cutting into memory results in the same content.
+			memFS := fsutil.NewMemFS()
+			memReport, err := slicer.Run(&slicer.RunOptions{
+				Selection: options.Selection,
+				Archives:  options.Archives,
+				TargetDir: "/",
+				FS:        memFS,
+			})
+			c.Assert(err, IsNil)
+			c.Assert(treeDumpReport(memReport), DeepEquals, treeDumpReport(report))
+			var tarData bytes.Buffer
+			err = memFS.WriteTar(&tarData)
+			c.Assert(err, IsNil)
+			c.Assert(testutil.TarDump(&tarData), DeepEquals, testutil.TreeDump(options.TargetDir))
+		}
+	}
+}
+
+// findManifestPaths returns the paths of the manifests generated for the
+// selection and architecture, relative to the target directory.
+func findManifestPaths(selection *setup.Selection, arch string) []string {
+	var paths []string
+	for _, slice := range selection.Slices {
+		for path, info := range slice.Contents {
+			if info.Generate != setup.GenerateManifest {
+				continue
+			}
+			if len(info.Arch) > 0 && !slices.Contains(info.Arch, arch) {
+				continue
+			}
+			path = strings.TrimSuffix(path, "**") + "manifest.wall"
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
 		}
 	}
+	return paths
+}
+
+func readManifest(c *C, targetDir, relPath string) *manifest.Manifest {
+	f, err := os.Open(filepath.Join(targetDir, relPath))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	r, err := zstd.NewReader(f)
+	c.Assert(err, IsNil)
+	defer r.Close()
+	mfest, err := manifest.Read(r)
+	c.Assert(err, IsNil)
+	err = manifest.Validate(mfest)
+	c.Assert(err, IsNil)
+	return mfest
+}
+
+// treeDumpManifestPaths returns the paths in the manifest in the same format
+// as [treeDumpReport].
+func treeDumpManifestPaths(mfest *manifest.Manifest) map[string]string {
+	result := make(map[string]string)
+	err := mfest.IteratePaths("", func(path *manifest.Path) error {
+		var fsDump string
+		switch {
+		case strings.HasSuffix(path.Path, "/"):
+			fsDump = fmt.Sprintf("dir %s", path.Mode)
+		case path.Device == "fifo":
+			fsDump = fmt.Sprintf("fifo %s", path.Mode)
+		case path.Device != "":
+			fsDump = fmt.Sprintf("%s %s %d:%d", path.Device, path.Mode, path.Major, path.Minor)
+		case path.Link != "":
+			fsDump = fmt.Sprintf("symlink %s", path.Link)
+		default: // Regular
+			if path.Size == 0 {
+				fsDump = fmt.Sprintf("file %s empty", path.Mode)
+			} else if path.FinalHash != "" {
+				fsDump = fmt.Sprintf("file %s %s %s", path.Mode, path.Hash[:8], path.FinalHash[:8])
+			} else {
+				fsDump = fmt.Sprintf("file %s %s", path.Mode, path.Hash[:8])
+			}
+			if path.Inode != 0 {
+				fsDump += fmt.Sprintf(" inode %d", path.Inode)
+			}
+		}
+
+		// append {slice1, ..., sliceN} to the end of the path dump.
+		slicesStr := make([]string, 0, len(path.Slices))
+		slicesStr = append(slicesStr, path.Slices...)
+		sort.Strings(slicesStr)
+		result[path.Path] = fmt.Sprintf("%s {%s}", fsDump, strings.Join(slicesStr, ","))
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func treeDumpManifestPkgs(mfest *manifest.Manifest) map[string]string {
+	result := make(map[string]string)
+	err := mfest.IteratePackages(func(pkg *manifest.Package) error {
+		fields := []string{pkg.Name}
+		for _, field := range []string{pkg.Version, pkg.Digest, pkg.Arch} {
+			if field != "" {
+				fields = append(fields, field)
+			}
+		}
+		result[pkg.Name] = strings.Join(fields, " ")
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return result
 }
 
 // treeDumpReport returns the file information in the same format as
@@ -1196,6 +2533,12 @@ func treeDumpReport(report *slicer.Report) map[string]string {
 			fsDump = fmt.Sprintf("dir %#o", fperm)
 		case fs.ModeSymlink:
 			fsDump = fmt.Sprintf("symlink %s", entry.Link)
+		case fs.ModeDevice | fs.ModeCharDevice:
+			fsDump = fmt.Sprintf("char %#o %d:%d", fperm, entry.Major, entry.Minor)
+		case fs.ModeDevice:
+			fsDump = fmt.Sprintf("block %#o %d:%d", fperm, entry.Major, entry.Minor)
+		case fs.ModeNamedPipe:
+			fsDump = fmt.Sprintf("fifo %#o", fperm)
 		case 0: // Regular
 			if entry.Size == 0 {
 				fsDump = fmt.Sprintf("file %#o empty", entry.Mode.Perm())
@@ -1204,6 +2547,9 @@ func treeDumpReport(report *slicer.Report) map[string]string {
 			} else {
 				fsDump = fmt.Sprintf("file %#o %s", fperm, entry.Hash[:8])
 			}
+			if entry.Inode != 0 {
+				fsDump += fmt.Sprintf(" inode %d", entry.Inode)
+			}
 		default:
 			panic(fmt.Errorf("unknown file type %d: %s", entry.Mode.Type(), entry.Path))
 		}
@@ -0,0 +1,39 @@
+// Package tarutil holds helpers for the tar archives read from packages and
+// written by Chisel.
+package tarutil
+
+import (
+	"archive/tar"
+	"strings"
+)
+
+// xattrPrefix is the prefix of PAX records holding extended attributes.
+const xattrPrefix = "SCHILY.xattr."
+
+// Xattrs returns the extended attributes held in the PAX records of the
+// tar header, or nil if there are none.
+func Xattrs(header *tar.Header) map[string]string {
+	var xattrs map[string]string
+	for key, value := range header.PAXRecords {
+		name, ok := strings.CutPrefix(key, xattrPrefix)
+		if !ok {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[name] = value
+	}
+	return xattrs
+}
+
+// SetXattrs adds the extended attributes to the PAX records of the tar
+// header.
+func SetXattrs(header *tar.Header, xattrs map[string]string) {
+	for name, value := range xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords[xattrPrefix+name] = value
+	}
+}
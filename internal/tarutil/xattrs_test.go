@@ -0,0 +1,29 @@
+package tarutil_test
+
+import (
+	"archive/tar"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/tarutil"
+)
+
+func (s *S) TestXattrs(c *C) {
+	header := &tar.Header{}
+	c.Assert(tarutil.Xattrs(header), IsNil)
+
+	tarutil.SetXattrs(header, map[string]string{
+		"security.capability": "caps",
+		"user.comment":        "comment",
+	})
+	header.PAXRecords["comment"] = "not an xattr"
+	c.Assert(header.PAXRecords, DeepEquals, map[string]string{
+		"SCHILY.xattr.security.capability": "caps",
+		"SCHILY.xattr.user.comment":        "comment",
+		"comment":                          "not an xattr",
+	})
+	c.Assert(tarutil.Xattrs(header), DeepEquals, map[string]string{
+		"security.capability": "caps",
+		"user.comment":        "comment",
+	})
+}
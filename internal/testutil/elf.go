@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+)
+
+// MakeSharedObject returns a minimal 64-bit little-endian ELF shared object
+// for the given machine, with its dynamic section holding soname unless it
+// is empty.
+func MakeSharedObject(machine elf.Machine, soname string) []byte {
+	const headerSize = 64
+	const sectionSize = 64
+
+	dynstr := []byte("\x00" + soname + "\x00")
+	var dynamic bytes.Buffer
+	if soname != "" {
+		binary.Write(&dynamic, binary.LittleEndian, elf.Dyn64{Tag: int64(elf.DT_SONAME), Val: 1})
+	}
+	binary.Write(&dynamic, binary.LittleEndian, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	shstrtab := []byte("\x00.dynstr\x00.dynamic\x00.shstrtab\x00")
+
+	dynstrOff := uint64(headerSize)
+	dynamicOff := dynstrOff + uint64(len(dynstr))
+	shstrtabOff := dynamicOff + uint64(dynamic.Len())
+	sectionsOff := shstrtabOff + uint64(len(shstrtab))
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     sectionsOff,
+		Ehsize:    headerSize,
+		Shentsize: sectionSize,
+		Shnum:     4,
+		Shstrndx:  3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{{}, {
+		Name:      1,
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       dynstrOff,
+		Size:      uint64(len(dynstr)),
+		Addralign: 1,
+	}, {
+		Name:      9,
+		Type:      uint32(elf.SHT_DYNAMIC),
+		Off:       dynamicOff,
+		Size:      uint64(dynamic.Len()),
+		Link:      1,
+		Addralign: 8,
+		Entsize:   16,
+	}, {
+		Name:      18,
+		Type:      uint32(elf.SHT_STRTAB),
+		Off:       shstrtabOff,
+		Size:      uint64(len(shstrtab)),
+		Addralign: 1,
+	}}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &header)
+	buf.Write(dynstr)
+	buf.Write(dynamic.Bytes())
+	buf.Write(shstrtab)
+	binary.Write(&buf, binary.LittleEndian, sections)
+	return buf.Bytes()
+}
@@ -86,7 +86,12 @@ func fixupTarEntry(entry *TarEntry) {
 		hdr.ModTime = epochStartTime
 	}
 	if hdr.Format == 0 {
-		hdr.Format = tar.FormatGNU
+		if len(hdr.PAXRecords) > 0 {
+			// Only PAX supports records such as extended attributes.
+			hdr.Format = tar.FormatPAX
+		} else {
+			hdr.Format = tar.FormatGNU
+		}
 	}
 }
 
@@ -123,6 +128,12 @@ func compressBytesZstd(input []byte) ([]byte, error) {
 }
 
 func MakeDeb(entries []TarEntry) ([]byte, error) {
+	return MakeDebWithControl("", entries)
+}
+
+// MakeDebWithControl is like MakeDeb but also includes a control
+// payload holding the provided control file, unless it is empty.
+func MakeDebWithControl(control string, entries []TarEntry) ([]byte, error) {
 	var buf bytes.Buffer
 
 	tarData, err := makeTar(entries)
@@ -138,6 +149,26 @@ func MakeDeb(entries []TarEntry) ([]byte, error) {
 	if err := writer.WriteGlobalHeader(); err != nil {
 		return nil, err
 	}
+	if control != "" {
+		controlData, err := makeTar([]TarEntry{
+			Dir(0755, "./"),
+			Reg(0644, "./control", control),
+		})
+		if err != nil {
+			return nil, err
+		}
+		controlHeader := ar.Header{
+			Name: "control.tar",
+			Mode: 0644,
+			Size: int64(len(controlData)),
+		}
+		if err := writer.WriteHeader(&controlHeader); err != nil {
+			return nil, err
+		}
+		if _, err = writer.Write(controlData); err != nil {
+			return nil, err
+		}
+	}
 	dataHeader := ar.Header{
 		Name: "data.tar.zst",
 		Mode: 0644,
@@ -160,6 +191,14 @@ func MustMakeDeb(entries []TarEntry) []byte {
 	return data
 }
 
+func MustMakeDebWithControl(control string, entries []TarEntry) []byte {
+	data, err := MakeDebWithControl(control, entries)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
 // Reg is a shortcut for creating a regular file TarEntry structure (with
 // tar.Typeflag set tar.TypeReg). Reg stands for "REGular file".
 func Reg(mode int64, path, content string) TarEntry {
@@ -197,3 +236,16 @@ func Lnk(mode int64, path, target string) TarEntry {
 		},
 	}
 }
+
+// Hlk is a shortcut for creating a hard link TarEntry structure (with
+// tar.Typeflag set to tar.TypeLink). Hlk stands for "Hard LinK".
+func Hlk(mode int64, path, target string) TarEntry {
+	return TarEntry{
+		Header: tar.Header{
+			Typeflag: tar.TypeLink,
+			Name:     path,
+			Mode:     mode,
+			Linkname: target,
+		},
+	}
+}
@@ -1,11 +1,16 @@
 package testutil
 
 import (
+	"archive/tar"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 
 	"github.com/canonical/chisel/internal/fsutil"
 )
@@ -52,6 +57,13 @@ func TreeDump(dir string) map[string]string {
 				entry = fmt.Sprintf("file %#o %.4x", fperm, sum)
 			}
 			result["/"+path] = entry
+		case fs.ModeDevice | fs.ModeCharDevice, fs.ModeDevice, fs.ModeNamedPipe:
+			stat, ok := finfo.Sys().(*syscall.Stat_t)
+			if !ok {
+				return fmt.Errorf("cannot get device numbers: %s", fpath)
+			}
+			rdev := uint64(stat.Rdev)
+			result["/"+path] = deviceDump(ftype, fperm, unix.Major(rdev), unix.Minor(rdev))
 		default:
 			return fmt.Errorf("unknown file type %d: %s", ftype, fpath)
 		}
@@ -80,7 +92,68 @@ func TreeDumpEntry(entry *fsutil.Entry) string {
 		} else {
 			return fmt.Sprintf("file %#o %s", fperm, entry.Hash[:8])
 		}
+	case fs.ModeDevice | fs.ModeCharDevice, fs.ModeDevice, fs.ModeNamedPipe:
+		return deviceDump(entry.Mode.Type(), fperm, entry.Major, entry.Minor)
 	default:
 		panic(fmt.Errorf("unknown file type %d: %s", entry.Mode.Type(), entry.Path))
 	}
 }
+
+// TarDump returns the entries of the tar archive in the same format as
+// [testutil.TreeDump].
+func TarDump(r io.Reader) map[string]string {
+	result := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		fperm := fs.FileMode(hdr.Mode) & fs.ModePerm
+		if hdr.Mode&01000 != 0 {
+			fperm |= 01000
+		}
+		path := "/" + hdr.Name
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			result[path] = fmt.Sprintf("dir %#o", fperm)
+		case tar.TypeSymlink:
+			result[path] = fmt.Sprintf("symlink %s", hdr.Linkname)
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				panic(err)
+			}
+			if len(data) == 0 {
+				result[path] = fmt.Sprintf("file %#o empty", fperm)
+			} else {
+				result[path] = fmt.Sprintf("file %#o %.4x", fperm, sha256.Sum256(data))
+			}
+		case tar.TypeLink:
+			// Hard links dump as their target, as seen on disk.
+			result[path] = result["/"+hdr.Linkname]
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			ftype := hdr.FileInfo().Mode().Type()
+			result[path] = deviceDump(ftype, fperm, uint32(hdr.Devmajor), uint32(hdr.Devminor))
+		default:
+			panic(fmt.Errorf("unknown tar entry type %d: %s", hdr.Typeflag, hdr.Name))
+		}
+	}
+	return result
+}
+
+// deviceDump returns the dump of a device or FIFO with the provided file
+// type, permissions and device numbers.
+func deviceDump(ftype, fperm fs.FileMode, major, minor uint32) string {
+	switch ftype {
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return fmt.Sprintf("char %#o %d:%d", fperm, major, minor)
+	case fs.ModeDevice:
+		return fmt.Sprintf("block %#o %d:%d", fperm, major, minor)
+	default:
+		return fmt.Sprintf("fifo %#o", fperm)
+	}
+}